@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -50,6 +51,7 @@ const (
 	defJaegerURL         = ""
 	defThingsAuthURL     = "localhost:8181"
 	defThingsAuthTimeout = "1s"
+	defFormats           = ""
 
 	envLogLevel          = "MF_POSTGRES_READER_LOG_LEVEL"
 	envPort              = "MF_POSTGRES_READER_PORT"
@@ -67,6 +69,7 @@ const (
 	envJaegerURL         = "MF_JAEGER_URL"
 	envThingsAuthURL     = "MF_THINGS_AUTH_GRPC_URL"
 	envThingsAuthTimeout = "MF_THINGS_AUTH_GRPC_TIMEOUT"
+	envFormats           = "MF_POSTGRES_READER_FORMATS"
 )
 
 type config struct {
@@ -78,6 +81,7 @@ type config struct {
 	jaegerURL         string
 	thingsAuthURL     string
 	thingsAuthTimeout time.Duration
+	formats           []string
 }
 
 func main() {
@@ -99,7 +103,7 @@ func main() {
 	db := connectToDB(cfg.dbConfig, logger)
 	defer db.Close()
 
-	repo := newService(db, logger)
+	repo := newService(db, cfg.formats, logger)
 
 	errs := make(chan error, 2)
 
@@ -147,9 +151,23 @@ func loadConfig() config {
 		jaegerURL:         mainflux.Env(envJaegerURL, defJaegerURL),
 		thingsAuthURL:     mainflux.Env(envThingsAuthURL, defThingsAuthURL),
 		thingsAuthTimeout: authTimeout,
+		formats:           parseFormats(mainflux.Env(envFormats, defFormats)),
 	}
 }
 
+// parseFormats returns tables of the JSON transformer formats, which are
+// read in addition to the SenML messages table.
+func parseFormats(formats string) []string {
+	ret := []string{}
+	for _, f := range strings.Split(formats, sep) {
+		if f = strings.TrimSpace(f); f != "" {
+			ret = append(ret, f)
+		}
+	}
+
+	return ret
+}
+
 func connectToDB(dbConfig postgres.Config, logger logger.Logger) *sqlx.DB {
 	db, err := postgres.Connect(dbConfig)
 	if err != nil {
@@ -207,8 +225,8 @@ func connectToThings(cfg config, logger logger.Logger) *grpc.ClientConn {
 	return conn
 }
 
-func newService(db *sqlx.DB, logger logger.Logger) readers.MessageRepository {
-	svc := postgres.New(db)
+func newService(db *sqlx.DB, formats []string, logger logger.Logger) readers.MessageRepository {
+	var svc readers.MessageRepository = postgres.New(db, postgres.WithFormats(formats...))
 	svc = api.LoggingMiddleware(svc, logger)
 	svc = api.MetricsMiddleware(
 		svc,
@@ -70,6 +70,16 @@ func migrateDB(db *sqlx.DB) error {
 					"DROP TABLE messages",
 				},
 			},
+			{
+				Id: "messages_2",
+				Up: []string{
+					`ALTER TABLE messages ADD COLUMN IF NOT EXISTS ingested FLOAT`,
+					`ALTER TABLE messages ALTER COLUMN ingested SET DEFAULT EXTRACT(EPOCH FROM CURRENT_TIMESTAMP)`,
+				},
+				Down: []string{
+					"ALTER TABLE messages DROP COLUMN ingested",
+				},
+			},
 		},
 	}
 
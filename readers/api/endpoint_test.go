@@ -5,6 +5,7 @@ package api_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -382,6 +383,66 @@ func TestReadAll(t *testing.T) {
 	}
 }
 
+// errRepository always fails with the given error.
+type errRepository struct {
+	err error
+}
+
+func (er errRepository) ReadAll(string, readers.PageMetadata) (readers.MessagesPage, error) {
+	return readers.MessagesPage{}, er.err
+}
+
+func TestReadAllRepositoryError(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	svc := mocks.NewThingsService()
+
+	cases := map[string]struct {
+		err    error
+		status int
+	}{
+		"read page with invalid time range": {
+			err:    readers.ErrInvalidTimeRange,
+			status: http.StatusBadRequest,
+		},
+		"read page with invalid value range": {
+			err:    readers.ErrInvalidValueRange,
+			status: http.StatusBadRequest,
+		},
+		"read page with invalid comparator": {
+			err:    readers.ErrInvalidComparator,
+			status: http.StatusBadRequest,
+		},
+		"read page with invalid format": {
+			err:    readers.ErrInvalidFormat,
+			status: http.StatusBadRequest,
+		},
+		"read page from unavailable repository": {
+			err:    readers.ErrServiceUnavailable,
+			status: http.StatusServiceUnavailable,
+		},
+		"read page with repository failure": {
+			err:    errors.New("connection refused"),
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for desc, tc := range cases {
+		ts := newServer(errRepository{err: tc.err}, svc)
+		req := testRequest{
+			client: ts.Client(),
+			method: http.MethodGet,
+			url:    fmt.Sprintf("%s/channels/%s/messages?limit=10", ts.URL, chanID),
+			token:  token,
+		}
+		res, err := req.make()
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", desc, err))
+		assert.Equal(t, tc.status, res.StatusCode, fmt.Sprintf("%s: expected %d got %d", desc, tc.status, res.StatusCode))
+		ts.Close()
+	}
+}
+
 type pageRes struct {
 	readers.PageMetadata
 	Total    uint64          `json:"total"`
@@ -181,10 +181,16 @@ func encodeResponse(_ context.Context, w http.ResponseWriter, response interface
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	switch {
 	case errors.Contains(err, nil):
-	case errors.Contains(err, errInvalidRequest):
+	case errors.Contains(err, errInvalidRequest),
+		readers.InvalidRequest(err),
+		errors.Contains(err, readers.ErrTableNotFound):
 		w.WriteHeader(http.StatusBadRequest)
 	case errors.Contains(err, errUnauthorizedAccess):
 		w.WriteHeader(http.StatusForbidden)
+	case errors.Contains(err, readers.ErrServiceUnavailable):
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case errors.Contains(err, readers.ErrTooManyRequests):
+		w.WriteHeader(http.StatusTooManyRequests)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -0,0 +1,7 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package arrow contains columnar records laid out in memory the way
+// Apache Arrow lays them out, so that read messages can be handed off
+// to analytics engines without being serialized.
+package arrow
@@ -0,0 +1,294 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package arrow
+
+import "errors"
+
+// ErrInvalidRecord indicates record columns that don't match its schema.
+var ErrInvalidRecord = errors.New("record columns don't match schema")
+
+// Type represents logical type of the column values.
+type Type int
+
+const (
+	// Timestamp columns hold nanoseconds since the epoch.
+	Timestamp Type = iota
+	// Float64 columns hold double precision values.
+	Float64
+	// String columns hold UTF-8 encoded values.
+	String
+)
+
+func (t Type) String() string {
+	switch t {
+	case Timestamp:
+		return "timestamp[ns]"
+	case Float64:
+		return "float64"
+	case String:
+		return "utf8"
+	default:
+		return "unknown"
+	}
+}
+
+// Field describes the record column.
+type Field struct {
+	Name     string
+	Type     Type
+	Nullable bool
+}
+
+// Schema describes the record columns, in the order of the columns.
+type Schema struct {
+	Fields []Field
+}
+
+// Array represents column values. Validity of the values is kept as a
+// bitmap, which is nil if none of the values is null.
+type Array interface {
+	// DataType returns type of the column values.
+	DataType() Type
+
+	// Len returns number of the column values.
+	Len() int
+
+	// NullN returns number of the null values.
+	NullN() int
+
+	// IsNull reports whether the i-th value is null.
+	IsNull(i int) bool
+}
+
+type nulls struct {
+	bitmap []byte
+	length int
+	count  int
+}
+
+func (n *nulls) append(valid bool) {
+	if n.length%8 == 0 {
+		n.bitmap = append(n.bitmap, 0)
+	}
+	if valid {
+		n.bitmap[n.length/8] |= 1 << uint(n.length%8)
+	} else {
+		n.count++
+	}
+	n.length++
+}
+
+// finish drops the bitmap of the values which are all valid.
+func (n nulls) finish() nulls {
+	if n.count == 0 {
+		n.bitmap = nil
+	}
+	return n
+}
+
+func (n nulls) Len() int {
+	return n.length
+}
+
+func (n nulls) NullN() int {
+	return n.count
+}
+
+func (n nulls) IsNull(i int) bool {
+	return n.bitmap != nil && n.bitmap[i/8]&(1<<uint(i%8)) == 0
+}
+
+// TimestampArray holds timestamps in nanoseconds since the epoch. Null values are zero.
+type TimestampArray struct {
+	nulls
+	values []int64
+}
+
+var _ Array = (*TimestampArray)(nil)
+
+func (a *TimestampArray) DataType() Type {
+	return Timestamp
+}
+
+// Value returns the i-th value.
+func (a *TimestampArray) Value(i int) int64 {
+	return a.values[i]
+}
+
+// Float64Array holds float64 values. Null values are zero.
+type Float64Array struct {
+	nulls
+	values []float64
+}
+
+var _ Array = (*Float64Array)(nil)
+
+func (a *Float64Array) DataType() Type {
+	return Float64
+}
+
+// Value returns the i-th value.
+func (a *Float64Array) Value(i int) float64 {
+	return a.values[i]
+}
+
+// StringArray holds string values as a single data buffer, which the
+// offsets buffer splits into values. Null values are empty.
+type StringArray struct {
+	nulls
+	offsets []int32
+	data    []byte
+}
+
+var _ Array = (*StringArray)(nil)
+
+func (a *StringArray) DataType() Type {
+	return String
+}
+
+// Value returns the i-th value.
+func (a *StringArray) Value(i int) string {
+	return string(a.data[a.offsets[i]:a.offsets[i+1]])
+}
+
+// TimestampBuilder builds timestamp array.
+type TimestampBuilder struct {
+	arr TimestampArray
+}
+
+// NewTimestampBuilder returns builder of the array with capacity for
+// the given number of values.
+func NewTimestampBuilder(size int) *TimestampBuilder {
+	return &TimestampBuilder{arr: TimestampArray{values: make([]int64, 0, size)}}
+}
+
+// Append appends valid value.
+func (b *TimestampBuilder) Append(v int64) {
+	b.arr.values = append(b.arr.values, v)
+	b.arr.append(true)
+}
+
+// AppendNull appends null value.
+func (b *TimestampBuilder) AppendNull() {
+	b.arr.values = append(b.arr.values, 0)
+	b.arr.append(false)
+}
+
+// Array returns the built array.
+func (b *TimestampBuilder) Array() *TimestampArray {
+	arr := b.arr
+	arr.nulls = arr.finish()
+	return &arr
+}
+
+// Float64Builder builds float64 array.
+type Float64Builder struct {
+	arr Float64Array
+}
+
+// NewFloat64Builder returns builder of the array with capacity for
+// the given number of values.
+func NewFloat64Builder(size int) *Float64Builder {
+	return &Float64Builder{arr: Float64Array{values: make([]float64, 0, size)}}
+}
+
+// Append appends valid value.
+func (b *Float64Builder) Append(v float64) {
+	b.arr.values = append(b.arr.values, v)
+	b.arr.append(true)
+}
+
+// AppendNull appends null value.
+func (b *Float64Builder) AppendNull() {
+	b.arr.values = append(b.arr.values, 0)
+	b.arr.append(false)
+}
+
+// Array returns the built array.
+func (b *Float64Builder) Array() *Float64Array {
+	arr := b.arr
+	arr.nulls = arr.finish()
+	return &arr
+}
+
+// StringBuilder builds string array.
+type StringBuilder struct {
+	arr StringArray
+}
+
+// NewStringBuilder returns builder of the array with capacity for
+// the given number of values.
+func NewStringBuilder(size int) *StringBuilder {
+	offsets := make([]int32, 1, size+1)
+	return &StringBuilder{arr: StringArray{offsets: offsets}}
+}
+
+// Append appends valid value.
+func (b *StringBuilder) Append(v string) {
+	b.arr.data = append(b.arr.data, v...)
+	b.arr.offsets = append(b.arr.offsets, int32(len(b.arr.data)))
+	b.arr.append(true)
+}
+
+// AppendNull appends null value.
+func (b *StringBuilder) AppendNull() {
+	b.arr.offsets = append(b.arr.offsets, int32(len(b.arr.data)))
+	b.arr.append(false)
+}
+
+// Array returns the built array.
+func (b *StringBuilder) Array() *StringArray {
+	arr := b.arr
+	arr.nulls = arr.finish()
+	return &arr
+}
+
+// Record represents rows as columns of the same length, one per schema field.
+type Record struct {
+	schema  Schema
+	rows    int
+	columns []Array
+}
+
+// NewRecord returns record of the given columns. ErrInvalidRecord is
+// returned if columns don't match the schema fields, have different
+// lengths, or if the column of non-nullable field has null values.
+func NewRecord(schema Schema, columns []Array) (Record, error) {
+	if len(columns) != len(schema.Fields) {
+		return Record{}, ErrInvalidRecord
+	}
+	rows := 0
+	for i, col := range columns {
+		f := schema.Fields[i]
+		if i == 0 {
+			rows = col.Len()
+		}
+		if col.DataType() != f.Type || col.Len() != rows || (!f.Nullable && col.NullN() > 0) {
+			return Record{}, ErrInvalidRecord
+		}
+	}
+
+	return Record{schema: schema, rows: rows, columns: columns}, nil
+}
+
+// Schema returns the record schema.
+func (r Record) Schema() Schema {
+	return r.schema
+}
+
+// NumRows returns number of the record rows.
+func (r Record) NumRows() int {
+	return r.rows
+}
+
+// NumCols returns number of the record columns.
+func (r Record) NumCols() int {
+	return len(r.columns)
+}
+
+// Column returns the i-th column, whose concrete type is the array of the
+// field type, e.g. *Float64Array.
+func (r Record) Column(i int) Array {
+	return r.columns[i]
+}
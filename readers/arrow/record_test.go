@@ -0,0 +1,109 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package arrow_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/readers/arrow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var schema = arrow.Schema{
+	Fields: []arrow.Field{
+		{Name: "time", Type: arrow.Timestamp},
+		{Name: "value", Type: arrow.Float64, Nullable: true},
+		{Name: "name", Type: arrow.String},
+	},
+}
+
+func TestNewRecord(t *testing.T) {
+	times := arrow.NewTimestampBuilder(3)
+	values := arrow.NewFloat64Builder(3)
+	names := arrow.NewStringBuilder(3)
+	for i := 0; i < 3; i++ {
+		times.Append(int64(1600000000+i) * 1e9)
+		if i == 1 {
+			values.AppendNull()
+		} else {
+			values.Append(float64(i) + 0.5)
+		}
+		names.Append(fmt.Sprintf("sensor%d", i))
+	}
+	nullNames := arrow.NewStringBuilder(1)
+	nullNames.AppendNull()
+
+	cases := map[string]struct {
+		columns []arrow.Array
+		err     error
+	}{
+		"create record": {
+			columns: []arrow.Array{times.Array(), values.Array(), names.Array()},
+		},
+		"create record with missing column": {
+			columns: []arrow.Array{times.Array(), values.Array()},
+			err:     arrow.ErrInvalidRecord,
+		},
+		"create record with column of wrong type": {
+			columns: []arrow.Array{times.Array(), names.Array(), names.Array()},
+			err:     arrow.ErrInvalidRecord,
+		},
+		"create record with columns of different lengths": {
+			columns: []arrow.Array{times.Array(), values.Array(), arrow.NewStringBuilder(0).Array()},
+			err:     arrow.ErrInvalidRecord,
+		},
+		"create record with null value of non-nullable field": {
+			columns: []arrow.Array{arrow.NewTimestampBuilder(0).Array(), arrow.NewFloat64Builder(0).Array(), nullNames.Array()},
+			err:     arrow.ErrInvalidRecord,
+		},
+	}
+
+	for desc, tc := range cases {
+		_, err := arrow.NewRecord(schema, tc.columns)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+	}
+}
+
+func TestRecordColumns(t *testing.T) {
+	times := arrow.NewTimestampBuilder(0)
+	values := arrow.NewFloat64Builder(0)
+	names := arrow.NewStringBuilder(0)
+	// Enough rows for the validity bitmap to span multiple bytes.
+	for i := 0; i < 20; i++ {
+		times.Append(int64(1600000000+i) * 1e9)
+		if i%3 == 0 {
+			values.AppendNull()
+		} else {
+			values.Append(float64(i))
+		}
+		names.Append(fmt.Sprintf("sensor%d", i%4))
+	}
+
+	rec, err := arrow.NewRecord(schema, []arrow.Array{times.Array(), values.Array(), names.Array()})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	assert.Equal(t, schema, rec.Schema(), fmt.Sprintf("expected schema %v got %v", schema, rec.Schema()))
+	assert.Equal(t, 20, rec.NumRows(), fmt.Sprintf("expected %d rows got %d", 20, rec.NumRows()))
+	assert.Equal(t, 3, rec.NumCols(), fmt.Sprintf("expected %d columns got %d", 3, rec.NumCols()))
+
+	timeCol, ok := rec.Column(0).(*arrow.TimestampArray)
+	require.True(t, ok, fmt.Sprintf("expected timestamp column got %s", rec.Column(0).DataType()))
+	valueCol, ok := rec.Column(1).(*arrow.Float64Array)
+	require.True(t, ok, fmt.Sprintf("expected float64 column got %s", rec.Column(1).DataType()))
+	nameCol, ok := rec.Column(2).(*arrow.StringArray)
+	require.True(t, ok, fmt.Sprintf("expected string column got %s", rec.Column(2).DataType()))
+
+	assert.Equal(t, 0, timeCol.NullN(), fmt.Sprintf("expected no null times got %d", timeCol.NullN()))
+	assert.Equal(t, 7, valueCol.NullN(), fmt.Sprintf("expected %d null values got %d", 7, valueCol.NullN()))
+	for i := 0; i < rec.NumRows(); i++ {
+		assert.Equal(t, int64(1600000000+i)*1e9, timeCol.Value(i), fmt.Sprintf("unexpected time at row %d", i))
+		assert.False(t, timeCol.IsNull(i), fmt.Sprintf("expected valid time at row %d", i))
+		assert.Equal(t, i%3 == 0, valueCol.IsNull(i), fmt.Sprintf("unexpected value validity at row %d", i))
+		if !valueCol.IsNull(i) {
+			assert.Equal(t, float64(i), valueCol.Value(i), fmt.Sprintf("unexpected value at row %d", i))
+		}
+		assert.Equal(t, fmt.Sprintf("sensor%d", i%4), nameCol.Value(i), fmt.Sprintf("unexpected name at row %d", i))
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mainflux/mainflux/readers"
+)
+
+const (
+	defWindow    = 20
+	defThreshold = 0.5
+	defCooldown  = 30 * time.Second
+)
+
+type state int
+
+const (
+	// Queries are passed to the repository.
+	closed state = iota
+	// Queries fail without reaching the repository.
+	open
+	// A single query probes whether the repository recovered.
+	halfOpen
+)
+
+// Config defines when the circuit breaker trips and for how long.
+type Config struct {
+	// Window is the number of the most recent queries error rate is
+	// calculated over. Breaker doesn't trip before that many queries
+	// are done. Defaults to 20.
+	Window int
+
+	// Threshold is the rate of failed queries within the window, from 0
+	// to 1, which trips the breaker. Defaults to 0.5.
+	Threshold float64
+
+	// Cooldown is the time queries fail for once the breaker trips,
+	// before a query probes the repository again. Defaults to 30s.
+	Cooldown time.Duration
+
+	// Failure checks whether the query error indicates repository
+	// failure. If not set, every error is a failure, except for invalid
+	// page metadata and missing messages or tables.
+	Failure func(error) bool
+}
+
+var _ readers.MessageRepository = (*repositoryMiddleware)(nil)
+
+type repositoryMiddleware struct {
+	mu       sync.Mutex
+	cfg      Config
+	state    state
+	outcomes []bool
+	next     int
+	count    int
+	failures int
+	openedAt time.Time
+	probing  bool
+	repo     readers.MessageRepository
+}
+
+// RepositoryMiddleware wraps message repository with circuit breaker. Once
+// the rate of failed queries reaches the configured threshold, queries fail
+// with ErrServiceUnavailable for the cooldown, without reaching the
+// repository. After the cooldown, a single query probes the repository,
+// closing the breaker if it succeeds and tripping it again otherwise.
+func RepositoryMiddleware(repo readers.MessageRepository, cfg Config) readers.MessageRepository {
+	if cfg.Window <= 0 {
+		cfg.Window = defWindow
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defCooldown
+	}
+	if cfg.Failure == nil {
+		cfg.Failure = failure
+	}
+
+	return &repositoryMiddleware{
+		cfg:      cfg,
+		outcomes: make([]bool, cfg.Window),
+		repo:     repo,
+	}
+}
+
+// failure is the default failure check. Errors caused by the request
+// itself would be returned by the healthy repository as well.
+func failure(err error) bool {
+	switch {
+	case readers.InvalidRequest(err),
+		errors.Is(err, readers.ErrNotFound),
+		errors.Is(err, readers.ErrTableNotFound):
+		return false
+	default:
+		return true
+	}
+}
+
+func (rm *repositoryMiddleware) ReadAll(chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	probe, ok := rm.allow()
+	if !ok {
+		return readers.MessagesPage{}, readers.ErrServiceUnavailable
+	}
+
+	page, err := rm.repo.ReadAll(chanID, rpm)
+	rm.record(probe, err)
+
+	return page, err
+}
+
+// allow checks whether the query may reach the repository, and whether
+// it's the query probing the repository after the cooldown.
+func (rm *repositoryMiddleware) allow() (probe, ok bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.state == open {
+		if time.Since(rm.openedAt) < rm.cfg.Cooldown {
+			return false, false
+		}
+		rm.state = halfOpen
+	}
+	if rm.state == halfOpen {
+		if rm.probing {
+			return false, false
+		}
+		rm.probing = true
+		return true, true
+	}
+
+	return false, true
+}
+
+// record updates the breaker state with the query outcome.
+func (rm *repositoryMiddleware) record(probe bool, err error) {
+	failed := err != nil && rm.cfg.Failure(err)
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if probe {
+		rm.probing = false
+		if failed {
+			rm.trip()
+			return
+		}
+		rm.reset()
+		return
+	}
+	// Queries started before the breaker tripped don't affect it.
+	if rm.state != closed {
+		return
+	}
+
+	if rm.count == len(rm.outcomes) {
+		if rm.outcomes[rm.next] {
+			rm.failures--
+		}
+	} else {
+		rm.count++
+	}
+	rm.outcomes[rm.next] = failed
+	if failed {
+		rm.failures++
+	}
+	rm.next = (rm.next + 1) % len(rm.outcomes)
+
+	if rm.count == len(rm.outcomes) && float64(rm.failures)/float64(rm.count) >= rm.cfg.Threshold {
+		rm.trip()
+	}
+}
+
+func (rm *repositoryMiddleware) trip() {
+	rm.state = open
+	rm.openedAt = time.Now()
+}
+
+func (rm *repositoryMiddleware) reset() {
+	rm.state = closed
+	rm.outcomes = make([]bool, len(rm.outcomes))
+	rm.next, rm.count, rm.failures = 0, 0, 0
+}
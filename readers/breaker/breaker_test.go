@@ -0,0 +1,189 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package breaker_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	chanID   = "1"
+	window   = 4
+	cooldown = 50 * time.Millisecond
+)
+
+var errQuery = errors.New("query failed")
+
+// flakyRepository fails while failing is set, and counts queries
+// which reached it.
+type flakyRepository struct {
+	failing int32
+	calls   int32
+	delay   time.Duration
+}
+
+func (fr *flakyRepository) ReadAll(string, readers.PageMetadata) (readers.MessagesPage, error) {
+	atomic.AddInt32(&fr.calls, 1)
+	time.Sleep(fr.delay)
+	if atomic.LoadInt32(&fr.failing) == 1 {
+		return readers.MessagesPage{}, errQuery
+	}
+	return readers.MessagesPage{Total: 1}, nil
+}
+
+func (fr *flakyRepository) fail(failing bool) {
+	var v int32
+	if failing {
+		v = 1
+	}
+	atomic.StoreInt32(&fr.failing, v)
+}
+
+func (fr *flakyRepository) reached() int {
+	return int(atomic.SwapInt32(&fr.calls, 0))
+}
+
+func TestReadAll(t *testing.T) {
+	repo := &flakyRepository{}
+	br := breaker.RepositoryMiddleware(repo, breaker.Config{
+		Window:    window,
+		Threshold: 0.5,
+		Cooldown:  cooldown,
+	})
+
+	cases := []struct {
+		desc    string
+		failing bool
+		wait    time.Duration
+		err     error
+		reached int
+	}{
+		{desc: "read from closed breaker", failing: false, err: nil, reached: 1},
+		{desc: "read failure from closed breaker", failing: true, err: errQuery, reached: 1},
+		{desc: "read another success from closed breaker", failing: false, err: nil, reached: 1},
+		{desc: "read failure from closed breaker tripping it", failing: true, err: errQuery, reached: 1},
+		{desc: "read from open breaker", failing: false, err: readers.ErrServiceUnavailable, reached: 0},
+		{desc: "read failing probe from half-open breaker", failing: true, wait: cooldown, err: errQuery, reached: 1},
+		{desc: "read from re-opened breaker", failing: false, err: readers.ErrServiceUnavailable, reached: 0},
+		{desc: "read successful probe from half-open breaker", failing: false, wait: cooldown, err: nil, reached: 1},
+		{desc: "read from recovered breaker", failing: false, err: nil, reached: 1},
+		{desc: "read failure from recovered breaker", failing: true, err: errQuery, reached: 1},
+		{desc: "read from recovered breaker after single failure", failing: false, err: nil, reached: 1},
+	}
+
+	for _, tc := range cases {
+		time.Sleep(tc.wait)
+		repo.fail(tc.failing)
+		_, err := br.ReadAll(chanID, readers.PageMetadata{})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s, got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.reached, repo.reached(), fmt.Sprintf("%s: unexpected number of repository queries", tc.desc))
+	}
+}
+
+func TestReadAllFailureFilter(t *testing.T) {
+	repo := &flakyRepository{}
+	repo.fail(true)
+	br := breaker.RepositoryMiddleware(repo, breaker.Config{
+		Window:   window,
+		Cooldown: cooldown,
+		Failure:  func(err error) bool { return !errors.Contains(err, errQuery) },
+	})
+
+	for i := 0; i < 2*window; i++ {
+		_, err := br.ReadAll(chanID, readers.PageMetadata{})
+		assert.True(t, errors.Contains(err, errQuery), fmt.Sprintf("expected error %s, got %s", errQuery, err))
+	}
+	assert.Equal(t, 2*window, repo.reached(), "ignored errors tripped the breaker")
+}
+
+// errRepository always fails with the given error.
+type errRepository struct {
+	err   error
+	calls int
+}
+
+func (er *errRepository) ReadAll(string, readers.PageMetadata) (readers.MessagesPage, error) {
+	er.calls++
+	return readers.MessagesPage{}, er.err
+}
+
+func TestReadAllDefaultFailure(t *testing.T) {
+	cases := map[string]struct {
+		err     error
+		reached int
+	}{
+		"read with invalid page metadata": {
+			err:     readers.ErrInvalidTimeRange,
+			reached: 2 * window,
+		},
+		"read from missing table": {
+			err:     readers.ErrTableNotFound,
+			reached: 2 * window,
+		},
+		"read missing message": {
+			err:     readers.ErrNotFound,
+			reached: 2 * window,
+		},
+		"read with repository failure": {
+			err:     errQuery,
+			reached: window,
+		},
+	}
+
+	for desc, tc := range cases {
+		repo := &errRepository{err: tc.err}
+		br := breaker.RepositoryMiddleware(repo, breaker.Config{
+			Window:   window,
+			Cooldown: time.Minute,
+		})
+		for i := 0; i < 2*window; i++ {
+			br.ReadAll(chanID, readers.PageMetadata{})
+		}
+		assert.Equal(t, tc.reached, repo.calls, fmt.Sprintf("%s: expected %d repository queries got %d", desc, tc.reached, repo.calls))
+	}
+}
+
+func TestReadAllSingleProbe(t *testing.T) {
+	repo := &flakyRepository{}
+	br := breaker.RepositoryMiddleware(repo, breaker.Config{
+		Window:   window,
+		Cooldown: cooldown,
+	})
+
+	repo.fail(true)
+	for i := 0; i < window; i++ {
+		br.ReadAll(chanID, readers.PageMetadata{})
+	}
+	repo.reached()
+
+	repo.fail(false)
+	repo.delay = cooldown
+	time.Sleep(cooldown)
+
+	var wg sync.WaitGroup
+	var unavailable int32
+	n := 10
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := br.ReadAll(chanID, readers.PageMetadata{}); errors.Contains(err, readers.ErrServiceUnavailable) {
+				atomic.AddInt32(&unavailable, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, repo.reached(), "expected a single probe to reach half-open breaker repository")
+	assert.Equal(t, int32(n-1), unavailable, "expected queries concurrent to the probe to be rejected")
+}
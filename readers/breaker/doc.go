@@ -0,0 +1,6 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package breaker contains middlewares that will stop querying message
+// repository while it keeps failing.
+package breaker
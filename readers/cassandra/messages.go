@@ -36,6 +36,9 @@ func New(session *gocql.Session) readers.MessageRepository {
 }
 
 func (cr cassandraRepository) ReadAll(chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	if err := rpm.Validate(); err != nil {
+		return readers.MessagesPage{}, err
+	}
 	if rpm.Format == "" {
 		rpm.Format = defTable
 	}
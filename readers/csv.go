@@ -0,0 +1,94 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package readers
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+)
+
+// csvHeader lists the columns of the exported CSV messages.
+var csvHeader = []string{
+	"time",
+	"channel",
+	"publisher",
+	"subtopic",
+	"protocol",
+	"name",
+	"unit",
+	"value",
+	"string_value",
+	"bool_value",
+	"data_value",
+	"sum",
+	"update_time",
+}
+
+// WriteCSV writes header row followed by a row per page message to the
+// given writer. Columns of the values message doesn't have are left blank.
+// Only SenML messages are supported.
+func WriteCSV(w io.Writer, page MessagesPage) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, m := range page.Messages {
+		msg, ok := m.(senml.Message)
+		if !ok {
+			return ErrUnsupportedMessage
+		}
+		if err := cw.Write(csvRecord(msg)); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvRecord(msg senml.Message) []string {
+	rec := []string{
+		formatFloat(msg.Time),
+		msg.Channel,
+		msg.Publisher,
+		msg.Subtopic,
+		msg.Protocol,
+		msg.Name,
+		msg.Unit,
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+	}
+	if msg.Value != nil {
+		rec[7] = formatFloat(*msg.Value)
+	}
+	if msg.StringValue != nil {
+		rec[8] = *msg.StringValue
+	}
+	if msg.BoolValue != nil {
+		rec[9] = strconv.FormatBool(*msg.BoolValue)
+	}
+	if msg.DataValue != nil {
+		rec[10] = *msg.DataValue
+	}
+	if msg.Sum != nil {
+		rec[11] = formatFloat(*msg.Sum)
+	}
+	if msg.UpdateTime != 0 {
+		rec[12] = formatFloat(msg.UpdateTime)
+	}
+
+	return rec
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
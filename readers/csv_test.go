@@ -0,0 +1,74 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package readers_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chanID = "50e6b371-60ff-45cf-bb52-8200e7cde536"
+	pubID  = "3d2c9e6d-6c4f-4b5c-9f43-1c7d3a0fa5e2"
+)
+
+var header = []string{"time", "channel", "publisher", "subtopic", "protocol", "name", "unit", "value", "string_value", "bool_value", "data_value", "sum", "update_time"}
+
+func TestWriteCSV(t *testing.T) {
+	val := 21.5
+	sum := 120.0
+	boolVal := true
+	strVal := "on"
+	dataVal := "base64"
+
+	cases := map[string]struct {
+		messages []readers.Message
+		rows     [][]string
+		err      error
+	}{
+		"write empty page": {
+			messages: []readers.Message{},
+			rows:     [][]string{header},
+		},
+		"write messages with different values": {
+			messages: []readers.Message{
+				senml.Message{Channel: chanID, Publisher: pubID, Subtopic: "room/1", Protocol: "mqtt", Name: "temp", Unit: "C", Time: 1600000000.5, Value: &val, Sum: &sum},
+				senml.Message{Channel: chanID, Publisher: pubID, Protocol: "http", Name: "switch", Time: 1600000001, BoolValue: &boolVal},
+				senml.Message{Channel: chanID, Publisher: pubID, Protocol: "coap", Name: "state", Time: 1600000002, StringValue: &strVal, UpdateTime: 1600000003},
+				senml.Message{Channel: chanID, Publisher: pubID, Protocol: "mqtt", Name: "blob", Time: 1600000004, DataValue: &dataVal},
+			},
+			rows: [][]string{
+				header,
+				{"1600000000.5", chanID, pubID, "room/1", "mqtt", "temp", "C", "21.5", "", "", "", "120", ""},
+				{"1600000001", chanID, pubID, "", "http", "switch", "", "", "", "true", "", "", ""},
+				{"1600000002", chanID, pubID, "", "coap", "state", "", "", "on", "", "", "", "1600000003"},
+				{"1600000004", chanID, pubID, "", "mqtt", "blob", "", "", "", "", "base64", "", ""},
+			},
+		},
+		"write message with unsupported type": {
+			messages: []readers.Message{map[string]interface{}{"channel": chanID}},
+			err:      readers.ErrUnsupportedMessage,
+		},
+	}
+
+	for desc, tc := range cases {
+		buf := &bytes.Buffer{}
+		err := readers.WriteCSV(buf, readers.MessagesPage{Messages: tc.messages})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+
+		rows, err := csv.NewReader(buf).ReadAll()
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		assert.Equal(t, tc.rows, rows, fmt.Sprintf("%s: expected %v got %v", desc, tc.rows, rows))
+	}
+}
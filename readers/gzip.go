@@ -0,0 +1,22 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package readers
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WriteGzip writes export to w compressed with gzip. Compressed stream is
+// flushed and closed once the export is written, while w is left open, so
+// that the caller can keep writing to it or close it.
+func WriteGzip(w io.Writer, export func(io.Writer) error) error {
+	gz := gzip.NewWriter(w)
+	if err := export(gz); err != nil {
+		gz.Close()
+		return err
+	}
+
+	return gz.Close()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package readers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closeRecorder records whether it was closed.
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (cr *closeRecorder) Close() error {
+	cr.closed = true
+	return nil
+}
+
+func TestWriteGzip(t *testing.T) {
+	val := 21.5
+	page := readers.MessagesPage{
+		Messages: []readers.Message{
+			senml.Message{Channel: chanID, Publisher: pubID, Protocol: "mqtt", Name: "temp", Time: 1600000000, Value: &val},
+			senml.Message{Channel: chanID, Publisher: pubID, Protocol: "mqtt", Name: "temp", Time: 1600000001, Value: &val},
+		},
+	}
+	var uncompressed bytes.Buffer
+	err := readers.WriteCSV(&uncompressed, page)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		page readers.MessagesPage
+		data []byte
+		err  error
+	}{
+		"write compressed page": {
+			page: page,
+			data: uncompressed.Bytes(),
+		},
+		"write compressed page with unsupported message": {
+			page: readers.MessagesPage{Messages: []readers.Message{map[string]interface{}{"channel": chanID}}},
+			err:  readers.ErrUnsupportedMessage,
+		},
+	}
+
+	for desc, tc := range cases {
+		w := &closeRecorder{}
+		err := readers.WriteGzip(w, func(gw io.Writer) error {
+			return readers.WriteCSV(gw, tc.page)
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", desc, tc.err, err))
+		assert.False(t, w.closed, fmt.Sprintf("%s: expected underlying writer to be left open", desc))
+		if tc.err != nil {
+			continue
+		}
+
+		gr, err := gzip.NewReader(&w.Buffer)
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		data, err := ioutil.ReadAll(gr)
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		assert.Equal(t, tc.data, data, fmt.Sprintf("%s: expected %s got %s", desc, tc.data, data))
+	}
+}
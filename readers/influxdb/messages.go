@@ -41,6 +41,9 @@ func New(client influxdata.Client, database string) readers.MessageRepository {
 }
 
 func (repo *influxRepository) ReadAll(chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	if err := rpm.Validate(); err != nil {
+		return readers.MessagesPage{}, err
+	}
 	if rpm.Format == "" {
 		rpm.Format = defMeasurement
 	}
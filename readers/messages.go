@@ -3,10 +3,219 @@
 
 package readers
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
 
-// ErrNotFound indicates that requested entity doesn't exist.
-var ErrNotFound = errors.New("entity not found")
+const (
+	// AscDirection sorts messages from the oldest to the newest.
+	AscDirection = "asc"
+	// DescDirection sorts messages from the newest to the oldest.
+	DescDirection = "desc"
+)
+
+const (
+	// NullsFirst sorts messages without the sorted field before the others.
+	NullsFirst = "first"
+	// NullsLast sorts messages without the sorted field after the others.
+	NullsLast = "last"
+)
+
+const (
+	// EqualKey represents the equal comparison operator key.
+	EqualKey = "eq"
+	// GreaterThanKey represents the greater-than comparison operator key.
+	GreaterThanKey = "gt"
+	// GreaterThanEqualKey represents the greater-than-or-equal comparison operator key.
+	GreaterThanEqualKey = "gte"
+	// LowerThanKey represents the lower-than comparison operator key.
+	LowerThanKey = "lt"
+	// LowerThanEqualKey represents the lower-than-or-equal comparison operator key.
+	LowerThanEqualKey = "lte"
+	// NotEqualKey represents the not-equal comparison operator key. It applies
+	// to string values as well. Messages without the compared value are not
+	// selected, since absent value is neither equal nor not equal to any value.
+	NotEqualKey = "neq"
+)
+
+const (
+	// ExactCount counts messages precisely.
+	ExactCount = "exact"
+	// EstimateCount estimates number of messages using database statistics.
+	EstimateCount = "estimate"
+)
+
+const (
+	// PositiveSign selects messages with value greater than zero.
+	PositiveSign = "positive"
+	// NegativeSign selects messages with value lower than zero.
+	NegativeSign = "negative"
+	// ZeroSign selects messages with value equal to zero.
+	ZeroSign = "zero"
+)
+
+const (
+	// AvgAggregation calculates average of message values.
+	AvgAggregation = "avg"
+	// MinAggregation calculates minimum of message values.
+	MinAggregation = "min"
+	// MaxAggregation calculates maximum of message values.
+	MaxAggregation = "max"
+	// SumAggregation calculates sum of message values.
+	SumAggregation = "sum"
+	// CountAggregation counts messages with value.
+	CountAggregation = "count"
+)
+
+var (
+	// ErrNotFound indicates that requested entity doesn't exist.
+	ErrNotFound = errors.New("entity not found")
+
+	// ErrInvalidFormat indicates that requested message format is not supported.
+	ErrInvalidFormat = errors.New("invalid message format")
+
+	// ErrInvalidPageToken indicates malformed page token, or page token
+	// used with the page sorted by a column other than message time.
+	ErrInvalidPageToken = errors.New("invalid page token")
+
+	// ErrTableNotFound indicates that table of the requested message
+	// format doesn't exist.
+	ErrTableNotFound = errors.New("message table not found")
+
+	// ErrInvalidDirection indicates that requested sort direction is not supported.
+	ErrInvalidDirection = errors.New("invalid sort direction")
+
+	// ErrInvalidSort indicates that messages can't be sorted by requested field.
+	ErrInvalidSort = errors.New("invalid sort field")
+
+	// ErrInvalidNullsOrder indicates that requested placement of
+	// messages without the sorted field is not supported.
+	ErrInvalidNullsOrder = errors.New("invalid nulls order")
+
+	// ErrInvalidComparator indicates that requested value comparator is not supported.
+	ErrInvalidComparator = errors.New("invalid value comparator")
+
+	// ErrInvalidAggregation indicates that requested aggregation is not supported.
+	ErrInvalidAggregation = errors.New("invalid aggregation")
+
+	// ErrInvalidInterval indicates that requested time interval is not valid.
+	ErrInvalidInterval = errors.New("invalid time interval")
+
+	// ErrInvalidTimezone indicates that requested time zone is not
+	// a known IANA time zone name.
+	ErrInvalidTimezone = errors.New("invalid time zone")
+
+	// ErrInvalidTimeRange indicates that lower time bound is after
+	// the upper one.
+	ErrInvalidTimeRange = errors.New("invalid time range")
+
+	// ErrInvalidValueRange indicates that lower value bound is greater
+	// than the upper one.
+	ErrInvalidValueRange = errors.New("invalid value range")
+
+	// ErrInvalidWindow indicates invalid size of the aggregation window.
+	ErrInvalidWindow = errors.New("invalid aggregation window")
+
+	// ErrInvalidPercentile indicates percentile out of [0, 1] range.
+	ErrInvalidPercentile = errors.New("invalid percentile")
+
+	// ErrInvalidColumn indicates that requested message column doesn't exist.
+	ErrInvalidColumn = errors.New("invalid message column")
+
+	// ErrInvalidCountMode indicates that requested count mode is not supported.
+	ErrInvalidCountMode = errors.New("invalid count mode")
+
+	// ErrUnfilteredDelete indicates attempt to delete all the channel
+	// messages without explicitly forcing it.
+	ErrUnfilteredDelete = errors.New("deleting all messages must be forced")
+
+	// ErrQueryTimeout indicates that query was aborted since it
+	// took longer than allowed.
+	ErrQueryTimeout = errors.New("query timed out")
+
+	// ErrUnsupportedMessage indicates that message can't be exported
+	// in requested format.
+	ErrUnsupportedMessage = errors.New("unsupported message type")
+
+	// ErrInvalidPayloadFilter indicates that payload filter is not
+	// a JSON object.
+	ErrInvalidPayloadFilter = errors.New("invalid payload filter")
+
+	// ErrInvalidValueSign indicates that value sign is not supported.
+	ErrInvalidValueSign = errors.New("invalid value sign")
+
+	// ErrInvalidLast indicates that relative time window is negative.
+	ErrInvalidLast = errors.New("invalid relative time window")
+
+	// ErrTooManyRequests indicates that messages are not read, since
+	// too many of them are being read at once.
+	ErrTooManyRequests = errors.New("too many concurrent reads")
+
+	// ErrInvalidRename indicates that message fields are renamed to
+	// empty or duplicate names.
+	ErrInvalidRename = errors.New("invalid field renaming")
+
+	// ErrServiceUnavailable indicates that message repository isn't
+	// queried, since it failed too often recently.
+	ErrServiceUnavailable = errors.New("message repository is unavailable")
+
+	// ErrInvalidUnit indicates that values are normalized to unknown unit.
+	ErrInvalidUnit = errors.New("invalid normalization unit")
+
+	// ErrInvalidMessageID indicates malformed ID of the message to delete.
+	ErrInvalidMessageID = errors.New("invalid message ID")
+)
+
+// invalidRequestErrors are returned if messages can't be read using the
+// requested page metadata, regardless of the repository state.
+var invalidRequestErrors = []error{
+	ErrInvalidFormat,
+	ErrInvalidPageToken,
+	ErrInvalidDirection,
+	ErrInvalidSort,
+	ErrInvalidNullsOrder,
+	ErrInvalidComparator,
+	ErrInvalidAggregation,
+	ErrInvalidInterval,
+	ErrInvalidTimezone,
+	ErrInvalidTimeRange,
+	ErrInvalidValueRange,
+	ErrInvalidWindow,
+	ErrInvalidPercentile,
+	ErrInvalidColumn,
+	ErrInvalidCountMode,
+	ErrUnfilteredDelete,
+	ErrUnsupportedMessage,
+	ErrInvalidPayloadFilter,
+	ErrInvalidValueSign,
+	ErrInvalidLast,
+	ErrInvalidRename,
+	ErrInvalidUnit,
+	ErrInvalidMessageID,
+}
+
+// InvalidRequest checks whether the error is caused by invalid page
+// metadata, rather than by the repository failing to read messages.
+func InvalidRequest(err error) bool {
+	for _, e := range invalidRequestErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PayloadComparison compares numeric payload field at the given path of
+// nested keys to the value, using one of the comparator keys. Messages
+// without numeric field at the path are not matched.
+type PayloadComparison struct {
+	Path       []string `json:"path"`
+	Comparator string   `json:"comparator,omitempty"`
+	Value      float64  `json:"value"`
+}
 
 // MessageRepository specifies message reader API.
 type MessageRepository interface {
@@ -18,27 +227,202 @@ type MessageRepository interface {
 // Message represents any message format.
 type Message interface{}
 
+// MessageCursor iterates over messages read one by one, without loading
+// all of them into memory.
+type MessageCursor interface {
+	// Next advances cursor to the next message. It returns false when
+	// there are no more messages or an error occurred.
+	Next() bool
+
+	// Message returns the message cursor points to.
+	Message() Message
+
+	// Err returns error occurred during iteration, if any.
+	Err() error
+
+	// Close releases resources held by the cursor.
+	Close() error
+}
+
 // MessagesPage contains page related metadata as well as list of messages that
 // belong to this page.
 type MessagesPage struct {
 	PageMetadata
 	Total    uint64
 	Messages []Message
+	// Cursor is the time of the last message in the page. It can be used
+	// as Before (or After, for ascending order) cursor to read the next page.
+	Cursor float64
+	// Estimated indicates that Total is an approximate number of messages.
+	Estimated bool
+	// NextPageToken is an opaque token of the next page, which is passed
+	// as PageToken to read it. It is empty if there are no more messages.
+	NextPageToken string
 }
 
 // PageMetadata represents the parameters used to create database queries
 type PageMetadata struct {
-	Offset      uint64  `json:"offset,omitempty"`
-	Limit       uint64  `json:"limit,omitempty"`
-	Subtopic    string  `json:"subtopic,omitempty"`
-	Publisher   string  `json:"publisher,omitempty"`
-	Protocol    string  `json:"protocol,omitempty"`
-	Name        string  `json:"name,omitempty"`
-	Value       float64 `json:"v,omitempty"`
-	BoolValue   bool    `json:"vb,omitempty"`
-	StringValue string  `json:"vs,omitempty"`
-	DataValue   string  `json:"vd,omitempty"`
-	From        float64 `json:"from,omitempty"`
-	To          float64 `json:"to,omitempty"`
-	Format      string  `json:"format,omitempty"`
+	Offset      uint64   `json:"offset,omitempty"`
+	Limit       uint64   `json:"limit,omitempty"`
+	Subtopic    string   `json:"subtopic,omitempty"`
+	Publisher   string   `json:"publisher,omitempty"`
+	Protocol    string   `json:"protocol,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Value       float64  `json:"v,omitempty"`
+	BoolValue   bool     `json:"vb,omitempty"`
+	StringValue string   `json:"vs,omitempty"`
+	DataValue   string   `json:"vd,omitempty"`
+	From        float64  `json:"from,omitempty"`
+	To          float64  `json:"to,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Direction   string   `json:"dir,omitempty"`
+	Sort        string   `json:"sort,omitempty"`
+	NullsOrder  string   `json:"nulls_order,omitempty"`
+	Comparator  string   `json:"comparator,omitempty"`
+	ValueFrom   *float64 `json:"value_from,omitempty"`
+	ValueTo     *float64 `json:"value_to,omitempty"`
+	ValueSign   string   `json:"value_sign,omitempty"`
+	Aggregation string   `json:"aggregation,omitempty"`
+	Interval    string   `json:"interval,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"`
+	Before      float64  `json:"before,omitempty"`
+	After       float64  `json:"after,omitempty"`
+	Subtopics   []string `json:"subtopics,omitempty"`
+	Publishers  []string `json:"publishers,omitempty"`
+	Protocols   []string `json:"protocols,omitempty"`
+	// PayloadFilters matches JSON messages whose payload fields
+	// equal the given values.
+	PayloadFilters map[string]interface{} `json:"payload,omitempty"`
+	// PayloadContains matches JSON messages whose payload contains
+	// the given JSON object.
+	PayloadContains json.RawMessage `json:"payload_contains,omitempty"`
+	CountMode       string          `json:"count_mode,omitempty"`
+	Unit            string          `json:"unit,omitempty"`
+	SumFrom         float64         `json:"sum_from,omitempty"`
+	SumTo           float64         `json:"sum_to,omitempty"`
+	SubtopicPrefix  string          `json:"subtopic_prefix,omitempty"`
+	// StringValueContains selects SenML messages whose string value
+	// contains the given text.
+	StringValueContains string `json:"vs_contains,omitempty"`
+	// PayloadComparisons matches JSON messages whose numeric payload
+	// fields compare to the given values.
+	PayloadComparisons []PayloadComparison `json:"payload_comparisons,omitempty"`
+	// NameCaseInsensitive makes the name filter ignore letter case.
+	NameCaseInsensitive bool `json:"name_case_insensitive,omitempty"`
+	// RawPayload returns JSON payload as it is stored, with nested fields
+	// flattened into composite keys, instead of parsing it into nested maps.
+	RawPayload bool `json:"raw_payload,omitempty"`
+	// IngestTime returns SenML messages along with the time they were
+	// stored at, which doesn't depend on the device clock.
+	IngestTime bool `json:"ingest_time,omitempty"`
+	// Rename maps names of the returned message fields to the names they
+	// are returned with. Fields which are not listed keep their names.
+	Rename map[string]string `json:"rename,omitempty"`
+	// NormalizeUnit converts values of the SenML messages to the given
+	// unit, where a conversion is known. Filters and sorting still apply
+	// to the stored values.
+	NormalizeUnit string `json:"normalize_unit,omitempty"`
+	// Columns limits message fields read from the database. Fields which
+	// are not listed are left empty. If not set, all the fields are read.
+	Columns []string `json:"columns,omitempty"`
+	// Dedup collapses messages of the same publisher and time into one.
+	Dedup bool `json:"dedup,omitempty"`
+	// HasStringValue, HasBoolValue and HasDataValue select only the
+	// messages carrying value of the corresponding kind.
+	HasStringValue bool `json:"has_string_value,omitempty"`
+	HasBoolValue   bool `json:"has_bool_value,omitempty"`
+	HasDataValue   bool `json:"has_data_value,omitempty"`
+	// DataValueNotEmpty selects only the SenML messages carrying non-empty
+	// data value.
+	DataValueNotEmpty bool `json:"data_value_not_empty,omitempty"`
+	// ExcludePublishers omits messages of the given publishers, on top
+	// of the other filters.
+	ExcludePublishers []string `json:"exclude_publishers,omitempty"`
+	// IncludeDeleted reads soft-deleted messages as well, in the
+	// repositories which support soft deletion.
+	IncludeDeleted bool `json:"include_deleted,omitempty"`
+	// Channels extends the read channel with the given channels, so
+	// that messages of all of them are read at once.
+	Channels []string `json:"channels,omitempty"`
+	// Last selects messages not older than the given duration, counted from
+	// the time the messages are read. It's ignored if From or To is set.
+	Last time.Duration `json:"last,omitempty"`
+	// ToInclusive makes the To time bound include messages of that time.
+	ToInclusive bool `json:"to_inclusive,omitempty"`
+	// UpdateTimeFrom and UpdateTimeTo select SenML messages by their
+	// update time, within [UpdateTimeFrom, UpdateTimeTo) range.
+	UpdateTimeFrom float64 `json:"update_time_from,omitempty"`
+	UpdateTimeTo   float64 `json:"update_time_to,omitempty"`
+	// PageToken continues reading past the page it was returned with.
+	// Messages are read in time order, which can't be changed.
+	PageToken string `json:"page_token,omitempty"`
+	// Force allows deleting all the channel messages at once.
+	Force bool `json:"force,omitempty"`
+}
+
+// Validate checks that page metadata fields are consistent, regardless of
+// the database messages are read from. Open ranges, whose bound is not set,
+// are valid.
+func (pm PageMetadata) Validate() error {
+	if pm.From != 0 && pm.To != 0 && pm.From > pm.To {
+		return ErrInvalidTimeRange
+	}
+	if pm.UpdateTimeFrom != 0 && pm.UpdateTimeTo != 0 && pm.UpdateTimeFrom > pm.UpdateTimeTo {
+		return ErrInvalidTimeRange
+	}
+	if pm.ValueFrom != nil && pm.ValueTo != nil && *pm.ValueFrom > *pm.ValueTo {
+		return ErrInvalidValueRange
+	}
+	if pm.SumFrom != 0 && pm.SumTo != 0 && pm.SumFrom > pm.SumTo {
+		return ErrInvalidValueRange
+	}
+	if !validComparator(pm.Comparator) {
+		return ErrInvalidComparator
+	}
+	for _, pc := range pm.PayloadComparisons {
+		if !validComparator(pc.Comparator) {
+			return ErrInvalidComparator
+		}
+	}
+	switch pm.Direction {
+	case "", AscDirection, DescDirection:
+	default:
+		return ErrInvalidDirection
+	}
+	switch pm.NullsOrder {
+	case "", NullsFirst, NullsLast:
+	default:
+		return ErrInvalidNullsOrder
+	}
+	switch pm.CountMode {
+	case "", ExactCount, EstimateCount:
+	default:
+		return ErrInvalidCountMode
+	}
+	switch pm.ValueSign {
+	case "", PositiveSign, NegativeSign, ZeroSign:
+	default:
+		return ErrInvalidValueSign
+	}
+	if pm.Last < 0 {
+		return ErrInvalidLast
+	}
+	names := map[string]bool{}
+	for _, name := range pm.Rename {
+		if name == "" || names[name] {
+			return ErrInvalidRename
+		}
+		names[name] = true
+	}
+
+	return nil
+}
+
+func validComparator(comparator string) bool {
+	switch comparator {
+	case "", EqualKey, GreaterThanKey, GreaterThanEqualKey, LowerThanKey, LowerThanEqualKey, NotEqualKey:
+		return true
+	default:
+		return false
+	}
 }
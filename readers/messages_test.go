@@ -0,0 +1,165 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package readers_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/readers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePageMetadata(t *testing.T) {
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		err      error
+	}{
+		"validate empty page metadata": {
+			pageMeta: readers.PageMetadata{},
+			err:      nil,
+		},
+		"validate page metadata with all the fields set": {
+			pageMeta: readers.PageMetadata{
+				Limit:          10,
+				From:           1,
+				To:             2,
+				UpdateTimeFrom: 1,
+				UpdateTimeTo:   2,
+				ValueFrom:      float(1),
+				ValueTo:        float(2),
+				SumFrom:        1,
+				SumTo:          2,
+				Comparator:     readers.GreaterThanEqualKey,
+				PayloadComparisons: []readers.PayloadComparison{
+					{Path: []string{"temp"}, Comparator: readers.LowerThanKey, Value: 1},
+				},
+				Direction:  readers.AscDirection,
+				NullsOrder: readers.NullsLast,
+				CountMode:  readers.EstimateCount,
+				ValueSign:  readers.PositiveSign,
+				Last:       time.Hour,
+			},
+			err: nil,
+		},
+		"validate page metadata with equal time bounds": {
+			pageMeta: readers.PageMetadata{From: 1, To: 1},
+			err:      nil,
+		},
+		"validate page metadata with open time range": {
+			pageMeta: readers.PageMetadata{From: 2},
+			err:      nil,
+		},
+		"validate page metadata with from after to": {
+			pageMeta: readers.PageMetadata{From: 2, To: 1},
+			err:      readers.ErrInvalidTimeRange,
+		},
+		"validate page metadata with update time from after to": {
+			pageMeta: readers.PageMetadata{UpdateTimeFrom: 2, UpdateTimeTo: 1},
+			err:      readers.ErrInvalidTimeRange,
+		},
+		"validate page metadata with value from greater than to": {
+			pageMeta: readers.PageMetadata{ValueFrom: float(2), ValueTo: float(1)},
+			err:      readers.ErrInvalidValueRange,
+		},
+		"validate page metadata with value from greater than zero to": {
+			pageMeta: readers.PageMetadata{ValueFrom: float(5), ValueTo: float(0)},
+			err:      readers.ErrInvalidValueRange,
+		},
+		"validate page metadata with zero value from": {
+			pageMeta: readers.PageMetadata{ValueFrom: float(0), ValueTo: float(1)},
+			err:      nil,
+		},
+		"validate page metadata with sum from greater than to": {
+			pageMeta: readers.PageMetadata{SumFrom: 2, SumTo: 1},
+			err:      readers.ErrInvalidValueRange,
+		},
+		"validate page metadata with unknown comparator": {
+			pageMeta: readers.PageMetadata{Comparator: "like"},
+			err:      readers.ErrInvalidComparator,
+		},
+		"validate page metadata with unknown payload comparator": {
+			pageMeta: readers.PageMetadata{
+				PayloadComparisons: []readers.PayloadComparison{{Path: []string{"temp"}, Comparator: "like"}},
+			},
+			err: readers.ErrInvalidComparator,
+		},
+		"validate page metadata with unknown direction": {
+			pageMeta: readers.PageMetadata{Direction: "up"},
+			err:      readers.ErrInvalidDirection,
+		},
+		"validate page metadata with unknown nulls order": {
+			pageMeta: readers.PageMetadata{NullsOrder: "middle"},
+			err:      readers.ErrInvalidNullsOrder,
+		},
+		"validate page metadata with field renamed to empty name": {
+			pageMeta: readers.PageMetadata{Rename: map[string]string{"time": ""}},
+			err:      readers.ErrInvalidRename,
+		},
+		"validate page metadata with fields renamed to the same name": {
+			pageMeta: readers.PageMetadata{Rename: map[string]string{"time": "t", "value": "t"}},
+			err:      readers.ErrInvalidRename,
+		},
+		"validate page metadata with unknown count mode": {
+			pageMeta: readers.PageMetadata{CountMode: "approximate"},
+			err:      readers.ErrInvalidCountMode,
+		},
+		"validate page metadata with unknown value sign": {
+			pageMeta: readers.PageMetadata{ValueSign: "nonzero"},
+			err:      readers.ErrInvalidValueSign,
+		},
+		"validate page metadata with negative relative time window": {
+			pageMeta: readers.PageMetadata{Last: -time.Hour},
+			err:      readers.ErrInvalidLast,
+		},
+	}
+
+	for desc, tc := range cases {
+		err := tc.pageMeta.Validate()
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+	}
+}
+
+func TestInvalidRequest(t *testing.T) {
+	cases := map[string]struct {
+		err     error
+		invalid bool
+	}{
+		"check invalid page metadata error": {
+			err:     readers.ErrInvalidTimeRange,
+			invalid: true,
+		},
+		"check wrapped invalid page metadata error": {
+			err:     fmt.Errorf("read failed: %w", readers.ErrInvalidFormat),
+			invalid: true,
+		},
+		"check invalid message ID error": {
+			err:     readers.ErrInvalidMessageID,
+			invalid: true,
+		},
+		"check repository failure": {
+			err:     errors.New("connection refused"),
+			invalid: false,
+		},
+		"check service unavailable error": {
+			err:     readers.ErrServiceUnavailable,
+			invalid: false,
+		},
+		"check nil error": {
+			err:     nil,
+			invalid: false,
+		},
+	}
+
+	for desc, tc := range cases {
+		invalid := readers.InvalidRequest(tc.err)
+		assert.Equal(t, tc.invalid, invalid, fmt.Sprintf("%s: expected %t got %t", desc, tc.invalid, invalid))
+	}
+}
+
+func float(v float64) *float64 {
+	return &v
+}
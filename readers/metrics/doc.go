@@ -0,0 +1,6 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package metrics contains middlewares that will expose message
+// repository query metrics to Prometheus.
+package metrics
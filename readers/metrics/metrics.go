@@ -0,0 +1,79 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/mainflux/mainflux/readers"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	subsystem = "message_repository"
+	readAllOp = "read_all"
+)
+
+var _ readers.MessageRepository = (*repositoryMiddleware)(nil)
+
+type repositoryMiddleware struct {
+	latency *prometheus.HistogramVec
+	errors  *prometheus.CounterVec
+	rows    *prometheus.SummaryVec
+	repo    readers.MessageRepository
+}
+
+// RepositoryMiddleware instruments message repository by tracking query
+// latency, number of failed queries and number of returned messages per
+// method. Metrics are registered under the given namespace, so several
+// repositories can share the same registerer.
+func RepositoryMiddleware(repo readers.MessageRepository, reg prometheus.Registerer, namespace string) (readers.MessageRepository, error) {
+	rm := &repositoryMiddleware{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "query_latency_seconds",
+			Help:      "Duration of message repository queries in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "query_errors_total",
+			Help:      "Number of failed message repository queries.",
+		}, []string{"method"}),
+		rows: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "returned_messages",
+			Help:      "Number of messages returned by message repository queries.",
+		}, []string{"method"}),
+		repo: repo,
+	}
+
+	for _, c := range []prometheus.Collector{rm.latency, rm.errors, rm.rows} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return rm, nil
+}
+
+func (rm *repositoryMiddleware) ReadAll(chanID string, rpm readers.PageMetadata) (page readers.MessagesPage, err error) {
+	defer func(begin time.Time) {
+		rm.observe(readAllOp, begin, len(page.Messages), err)
+	}(time.Now())
+
+	return rm.repo.ReadAll(chanID, rpm)
+}
+
+func (rm *repositoryMiddleware) observe(method string, begin time.Time, rows int, err error) {
+	rm.latency.WithLabelValues(method).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		rm.errors.WithLabelValues(method).Inc()
+		return
+	}
+	rm.rows.WithLabelValues(method).Observe(float64(rows))
+}
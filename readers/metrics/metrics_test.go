@@ -0,0 +1,131 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/metrics"
+	"github.com/mainflux/mainflux/readers/mocks"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chanID    = "1"
+	namespace = "test"
+	msgsNum   = 20
+	limit     = 5
+)
+
+var (
+	errQuery = errors.New("query failed")
+
+	latencyMetric = fmt.Sprintf("%s_message_repository_query_latency_seconds", namespace)
+	errorsMetric  = fmt.Sprintf("%s_message_repository_query_errors_total", namespace)
+	rowsMetric    = fmt.Sprintf("%s_message_repository_returned_messages", namespace)
+)
+
+type failingRepository struct{}
+
+func (failingRepository) ReadAll(string, readers.PageMetadata) (readers.MessagesPage, error) {
+	return readers.MessagesPage{}, errQuery
+}
+
+func TestReadAll(t *testing.T) {
+	messages := []readers.Message{}
+	for i := 0; i < msgsNum; i++ {
+		messages = append(messages, senml.Message{Channel: chanID, Time: float64(i)})
+	}
+
+	reg := prometheus.NewRegistry()
+	repo, err := metrics.RepositoryMiddleware(mocks.NewMessageRepository(chanID, messages), reg, namespace)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		rows     int
+	}{
+		"read first page": {
+			pageMeta: readers.PageMetadata{Limit: limit},
+			rows:     limit,
+		},
+		"read last page": {
+			pageMeta: readers.PageMetadata{Offset: msgsNum - 2, Limit: limit},
+			rows:     2,
+		},
+		"read page out of range": {
+			pageMeta: readers.PageMetadata{Offset: msgsNum, Limit: limit},
+			rows:     0,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := repo.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.rows, len(page.Messages), fmt.Sprintf("%s: expected %d got %d", desc, tc.rows, len(page.Messages)))
+	}
+
+	families := gather(t, reg)
+
+	latency := families[latencyMetric].GetMetric()[0].GetHistogram()
+	assert.Equal(t, uint64(len(cases)), latency.GetSampleCount(), fmt.Sprintf("expected %d latency samples got %d", len(cases), latency.GetSampleCount()))
+	assert.True(t, latency.GetSampleSum() >= 0, fmt.Sprintf("expected non-negative latency got %f", latency.GetSampleSum()))
+
+	rows := families[rowsMetric].GetMetric()[0].GetSummary()
+	assert.Equal(t, uint64(len(cases)), rows.GetSampleCount(), fmt.Sprintf("expected %d row count samples got %d", len(cases), rows.GetSampleCount()))
+	assert.Equal(t, float64(limit+2), rows.GetSampleSum(), fmt.Sprintf("expected %d returned messages got %f", limit+2, rows.GetSampleSum()))
+
+	_, ok := families[errorsMetric]
+	assert.False(t, ok, fmt.Sprintf("expected no errors recorded got %v", families[errorsMetric]))
+}
+
+func TestReadAllError(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	repo, err := metrics.RepositoryMiddleware(failingRepository{}, reg, namespace)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	for i := 0; i < 2; i++ {
+		_, err := repo.ReadAll(chanID, readers.PageMetadata{Limit: limit})
+		assert.Equal(t, errQuery, err, fmt.Sprintf("expected %s got %s", errQuery, err))
+	}
+
+	families := gather(t, reg)
+
+	counter := families[errorsMetric].GetMetric()[0]
+	assert.Equal(t, "read_all", counter.GetLabel()[0].GetValue(), fmt.Sprintf("expected read_all method label got %s", counter.GetLabel()[0].GetValue()))
+	assert.Equal(t, float64(2), counter.GetCounter().GetValue(), fmt.Sprintf("expected 2 errors got %f", counter.GetCounter().GetValue()))
+
+	latency := families[latencyMetric].GetMetric()[0].GetHistogram()
+	assert.Equal(t, uint64(2), latency.GetSampleCount(), fmt.Sprintf("expected 2 latency samples got %d", latency.GetSampleCount()))
+
+	_, ok := families[rowsMetric]
+	assert.False(t, ok, fmt.Sprintf("expected no row counts recorded for failed queries got %v", families[rowsMetric]))
+}
+
+func TestRepositoryMiddlewareDuplicate(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, err := metrics.RepositoryMiddleware(failingRepository{}, reg, namespace)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	_, err = metrics.RepositoryMiddleware(failingRepository{}, reg, namespace)
+	assert.NotNil(t, err, "expected error registering the same metrics twice")
+}
+
+func gather(t *testing.T, reg *prometheus.Registry) map[string]*dto.MetricFamily {
+	mfs, err := reg.Gather()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	families := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+	return families
+}
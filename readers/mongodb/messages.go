@@ -38,6 +38,9 @@ func New(db *mongo.Database) readers.MessageRepository {
 }
 
 func (repo mongoRepository) ReadAll(chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	if err := rpm.Validate(); err != nil {
+		return readers.MessagesPage{}, err
+	}
 	if rpm.Format == "" {
 		rpm.Format = defCollection
 	}
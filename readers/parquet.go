@@ -0,0 +1,421 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package readers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+)
+
+// parquetRowGroupSize is the number of messages buffered before they
+// are written as a row group, which bounds the memory used by export.
+const parquetRowGroupSize = 10000
+
+// Physical types, repetitions and encodings of the Parquet format.
+const (
+	parquetBoolean   = 0
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage = 0
+	parquetUTF8     = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetColumn buffers values of a single column of the row group.
+// Values are PLAIN encoded as they are added, apart from booleans,
+// which are bit-packed once the row group is written.
+type parquetColumn struct {
+	name     string
+	typ      int32
+	optional bool
+	defined  []bool
+	bools    []bool
+	values   bytes.Buffer
+}
+
+func (pc *parquetColumn) addDouble(v *float64) {
+	if pc.define(v != nil) {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(*v))
+		pc.values.Write(b[:])
+	}
+}
+
+func (pc *parquetColumn) addString(v *string) {
+	if pc.define(v != nil) {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(len(*v)))
+		pc.values.Write(b[:])
+		pc.values.WriteString(*v)
+	}
+}
+
+func (pc *parquetColumn) addBool(v *bool) {
+	if pc.define(v != nil) {
+		pc.bools = append(pc.bools, *v)
+	}
+}
+
+// define records whether the value of the row is set, and reports
+// whether the value has to be encoded.
+func (pc *parquetColumn) define(ok bool) bool {
+	pc.defined = append(pc.defined, ok)
+	return ok
+}
+
+// page returns data page of the buffered values, preceded by the
+// definition levels of the optional column.
+func (pc *parquetColumn) page() []byte {
+	page := []byte{}
+	if pc.optional {
+		levels := encodeLevels(pc.defined)
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(len(levels)))
+		page = append(append(page, b[:]...), levels...)
+	}
+	if pc.typ == parquetBoolean {
+		packed := make([]byte, (len(pc.bools)+7)/8)
+		for i, v := range pc.bools {
+			if v {
+				packed[i/8] |= 1 << uint(i%8)
+			}
+		}
+		return append(page, packed...)
+	}
+
+	return append(page, pc.values.Bytes()...)
+}
+
+func (pc *parquetColumn) reset() {
+	pc.defined = pc.defined[:0]
+	pc.bools = pc.bools[:0]
+	pc.values.Reset()
+}
+
+// encodeLevels encodes definition levels of bit width 1 as runs of
+// the RLE/bit-packing hybrid encoding.
+func encodeLevels(defined []bool) []byte {
+	buf := &thriftBuffer{}
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		buf.varint(uint64(j-i) << 1)
+		if defined[i] {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		i = j
+	}
+
+	return buf.Bytes()
+}
+
+// parquetChunk locates the column chunk of the written row group.
+type parquetChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+	size   int64
+}
+
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []*parquetColumn
+	groups  []parquetRowGroup
+	rows    int64
+	total   int64
+}
+
+// WriteParquet writes messages received from the given channel until it's
+// closed to the given writer as Parquet file, so that exported messages can
+// be loaded by analytics tools. Messages are written in row groups as they
+// are received, with a column per SenML message field. Values message
+// doesn't have are written as nulls. Only SenML messages are supported,
+// and the rest of the channel messages are not received once writing fails.
+func WriteParquet(w io.Writer, ch <-chan Message) error {
+	pw := &parquetWriter{
+		w: w,
+		columns: []*parquetColumn{
+			{name: "time", typ: parquetDouble},
+			{name: "channel", typ: parquetByteArray},
+			{name: "publisher", typ: parquetByteArray},
+			{name: "subtopic", typ: parquetByteArray},
+			{name: "protocol", typ: parquetByteArray},
+			{name: "name", typ: parquetByteArray},
+			{name: "unit", typ: parquetByteArray},
+			{name: "value", typ: parquetDouble, optional: true},
+			{name: "string_value", typ: parquetByteArray, optional: true},
+			{name: "bool_value", typ: parquetBoolean, optional: true},
+			{name: "data_value", typ: parquetByteArray, optional: true},
+			{name: "sum", typ: parquetDouble, optional: true},
+			{name: "update_time", typ: parquetDouble, optional: true},
+		},
+	}
+	if err := pw.write(parquetMagic); err != nil {
+		return err
+	}
+
+	for m := range ch {
+		msg, ok := m.(senml.Message)
+		if !ok {
+			return ErrUnsupportedMessage
+		}
+		pw.add(msg)
+		if pw.rows == parquetRowGroupSize {
+			if err := pw.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := pw.flush(); err != nil {
+		return err
+	}
+
+	return pw.close()
+}
+
+func (pw *parquetWriter) add(msg senml.Message) {
+	var updateTime *float64
+	if msg.UpdateTime != 0 {
+		updateTime = &msg.UpdateTime
+	}
+
+	pw.columns[0].addDouble(&msg.Time)
+	pw.columns[1].addString(&msg.Channel)
+	pw.columns[2].addString(&msg.Publisher)
+	pw.columns[3].addString(&msg.Subtopic)
+	pw.columns[4].addString(&msg.Protocol)
+	pw.columns[5].addString(&msg.Name)
+	pw.columns[6].addString(&msg.Unit)
+	pw.columns[7].addDouble(msg.Value)
+	pw.columns[8].addString(msg.StringValue)
+	pw.columns[9].addBool(msg.BoolValue)
+	pw.columns[10].addString(msg.DataValue)
+	pw.columns[11].addDouble(msg.Sum)
+	pw.columns[12].addDouble(updateTime)
+	pw.rows++
+}
+
+// flush writes buffered messages as row group of a single data
+// page per column.
+func (pw *parquetWriter) flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+
+	rg := parquetRowGroup{rows: pw.rows}
+	for _, c := range pw.columns {
+		page := c.page()
+		hdr := &thriftBuffer{}
+		hdr.begin()
+		hdr.i32(1, parquetDataPage)
+		hdr.i32(2, int32(len(page)))
+		hdr.i32(3, int32(len(page)))
+		hdr.structField(5)
+		hdr.i32(1, int32(pw.rows))
+		hdr.i32(2, parquetPlain)
+		hdr.i32(3, parquetRLE)
+		hdr.i32(4, parquetRLE)
+		hdr.end()
+		hdr.end()
+
+		chunk := parquetChunk{
+			offset: pw.offset,
+			size:   int64(hdr.Len() + len(page)),
+			values: pw.rows,
+		}
+		if err := pw.write(hdr.Bytes()); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		rg.chunks = append(rg.chunks, chunk)
+		rg.size += chunk.size
+		c.reset()
+	}
+	pw.groups = append(pw.groups, rg)
+	pw.total += pw.rows
+	pw.rows = 0
+
+	return nil
+}
+
+// close writes file metadata footer, which describes the schema
+// and locates the written row groups.
+func (pw *parquetWriter) close() error {
+	md := &thriftBuffer{}
+	md.begin()
+	md.i32(1, 1)
+	md.list(2, thriftStruct, len(pw.columns)+1)
+	md.begin()
+	md.str(4, "schema")
+	md.i32(5, int32(len(pw.columns)))
+	md.end()
+	for _, c := range pw.columns {
+		md.begin()
+		md.i32(1, c.typ)
+		if c.optional {
+			md.i32(3, parquetOptional)
+		} else {
+			md.i32(3, parquetRequired)
+		}
+		md.str(4, c.name)
+		if c.typ == parquetByteArray {
+			md.i32(6, parquetUTF8)
+		}
+		md.end()
+	}
+	md.i64(3, pw.total)
+	md.list(4, thriftStruct, len(pw.groups))
+	for _, rg := range pw.groups {
+		md.begin()
+		md.list(1, thriftStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			c := pw.columns[i]
+			md.begin()
+			md.i64(2, chunk.offset)
+			md.structField(3)
+			md.i32(1, c.typ)
+			md.list(2, thriftI32, 2)
+			md.zigzag(parquetPlain)
+			md.zigzag(parquetRLE)
+			md.list(3, thriftBinary, 1)
+			md.binary(c.name)
+			md.i32(4, 0)
+			md.i64(5, chunk.values)
+			md.i64(6, chunk.size)
+			md.i64(7, chunk.size)
+			md.i64(9, chunk.offset)
+			md.end()
+			md.end()
+		}
+		md.i64(2, rg.size)
+		md.i64(3, rg.rows)
+		md.end()
+	}
+	md.str(6, "mainflux")
+	md.end()
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(md.Len()))
+	for _, b := range [][]byte{md.Bytes(), size[:], parquetMagic} {
+		if err := pw.write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+// Types of the Thrift compact protocol used by Parquet metadata.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftBuffer encodes Parquet metadata structures using the Thrift
+// compact protocol. Field IDs of every struct have to be increasing.
+type thriftBuffer struct {
+	bytes.Buffer
+	fields []int16
+}
+
+// begin starts struct, which is either list element or
+// the top-level struct.
+func (tb *thriftBuffer) begin() {
+	tb.fields = append(tb.fields, 0)
+}
+
+// end writes stop field of the current struct.
+func (tb *thriftBuffer) end() {
+	tb.WriteByte(0)
+	tb.fields = tb.fields[:len(tb.fields)-1]
+}
+
+func (tb *thriftBuffer) field(id int16, typ byte) {
+	last := &tb.fields[len(tb.fields)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		tb.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		tb.WriteByte(typ)
+		tb.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (tb *thriftBuffer) structField(id int16) {
+	tb.field(id, thriftStruct)
+	tb.begin()
+}
+
+func (tb *thriftBuffer) i32(id int16, v int32) {
+	tb.field(id, thriftI32)
+	tb.zigzag(int64(v))
+}
+
+func (tb *thriftBuffer) i64(id int16, v int64) {
+	tb.field(id, thriftI64)
+	tb.zigzag(v)
+}
+
+func (tb *thriftBuffer) str(id int16, v string) {
+	tb.field(id, thriftBinary)
+	tb.binary(v)
+}
+
+func (tb *thriftBuffer) list(id int16, elem byte, n int) {
+	tb.field(id, thriftList)
+	if n < 15 {
+		tb.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	tb.WriteByte(0xf0 | elem)
+	tb.varint(uint64(n))
+}
+
+func (tb *thriftBuffer) binary(v string) {
+	tb.varint(uint64(len(v)))
+	tb.WriteString(v)
+}
+
+func (tb *thriftBuffer) zigzag(v int64) {
+	tb.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (tb *thriftBuffer) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	tb.Write(b[:n])
+}
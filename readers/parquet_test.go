@@ -0,0 +1,320 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package readers_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Physical types and repetitions of the Parquet format.
+const (
+	booleanType   = 0
+	doubleType    = 5
+	byteArrayType = 6
+
+	required = 0
+	optional = 1
+)
+
+// parquetField describes column of the file schema.
+type parquetField struct {
+	name       string
+	typ        int64
+	repetition int64
+}
+
+var parquetSchema = []parquetField{
+	{"time", doubleType, required},
+	{"channel", byteArrayType, required},
+	{"publisher", byteArrayType, required},
+	{"subtopic", byteArrayType, required},
+	{"protocol", byteArrayType, required},
+	{"name", byteArrayType, required},
+	{"unit", byteArrayType, required},
+	{"value", doubleType, optional},
+	{"string_value", byteArrayType, optional},
+	{"bool_value", booleanType, optional},
+	{"data_value", byteArrayType, optional},
+	{"sum", doubleType, optional},
+	{"update_time", doubleType, optional},
+}
+
+func TestWriteParquet(t *testing.T) {
+	val := 21.5
+	sum := 120.0
+	boolVal := true
+	strVal := "on"
+	dataVal := "base64"
+
+	many := []readers.Message{}
+	manyRows := [][]interface{}{}
+	for i := 0; i < 25000; i++ {
+		v := float64(i)
+		msg := senml.Message{Channel: chanID, Publisher: pubID, Protocol: "mqtt", Time: float64(1600000000 + i)}
+		if i%3 == 0 {
+			msg.Value = &v
+		}
+		many = append(many, msg)
+
+		row := []interface{}{msg.Time, chanID, pubID, "", "mqtt", "", "", nil, nil, nil, nil, nil, nil}
+		if msg.Value != nil {
+			row[7] = v
+		}
+		manyRows = append(manyRows, row)
+	}
+
+	cases := map[string]struct {
+		messages []readers.Message
+		rows     [][]interface{}
+		err      error
+	}{
+		"write no messages": {
+			messages: []readers.Message{},
+			rows:     [][]interface{}{},
+		},
+		"write messages with different values": {
+			messages: []readers.Message{
+				senml.Message{Channel: chanID, Publisher: pubID, Subtopic: "room/1", Protocol: "mqtt", Name: "temp", Unit: "C", Time: 1600000000.5, Value: &val, Sum: &sum},
+				senml.Message{Channel: chanID, Publisher: pubID, Protocol: "http", Name: "switch", Time: 1600000001, BoolValue: &boolVal},
+				senml.Message{Channel: chanID, Publisher: pubID, Protocol: "coap", Name: "state", Time: 1600000002, StringValue: &strVal, UpdateTime: 1600000003},
+				senml.Message{Channel: chanID, Publisher: pubID, Protocol: "mqtt", Name: "blob", Time: 1600000004, DataValue: &dataVal},
+			},
+			rows: [][]interface{}{
+				{1600000000.5, chanID, pubID, "room/1", "mqtt", "temp", "C", 21.5, nil, nil, nil, 120.0, nil},
+				{1600000001.0, chanID, pubID, "", "http", "switch", "", nil, nil, true, nil, nil, nil},
+				{1600000002.0, chanID, pubID, "", "coap", "state", "", nil, "on", nil, nil, nil, 1600000003.0},
+				{1600000004.0, chanID, pubID, "", "mqtt", "blob", "", nil, nil, nil, "base64", nil, nil},
+			},
+		},
+		"write messages in multiple row groups": {
+			messages: many,
+			rows:     manyRows,
+		},
+		"write message with unsupported type": {
+			messages: []readers.Message{map[string]interface{}{"channel": chanID}},
+			err:      readers.ErrUnsupportedMessage,
+		},
+	}
+
+	for desc, tc := range cases {
+		ch := make(chan readers.Message, len(tc.messages))
+		for _, msg := range tc.messages {
+			ch <- msg
+		}
+		close(ch)
+
+		buf := &bytes.Buffer{}
+		err := readers.WriteParquet(buf, ch)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+
+		schema, rows := readParquet(t, buf.Bytes())
+		assert.Equal(t, parquetSchema, schema, fmt.Sprintf("%s: expected schema %v got %v", desc, parquetSchema, schema))
+		assert.Equal(t, tc.rows, rows, fmt.Sprintf("%s: expected %d rows got %d", desc, len(tc.rows), len(rows)))
+	}
+}
+
+// readParquet reads schema and rows of the flat Parquet file, whose
+// column chunks consist of uncompressed PLAIN encoded data pages.
+func readParquet(t *testing.T, data []byte) ([]parquetField, [][]interface{}) {
+	n := len(data)
+	require.True(t, n >= 12, "expected Parquet file header and footer")
+	require.Equal(t, "PAR1", string(data[:4]), "expected Parquet file header")
+	require.Equal(t, "PAR1", string(data[n-4:]), "expected Parquet file footer")
+
+	size := int(binary.LittleEndian.Uint32(data[n-8 : n-4]))
+	md := (&thriftReader{data: data[n-8-size : n-8]}).structure()
+
+	elements := md[2].([]interface{})
+	require.Equal(t, int64(len(elements)-1), elements[0].(map[int16]interface{})[5], "expected root element to contain all the columns")
+	schema := []parquetField{}
+	for _, el := range elements[1:] {
+		e := el.(map[int16]interface{})
+		schema = append(schema, parquetField{
+			name:       string(e[4].([]byte)),
+			typ:        e[1].(int64),
+			repetition: e[3].(int64),
+		})
+	}
+
+	rows := [][]interface{}{}
+	for _, g := range md[4].([]interface{}) {
+		rg := g.(map[int16]interface{})
+		num := int(rg[3].(int64))
+		group := make([][]interface{}, num)
+		for i := range group {
+			group[i] = make([]interface{}, len(schema))
+		}
+		for i, c := range rg[1].([]interface{}) {
+			cm := c.(map[int16]interface{})[3].(map[int16]interface{})
+			require.Equal(t, []interface{}{[]byte(schema[i].name)}, cm[3], "expected column chunk of %s", schema[i].name)
+			values := readColumn(t, data, int(cm[9].(int64)), schema[i])
+			require.Len(t, values, num, "expected %d values of %s", num, schema[i].name)
+			for j, v := range values {
+				group[j][i] = v
+			}
+		}
+		rows = append(rows, group...)
+	}
+	require.Equal(t, int64(len(rows)), md[3], "expected number of rows in file metadata")
+
+	return schema, rows
+}
+
+// readColumn reads values of the column chunk data page.
+func readColumn(t *testing.T, data []byte, offset int, field parquetField) []interface{} {
+	tr := &thriftReader{data: data, pos: offset}
+	hdr := tr.structure()
+	require.Equal(t, int64(0), hdr[1], "expected data page")
+	num := int(hdr[5].(map[int16]interface{})[1].(int64))
+	page := data[tr.pos : tr.pos+int(hdr[2].(int64))]
+
+	defined := make([]bool, num)
+	for i := range defined {
+		defined[i] = true
+	}
+	if field.repetition == optional {
+		size := int(binary.LittleEndian.Uint32(page[:4]))
+		defined = decodeLevels(page[4:4+size], num)
+		page = page[4+size:]
+	}
+
+	values := []interface{}{}
+	bit := 0
+	for _, ok := range defined {
+		if !ok {
+			values = append(values, nil)
+			continue
+		}
+		switch field.typ {
+		case doubleType:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(page[:8])))
+			page = page[8:]
+		case byteArrayType:
+			n := int(binary.LittleEndian.Uint32(page[:4]))
+			values = append(values, string(page[4:4+n]))
+			page = page[4+n:]
+		case booleanType:
+			values = append(values, page[bit/8]&(1<<uint(bit%8)) != 0)
+			bit++
+		}
+	}
+
+	return values
+}
+
+// decodeLevels decodes definition levels of bit width 1 encoded
+// using the RLE/bit-packing hybrid encoding.
+func decodeLevels(data []byte, num int) []bool {
+	tr := &thriftReader{data: data}
+	defined := []bool{}
+	for len(defined) < num && tr.pos < len(data) {
+		hdr := tr.varint()
+		if hdr&1 == 0 {
+			ok := tr.byte() == 1
+			for i := uint64(0); i < hdr>>1; i++ {
+				defined = append(defined, ok)
+			}
+			continue
+		}
+		for i := uint64(0); i < hdr>>1; i++ {
+			b := tr.byte()
+			for j := uint(0); j < 8; j++ {
+				defined = append(defined, b&(1<<j) != 0)
+			}
+		}
+	}
+
+	return defined[:num]
+}
+
+// thriftReader decodes Thrift compact protocol values. Integers are
+// decoded as int64, binaries as byte slices and structs as maps of
+// field values by field IDs.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (tr *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		b := tr.byte()
+		if b == 0 {
+			return fields
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(tr.zigzag())
+		}
+		fields[id] = tr.value(b & 0x0f)
+	}
+}
+
+func (tr *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(tr.byte()))
+	case 4, 5, 6:
+		return tr.zigzag()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(tr.data[tr.pos:]))
+		tr.pos += 8
+		return v
+	case 8:
+		n := int(tr.varint())
+		v := tr.data[tr.pos : tr.pos+n]
+		tr.pos += n
+		return v
+	case 9, 10:
+		hdr := tr.byte()
+		n := int(hdr >> 4)
+		if n == 15 {
+			n = int(tr.varint())
+		}
+		list := []interface{}{}
+		for i := 0; i < n; i++ {
+			list = append(list, tr.value(hdr&0x0f))
+		}
+		return list
+	case 12:
+		return tr.structure()
+	}
+
+	return nil
+}
+
+func (tr *thriftReader) byte() byte {
+	b := tr.data[tr.pos]
+	tr.pos++
+	return b
+}
+
+func (tr *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(tr.data[tr.pos:])
+	tr.pos += n
+	return v
+}
+
+func (tr *thriftReader) zigzag() int64 {
+	v := tr.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,758 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/readers"
+)
+
+// maxBuckets is the maximum number of buckets time range is split into,
+// so that short interval doesn't generate a bucket per each fraction of
+// a long time range.
+const maxBuckets = 10000
+
+var errAggregateMessages = errors.New("failed to aggregate messages in postgres database")
+
+// aggregateError converts database failures the same way readError does,
+// so that the missing table and SQLSTATE code are reported alike.
+func aggregateError(err error) error {
+	if _, ok := err.(*pq.Error); ok {
+		return readError(err)
+	}
+	if err == readers.ErrQueryTimeout || err == readers.ErrTooManyRequests {
+		return err
+	}
+
+	return errors.Wrap(errAggregateMessages, err)
+}
+
+// AggregatedPage contains page related metadata as well as value statistics
+// of the time buckets that belong to this page.
+type AggregatedPage struct {
+	readers.PageMetadata
+	Buckets []Bucket
+}
+
+// Bucket represents value statistics of messages within [From, To) time
+// range. Statistics of the bucket without messages are nil.
+type Bucket struct {
+	From float64  `json:"from"`
+	To   float64  `json:"to"`
+	Avg  *float64 `json:"avg"`
+	Min  *float64 `json:"min"`
+	Max  *float64 `json:"max"`
+}
+
+// IntervalCount represents number of messages received within the time
+// interval starting at BucketStart.
+type IntervalCount struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Count       uint64    `json:"count"`
+}
+
+// AggPoint represents value of the message received at Time, averaged
+// with the values of the messages preceding it.
+type AggPoint struct {
+	Time  float64 `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// PercentilePoint represents percentile of values of the messages received
+// within the time interval starting at BucketStart.
+type PercentilePoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Value       float64   `json:"value"`
+}
+
+// DeltaPoint represents difference between value of the message received
+// at Time and value of the message preceding it. Delta of the first message
+// is nil, since there is no preceding value.
+type DeltaPoint struct {
+	Time  float64  `json:"time"`
+	Delta *float64 `json:"delta"`
+}
+
+// Intervals messages can be counted by.
+var countIntervals = map[string]bool{
+	"minute": true,
+	"hour":   true,
+	"day":    true,
+	"week":   true,
+	"month":  true,
+	"year":   true,
+}
+
+// Aggregate functions applicable to SenML message values.
+var aggregations = map[string]string{
+	readers.AvgAggregation:   "AVG",
+	readers.MinAggregation:   "MIN",
+	readers.MaxAggregation:   "MAX",
+	readers.SumAggregation:   "SUM",
+	readers.CountAggregation: "COUNT",
+}
+
+func (tr postgresRepository) Aggregate(chanID string, rpm readers.PageMetadata) (float64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return 0, err
+	}
+	// Only SenML messages carry numeric values.
+	if !tr.senml[rpm.Format] {
+		return 0, readers.ErrInvalidFormat
+	}
+	agg, ok := aggregations[rpm.Aggregation]
+	if !ok {
+		return 0, readers.ErrInvalidAggregation
+	}
+
+	q := fmt.Sprintf(`SELECT %s(value) FROM %s WHERE %s;`, agg, rpm.Format, tr.condition(chanID, rpm))
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return 0, aggregateError(err)
+	}
+	defer rows.Close()
+
+	// Aggregate functions other than COUNT return NULL for empty set.
+	var val sql.NullFloat64
+	if rows.Next() {
+		if err := rows.Scan(&val); err != nil {
+			return 0, aggregateError(err)
+		}
+	}
+
+	return val.Float64, nil
+}
+
+func (tr postgresRepository) DistinctValueCount(chanID string, rpm readers.PageMetadata) (uint64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return 0, err
+	}
+	if !tr.senml[rpm.Format] {
+		return 0, readers.ErrInvalidFormat
+	}
+
+	q := fmt.Sprintf(`SELECT COUNT(DISTINCT value) FROM %s WHERE %s;`, rpm.Format, tr.condition(chanID, rpm))
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return 0, aggregateError(err)
+	}
+	defer rows.Close()
+
+	var count uint64
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, aggregateError(err)
+		}
+	}
+
+	return count, nil
+}
+
+func (tr postgresRepository) AggregatePercentile(chanID string, rpm readers.PageMetadata, p float64) (float64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return 0, err
+	}
+	if !tr.senml[rpm.Format] {
+		return 0, readers.ErrInvalidFormat
+	}
+	if p < 0 || p > 1 {
+		return 0, readers.ErrInvalidPercentile
+	}
+
+	q := fmt.Sprintf(`SELECT percentile_cont(CAST(:percentile AS FLOAT)) WITHIN GROUP (ORDER BY value)
+	FROM %s WHERE %s;`, rpm.Format, tr.condition(chanID, rpm))
+	params := fmtParams(chanID, rpm)
+	params["percentile"] = p
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return 0, aggregateError(err)
+	}
+	defer rows.Close()
+
+	// Percentile of empty set is NULL.
+	var val sql.NullFloat64
+	if rows.Next() {
+		if err := rows.Scan(&val); err != nil {
+			return 0, aggregateError(err)
+		}
+	}
+
+	return val.Float64, nil
+}
+
+func (tr postgresRepository) AggregatePercentileByInterval(chanID string, rpm readers.PageMetadata, p float64, interval string) ([]PercentilePoint, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	if p < 0 || p > 1 {
+		return nil, readers.ErrInvalidPercentile
+	}
+	if !countIntervals[interval] {
+		return nil, readers.ErrInvalidInterval
+	}
+	loc, err := location(rpm.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Buckets are truncated the same way CountByInterval truncates them.
+	q := fmt.Sprintf(`SELECT bucket AT TIME ZONE CAST(:tz AS TEXT), percentile FROM (
+		SELECT date_trunc(:interval, to_timestamp(time) AT TIME ZONE CAST(:tz AS TEXT)) AS bucket,
+			percentile_cont(CAST(:percentile AS FLOAT)) WITHIN GROUP (ORDER BY value) AS percentile
+		FROM %s WHERE %s AND value IS NOT NULL GROUP BY bucket
+	) AS buckets ORDER BY bucket;`, rpm.Format, tr.condition(chanID, rpm))
+
+	params := fmtParams(chanID, rpm)
+	params["percentile"] = p
+	params["interval"] = interval
+	params["tz"] = loc.String()
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	points := []PercentilePoint{}
+	for rows.Next() {
+		var pp PercentilePoint
+		if err := rows.Scan(&pp.BucketStart, &pp.Value); err != nil {
+			return nil, aggregateError(err)
+		}
+		pp.BucketStart = pp.BucketStart.In(loc)
+		points = append(points, pp)
+	}
+
+	return points, nil
+}
+
+func (tr postgresRepository) AggregateByPublisher(chanID string, rpm readers.PageMetadata) (map[string]float64, error) {
+	return tr.aggregateBy(chanID, rpm, "publisher")
+}
+
+func (tr postgresRepository) AggregateBySubtopic(chanID string, rpm readers.PageMetadata) (map[string]float64, error) {
+	return tr.aggregateBy(chanID, rpm, "subtopic")
+}
+
+// aggregateBy applies aggregate function to values of the messages grouped
+// by the given column.
+func (tr postgresRepository) aggregateBy(chanID string, rpm readers.PageMetadata, column string) (map[string]float64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	agg, ok := aggregations[rpm.Aggregation]
+	if !ok {
+		return nil, readers.ErrInvalidAggregation
+	}
+
+	q := fmt.Sprintf(`SELECT %s, %s(value) FROM %s WHERE %s GROUP BY %s;`,
+		column, agg, rpm.Format, tr.condition(chanID, rpm), column)
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	ret := map[string]float64{}
+	for rows.Next() {
+		var key string
+		var val sql.NullFloat64
+		if err := rows.Scan(&key, &val); err != nil {
+			return nil, aggregateError(err)
+		}
+		ret[key] = val.Float64
+	}
+
+	return ret, nil
+}
+
+func (tr postgresRepository) CountByPayloadField(chanID, field string, rpm readers.PageMetadata) (map[string]uint64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	// Only JSON messages carry payload.
+	if tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	if !validPayloadPath(strings.Split(field, payloadSep)) {
+		return nil, readers.ErrInvalidPayloadFilter
+	}
+
+	q := fmt.Sprintf(`SELECT payload->>CAST(:field AS TEXT) AS k, COUNT(*) FROM %s
+	WHERE %s AND payload->>CAST(:field AS TEXT) IS NOT NULL GROUP BY k;`, rpm.Format, tr.condition(chanID, rpm))
+	params := fmtParams(chanID, rpm)
+	params["field"] = field
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	counts := map[string]uint64{}
+	for rows.Next() {
+		var key string
+		var count uint64
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, aggregateError(err)
+		}
+		counts[key] = count
+	}
+
+	return counts, nil
+}
+
+func (tr postgresRepository) CountByProtocol(chanID string, rpm readers.PageMetadata) (map[string]uint64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf(`SELECT protocol, COUNT(*) FROM %s WHERE %s GROUP BY protocol;`, rpm.Format, tr.condition(chanID, rpm))
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	counts := map[string]uint64{}
+	for rows.Next() {
+		var protocol sql.NullString
+		var count uint64
+		if err := rows.Scan(&protocol, &count); err != nil {
+			return nil, aggregateError(err)
+		}
+		counts[protocol.String] += count
+	}
+
+	return counts, nil
+}
+
+func (tr postgresRepository) SubtopicsAboveThreshold(chanID string, threshold float64, rpm readers.PageMetadata) ([]string, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+
+	q := fmt.Sprintf(`SELECT subtopic FROM %s WHERE %s AND subtopic <> ''
+	GROUP BY subtopic HAVING AVG(value) > :threshold ORDER BY subtopic;`, rpm.Format, tr.condition(chanID, rpm))
+	params := fmtParams(chanID, rpm)
+	params["threshold"] = threshold
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	subtopics := []string{}
+	for rows.Next() {
+		var subtopic string
+		if err := rows.Scan(&subtopic); err != nil {
+			return nil, aggregateError(err)
+		}
+		subtopics = append(subtopics, subtopic)
+	}
+
+	return subtopics, nil
+}
+
+func (tr postgresRepository) ReadAggregated(chanID string, rpm readers.PageMetadata) (AggregatedPage, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return AggregatedPage{}, err
+	}
+	if !tr.senml[rpm.Format] {
+		return AggregatedPage{}, readers.ErrInvalidFormat
+	}
+	loc, err := location(rpm.Timezone)
+	if err != nil {
+		return AggregatedPage{}, err
+	}
+	interval, err := time.ParseDuration(rpm.Interval)
+	if err != nil || interval <= 0 {
+		return AggregatedPage{}, readers.ErrInvalidInterval
+	}
+
+	page := AggregatedPage{
+		PageMetadata: rpm,
+		Buckets:      []Bucket{},
+	}
+	cond := tr.condition(chanID, rpm)
+	params := fmtParams(chanID, rpm)
+
+	// Open time range is bounded by the oldest and the newest message,
+	// so that the number of buckets is known before they are generated.
+	start, end := rpm.From, rpm.To
+	if start == 0 || end == 0 {
+		min, max, err := tr.timeBounds(rpm.Format, cond, params)
+		if err != nil {
+			return AggregatedPage{}, err
+		}
+		if !min.Valid {
+			return page, nil
+		}
+		if start == 0 {
+			start = min.Float64
+		}
+		if end == 0 {
+			end = max.Float64
+		}
+	}
+	size := interval.Seconds()
+	start = alignBucket(start, size, loc)
+	if (end-start)/size > maxBuckets {
+		return AggregatedPage{}, readers.ErrInvalidInterval
+	}
+
+	bound := ""
+	if rpm.To != 0 {
+		bound = `WHERE bucket < :to`
+		if rpm.ToInclusive {
+			bound = `WHERE bucket <= :to`
+		}
+	}
+
+	// Buckets are generated separately from messages, so the
+	// buckets without messages are still returned.
+	q := fmt.Sprintf(`SELECT bucket, AVG(value), MIN(value), MAX(value)
+	FROM generate_series(
+		CAST(:start AS NUMERIC),
+		CAST(:end AS NUMERIC),
+		CAST(:interval AS NUMERIC)) AS bucket
+	LEFT JOIN %s ON %s AND time >= bucket AND time < bucket + :interval
+	%s GROUP BY bucket ORDER BY bucket;`, rpm.Format, cond, bound)
+	params["start"], params["end"], params["interval"] = start, end, size
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return AggregatedPage{}, aggregateError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var from float64
+		var avg, min, max sql.NullFloat64
+		if err := rows.Scan(&from, &avg, &min, &max); err != nil {
+			return AggregatedPage{}, aggregateError(err)
+		}
+
+		page.Buckets = append(page.Buckets, Bucket{
+			From: from,
+			To:   from + interval.Seconds(),
+			Avg:  nullFloat(avg),
+			Min:  nullFloat(min),
+			Max:  nullFloat(max),
+		})
+	}
+
+	return page, nil
+}
+
+// timeBounds returns time of the oldest and the newest message matching
+// the condition. Both are NULL if there are no such messages.
+func (tr postgresRepository) timeBounds(table, cond string, params map[string]interface{}) (sql.NullFloat64, sql.NullFloat64, error) {
+	var min, max sql.NullFloat64
+	q := fmt.Sprintf(`SELECT MIN(time), MAX(time) FROM %s WHERE %s;`, table, cond)
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return min, max, aggregateError(err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err := rows.Scan(&min, &max); err != nil {
+			return min, max, aggregateError(err)
+		}
+	}
+
+	return min, max, nil
+}
+
+// alignBucket returns start of the bucket of the given size which the time
+// belongs to. Buckets are aligned to the epoch in the time zone, using the
+// zone offset from UTC at the given time.
+func alignBucket(t, size float64, loc *time.Location) float64 {
+	_, off := time.Unix(int64(math.Floor(t)), 0).In(loc).Zone()
+	offset := float64(off)
+
+	return math.Floor((t+offset)/size)*size - offset
+}
+
+func (tr postgresRepository) StreamBuckets(ctx context.Context, chanID string, rpm readers.PageMetadata, interval time.Duration) (<-chan Bucket, error) {
+	vpm := rpm
+	if err := tr.validate(&vpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[vpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	loc, err := location(vpm.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, readers.ErrInvalidInterval
+	}
+	rpm.Interval = interval.String()
+
+	buckets := make(chan Bucket)
+	go func() {
+		defer close(buckets)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Start of the next bucket to emit is advanced only once the bucket
+		// is emitted, so that buckets of the failed poll are read on the
+		// next tick.
+		size := interval.Seconds()
+		var next float64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				// Only the buckets ended by now are complete.
+				end := alignBucket(float64(now.UnixNano())/float64(time.Second), size, loc)
+				if next == 0 {
+					next = end - size
+				}
+				if end <= next {
+					continue
+				}
+				if (end-next)/size > maxBuckets {
+					end = next + maxBuckets*size
+				}
+				rpm.From, rpm.To = next, end
+				page, err := tr.ReadAggregated(chanID, rpm)
+				if err != nil {
+					continue
+				}
+
+				for _, b := range page.Buckets {
+					// Bucket realigned before the start is already emitted.
+					if b.To <= next {
+						continue
+					}
+					select {
+					case buckets <- b:
+						next = b.To
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return buckets, nil
+}
+
+func nullFloat(val sql.NullFloat64) *float64 {
+	if !val.Valid {
+		return nil
+	}
+
+	return &val.Float64
+}
+
+func (tr postgresRepository) CountByInterval(chanID string, rpm readers.PageMetadata, interval string) ([]IntervalCount, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	if !countIntervals[interval] {
+		return nil, readers.ErrInvalidInterval
+	}
+	loc, err := location(rpm.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	q := tr.fmtIntervalCounts(chanID, rpm, "")
+	params := fmtParams(chanID, rpm)
+	params["interval"] = interval
+	params["tz"] = loc.String()
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	counts := []IntervalCount{}
+	for rows.Next() {
+		var ic IntervalCount
+		if err := rows.Scan(&ic.BucketStart, &ic.Count); err != nil {
+			return nil, aggregateError(err)
+		}
+		ic.BucketStart = ic.BucketStart.In(loc)
+		counts = append(counts, ic)
+	}
+
+	return counts, nil
+}
+
+func (tr postgresRepository) MissingIntervals(chanID string, rpm readers.PageMetadata, interval string) ([]time.Time, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	if !countIntervals[interval] {
+		return nil, readers.ErrInvalidInterval
+	}
+	loc, err := location(rpm.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	q := tr.fmtIntervalCounts(chanID, rpm, `HAVING COUNT(time) = 0`)
+	params := fmtParams(chanID, rpm)
+	params["interval"] = interval
+	params["tz"] = loc.String()
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	gaps := []time.Time{}
+	for rows.Next() {
+		var start time.Time
+		var count uint64
+		if err := rows.Scan(&start, &count); err != nil {
+			return nil, aggregateError(err)
+		}
+		gaps = append(gaps, start.In(loc))
+	}
+
+	return gaps, nil
+}
+
+// fmtIntervalCounts returns query counting messages within each of the
+// calendar intervals of the time range, including the empty ones, which
+// are filtered by the given HAVING clause.
+func (tr postgresRepository) fmtIntervalCounts(chanID string, rpm readers.PageMetadata, having string) string {
+	cond := tr.condition(chanID, rpm)
+	start := fmt.Sprintf(`(SELECT MIN(time) FROM %s WHERE %s)`, rpm.Format, cond)
+	if rpm.From != 0 {
+		start = `CAST(:from AS FLOAT)`
+	}
+	end, bound := fmt.Sprintf(`(SELECT MAX(time) FROM %s WHERE %s)`, rpm.Format, cond), ""
+	if rpm.To != 0 {
+		end, bound = `CAST(:to AS FLOAT)`, `WHERE bucket < to_timestamp(:to) AT TIME ZONE CAST(:tz AS TEXT)`
+		if rpm.ToInclusive {
+			bound = `WHERE bucket <= to_timestamp(:to) AT TIME ZONE CAST(:tz AS TEXT)`
+		}
+	}
+
+	// Buckets are truncated in the requested time zone, so they don't
+	// depend on the database session time zone.
+	q := fmt.Sprintf(`SELECT bucket AT TIME ZONE CAST(:tz AS TEXT), COUNT(time)
+	FROM generate_series(
+		date_trunc(:interval, to_timestamp(%s) AT TIME ZONE CAST(:tz AS TEXT)),
+		date_trunc(:interval, to_timestamp(%s) AT TIME ZONE CAST(:tz AS TEXT)),
+		CAST('1 ' || :interval AS INTERVAL)) AS bucket
+	LEFT JOIN %s ON %s AND date_trunc(:interval, to_timestamp(time) AT TIME ZONE CAST(:tz AS TEXT)) = bucket
+	%s GROUP BY bucket %s ORDER BY bucket;`, start, end, rpm.Format, cond, bound, having)
+
+	return q
+}
+
+func (tr postgresRepository) ReadMovingAverage(chanID string, rpm readers.PageMetadata, window int) ([]AggPoint, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	if window < 0 {
+		return nil, readers.ErrInvalidWindow
+	}
+	rpm.Limit = tr.limit(rpm.Limit)
+
+	// Average is calculated before the page is applied, so the first
+	// points of the page are averaged with the preceding messages.
+	q := fmt.Sprintf(`SELECT time, avg FROM (
+		SELECT time, AVG(value) OVER (ORDER BY time ROWS BETWEEN :window PRECEDING AND CURRENT ROW) AS avg
+		FROM %s WHERE %s AND value IS NOT NULL
+	) AS smoothed ORDER BY time LIMIT :limit OFFSET :offset;`, rpm.Format, tr.condition(chanID, rpm))
+
+	params := fmtParams(chanID, rpm)
+	params["window"] = window
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	points := []AggPoint{}
+	for rows.Next() {
+		var p AggPoint
+		if err := rows.Scan(&p.Time, &p.Value); err != nil {
+			return nil, aggregateError(err)
+		}
+		points = append(points, p)
+	}
+
+	return points, nil
+}
+
+func (tr postgresRepository) ReadDeltas(chanID string, rpm readers.PageMetadata) ([]DeltaPoint, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+	if !tr.senml[rpm.Format] {
+		return nil, readers.ErrInvalidFormat
+	}
+	rpm.Limit = tr.limit(rpm.Limit)
+
+	// Deltas are calculated before the page is applied, so the first
+	// point of the page is compared to the preceding message.
+	q := fmt.Sprintf(`SELECT time, delta FROM (
+		SELECT time, value - LAG(value) OVER (ORDER BY time) AS delta
+		FROM %s WHERE %s AND value IS NOT NULL
+	) AS deltas ORDER BY time LIMIT :limit OFFSET :offset;`, rpm.Format, tr.condition(chanID, rpm))
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, aggregateError(err)
+	}
+	defer rows.Close()
+
+	points := []DeltaPoint{}
+	for rows.Next() {
+		var p DeltaPoint
+		var delta sql.NullFloat64
+		if err := rows.Scan(&p.Time, &delta); err != nil {
+			return nil, aggregateError(err)
+		}
+		p.Delta = nullFloat(delta)
+		points = append(points, p)
+	}
+
+	return points, nil
+}
@@ -0,0 +1,1633 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	pwriter "github.com/mainflux/mainflux/consumers/writers/postgres"
+	mfjson "github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	preader "github.com/mainflux/mainflux/readers/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregate(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	emptyChanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	wrongID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Message values are in range [0, limit).
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		chanID   string
+		pageMeta readers.PageMetadata
+		value    float64
+		err      error
+	}{
+		"aggregate average value": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Aggregation: readers.AvgAggregation},
+			value:    4.5,
+		},
+		"aggregate minimal value": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Aggregation: readers.MinAggregation},
+			value:    0,
+		},
+		"aggregate maximal value": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Aggregation: readers.MaxAggregation},
+			value:    9,
+		},
+		"aggregate sum of values": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Aggregation: readers.SumAggregation},
+			value:    45,
+		},
+		"aggregate count of values": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Aggregation: readers.CountAggregation},
+			value:    limit,
+		},
+		"aggregate average value with time window": {
+			chanID: chanID,
+			pageMeta: readers.PageMetadata{
+				Aggregation: readers.AvgAggregation,
+				From:        messages[3].Time,
+				To:          messages[0].Time,
+			},
+			value: 2,
+		},
+		"aggregate average value with non-existent publisher": {
+			chanID: chanID,
+			pageMeta: readers.PageMetadata{
+				Aggregation: readers.AvgAggregation,
+				Publisher:   wrongID,
+			},
+			value: 0,
+		},
+		"aggregate average value with non-existent subtopic": {
+			chanID: chanID,
+			pageMeta: readers.PageMetadata{
+				Aggregation: readers.AvgAggregation,
+				Subtopic:    subtopic,
+			},
+			value: 0,
+		},
+		"aggregate average value for empty channel": {
+			chanID:   emptyChanID,
+			pageMeta: readers.PageMetadata{Aggregation: readers.AvgAggregation},
+			value:    0,
+		},
+		"aggregate count of values for empty channel": {
+			chanID:   emptyChanID,
+			pageMeta: readers.PageMetadata{Aggregation: readers.CountAggregation},
+			value:    0,
+		},
+		"aggregate with invalid aggregation": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Aggregation: "stddev"},
+			err:      readers.ErrInvalidAggregation,
+		},
+		"aggregate without aggregation": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{},
+			err:      readers.ErrInvalidAggregation,
+		},
+	}
+
+	for desc, tc := range cases {
+		value, err := reader.Aggregate(tc.chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.value, value, fmt.Sprintf("%s: expected %v got %v", desc, tc.value, value))
+	}
+}
+
+func TestDistinctValueCount(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Kitchen values repeat 1, 2 and 3, while garage values
+	// repeat 3 and 4, so the channel has 4 distinct values.
+	subtopics := map[string][]float64{
+		"kitchen": {1, 2, 3, 1, 2, 3},
+		"garage":  {3, 4, 3, 4},
+	}
+	now := float64(time.Now().Unix())
+	messages := []senml.Message{}
+	for sub, vals := range subtopics {
+		for i := range vals {
+			msg := senml.Message{
+				Channel:  chanID,
+				Subtopic: sub,
+				Protocol: mqttProt,
+				Time:     now - float64(i),
+				Value:    &vals[i],
+			}
+			messages = append(messages, msg)
+		}
+	}
+	// Messages without value are not counted.
+	messages = append(messages, senml.Message{Channel: chanID, Subtopic: "kitchen", Protocol: mqttProt, Time: now, StringValue: &vs})
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		count    uint64
+		err      error
+	}{
+		"count distinct values of channel": {
+			pageMeta: readers.PageMetadata{},
+			count:    4,
+		},
+		"count distinct values of subtopic": {
+			pageMeta: readers.PageMetadata{Subtopic: "kitchen"},
+			count:    3,
+		},
+		"count distinct values of subtopic with value filter": {
+			pageMeta: readers.PageMetadata{Subtopic: "garage", Comparator: readers.GreaterThanKey, Value: 3},
+			count:    1,
+		},
+		"count distinct values within time window": {
+			pageMeta: readers.PageMetadata{From: now - 1},
+			count:    4,
+		},
+		"count distinct values of non-existent subtopic": {
+			pageMeta: readers.PageMetadata{Subtopic: "attic"},
+			count:    0,
+		},
+		"count distinct values of JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		count, err := reader.DistinctValueCount(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.count, count, fmt.Sprintf("%s: expected %d got %d", desc, tc.count, count))
+	}
+}
+
+func TestAggregatePercentile(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	wrongID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Values are uniformly distributed from 1 to 100, in random order.
+	values := []float64{}
+	for i := 1; i <= msgsNum; i++ {
+		values = append(values, float64(i))
+	}
+	rand.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+	now := float64(time.Now().Unix())
+	messages := []senml.Message{}
+	for i := range values {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &values[i],
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		chanID string
+		p      float64
+		val    float64
+		err    error
+	}{
+		"aggregate median": {
+			chanID: chanID,
+			p:      0.5,
+			val:    50.5,
+		},
+		"aggregate 95th percentile": {
+			chanID: chanID,
+			p:      0.95,
+			val:    95.05,
+		},
+		"aggregate 99th percentile": {
+			chanID: chanID,
+			p:      0.99,
+			val:    99.01,
+		},
+		"aggregate minimum percentile": {
+			chanID: chanID,
+			p:      0,
+			val:    1,
+		},
+		"aggregate maximum percentile": {
+			chanID: chanID,
+			p:      1,
+			val:    100,
+		},
+		"aggregate percentile of non-existent channel": {
+			chanID: wrongID,
+			p:      0.5,
+			val:    0,
+		},
+		"aggregate negative percentile": {
+			chanID: chanID,
+			p:      -0.5,
+			err:    readers.ErrInvalidPercentile,
+		},
+		"aggregate percentile above one": {
+			chanID: chanID,
+			p:      1.5,
+			err:    readers.ErrInvalidPercentile,
+		},
+	}
+
+	for desc, tc := range cases {
+		val, err := reader.AggregatePercentile(tc.chanID, readers.PageMetadata{}, tc.p)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", desc, tc.err, err))
+		assert.InDelta(t, tc.val, val, 1e-9, fmt.Sprintf("%s: expected %f got %f", desc, tc.val, val))
+	}
+}
+
+func TestAggregatePercentileByInterval(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are received within the first, the second and the fourth
+	// hour, while none of them is received within the third one.
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	hours := map[int][]float64{
+		0: {1, 2, 3, 4, 5},
+		1: {50, 10, 40, 20, 30},
+		3: {7},
+	}
+	messages := []senml.Message{}
+	for h, vals := range hours {
+		for i := range vals {
+			msg := senml.Message{
+				Channel:  chanID,
+				Protocol: mqttProt,
+				Time:     float64(start.Add(time.Duration(h)*time.Hour + time.Duration(i)*time.Minute).Unix()),
+				Value:    &vals[i],
+			}
+			messages = append(messages, msg)
+		}
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		p        float64
+		interval string
+		points   []preader.PercentilePoint
+		err      error
+	}{
+		"aggregate hourly 95th percentile": {
+			p:        0.95,
+			interval: "hour",
+			points: []preader.PercentilePoint{
+				{BucketStart: start, Value: 4.8},
+				{BucketStart: start.Add(time.Hour), Value: 48},
+				{BucketStart: start.Add(3 * time.Hour), Value: 7},
+			},
+		},
+		"aggregate hourly median": {
+			p:        0.5,
+			interval: "hour",
+			points: []preader.PercentilePoint{
+				{BucketStart: start, Value: 3},
+				{BucketStart: start.Add(time.Hour), Value: 30},
+				{BucketStart: start.Add(3 * time.Hour), Value: 7},
+			},
+		},
+		"aggregate hourly minimum as 0th percentile": {
+			p:        0,
+			interval: "hour",
+			points: []preader.PercentilePoint{
+				{BucketStart: start, Value: 1},
+				{BucketStart: start.Add(time.Hour), Value: 10},
+				{BucketStart: start.Add(3 * time.Hour), Value: 7},
+			},
+		},
+		"aggregate daily maximum as 100th percentile": {
+			p:        1,
+			interval: "day",
+			points: []preader.PercentilePoint{
+				{BucketStart: start, Value: 50},
+			},
+		},
+		"aggregate hourly median within time range": {
+			pageMeta: readers.PageMetadata{
+				From: float64(start.Add(time.Hour).Unix()),
+				To:   float64(start.Add(2 * time.Hour).Unix()),
+			},
+			p:        0.5,
+			interval: "hour",
+			points: []preader.PercentilePoint{
+				{BucketStart: start.Add(time.Hour), Value: 30},
+			},
+		},
+		"aggregate hourly percentile out of range": {
+			p:        1.5,
+			interval: "hour",
+			err:      readers.ErrInvalidPercentile,
+		},
+		"aggregate negative hourly percentile": {
+			p:        -0.5,
+			interval: "hour",
+			err:      readers.ErrInvalidPercentile,
+		},
+		"aggregate percentile by unsupported interval": {
+			p:        0.5,
+			interval: "fortnight",
+			err:      readers.ErrInvalidInterval,
+		},
+		"aggregate percentile of JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			p:        0.5,
+			interval: "hour",
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		points, err := reader.AggregatePercentileByInterval(chanID, tc.pageMeta, tc.p, tc.interval)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		require.Equal(t, len(tc.points), len(points), fmt.Sprintf("%s: expected %v got %v", desc, tc.points, points))
+		for i, p := range points {
+			assert.Equal(t, tc.points[i].BucketStart, p.BucketStart, fmt.Sprintf("%s: expected bucket start %s got %s", desc, tc.points[i].BucketStart, p.BucketStart))
+			assert.InDelta(t, tc.points[i].Value, p.Value, 1e-9, fmt.Sprintf("%s: expected percentile %f got %f", desc, tc.points[i].Value, p.Value))
+		}
+	}
+}
+
+func TestReadAggregated(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	wrongID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are written in the first and the third hour
+	// of time range, so the second hour bucket is empty.
+	hour := time.Hour.Seconds()
+	start := float64(time.Now().Truncate(time.Hour).Add(-3 * time.Hour).Unix())
+	values := []float64{1, 3, 5}
+	times := []float64{start, start + 60, start + 2*hour + 60}
+	messages := []senml.Message{}
+	for i := range values {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      times[i],
+			Value:     &values[i],
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	avg := float64(2)
+	buckets := []preader.Bucket{
+		{From: start, To: start + hour, Avg: &avg, Min: &values[0], Max: &values[1]},
+		{From: start + hour, To: start + 2*hour},
+		{From: start + 2*hour, To: start + 3*hour, Avg: &values[2], Min: &values[2], Max: &values[2]},
+	}
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		buckets  []preader.Bucket
+		err      error
+	}{
+		"read aggregated messages within time range": {
+			pageMeta: readers.PageMetadata{
+				Interval: "1h",
+				From:     start,
+				To:       start + 3*hour,
+			},
+			buckets: buckets,
+		},
+		"read aggregated messages without time range": {
+			pageMeta: readers.PageMetadata{
+				Interval: "1h",
+			},
+			buckets: buckets,
+		},
+		"read aggregated messages with unaligned time range": {
+			pageMeta: readers.PageMetadata{
+				Interval: "1h",
+				From:     start + 30,
+				To:       start + hour,
+			},
+			buckets: []preader.Bucket{
+				{From: start, To: start + hour, Avg: &values[1], Min: &values[1], Max: &values[1]},
+			},
+		},
+		"read aggregated messages for empty time range": {
+			pageMeta: readers.PageMetadata{
+				Interval: "1h",
+				From:     start - 2*hour,
+				To:       start - hour,
+			},
+			buckets: []preader.Bucket{
+				{From: start - 2*hour, To: start - hour},
+			},
+		},
+		"read aggregated messages with non-existent publisher": {
+			pageMeta: readers.PageMetadata{
+				Interval:  "1h",
+				Publisher: wrongID,
+			},
+			buckets: []preader.Bucket{},
+		},
+		"read aggregated messages without interval": {
+			pageMeta: readers.PageMetadata{},
+			err:      readers.ErrInvalidInterval,
+		},
+		"read aggregated messages with negative interval": {
+			pageMeta: readers.PageMetadata{Interval: "-1h"},
+			err:      readers.ErrInvalidInterval,
+		},
+		"read aggregated messages with invalid interval": {
+			pageMeta: readers.PageMetadata{Interval: "1 hour'); DROP TABLE messages; --"},
+			err:      readers.ErrInvalidInterval,
+		},
+		"read aggregated messages with too many buckets": {
+			pageMeta: readers.PageMetadata{
+				Interval: "1ms",
+				From:     start,
+				To:       start + 3*hour,
+			},
+			err: readers.ErrInvalidInterval,
+		},
+		"read aggregated messages with too many buckets without time range": {
+			pageMeta: readers.PageMetadata{Interval: "100ms"},
+			err:      readers.ErrInvalidInterval,
+		},
+		"read aggregated messages in UTC": {
+			pageMeta: readers.PageMetadata{
+				Interval: "1h",
+				From:     start,
+				To:       start + 3*hour,
+				Timezone: "UTC",
+			},
+			buckets: buckets,
+		},
+		"read aggregated messages in unknown time zone": {
+			pageMeta: readers.PageMetadata{Interval: "1h", Timezone: "Mars/Olympus_Mons"},
+			err:      readers.ErrInvalidTimezone,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := reader.ReadAggregated(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.buckets, page.Buckets, fmt.Sprintf("%s: expected %v got %v", desc, tc.buckets, page.Buckets))
+	}
+}
+
+func TestReadAggregatedTimezone(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are received at 22:00 and 02:00 UTC, which are 07:00
+	// and 11:00 of the next day in Tokyo, and 03:30 and 07:30 in Kolkata.
+	values := []float64{1, 3}
+	times := []time.Time{
+		time.Date(2020, time.January, 1, 22, 0, 0, 0, time.UTC),
+		time.Date(2020, time.January, 2, 2, 0, 0, 0, time.UTC),
+	}
+	messages := []senml.Message{}
+	for i, tm := range times {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     float64(tm.Unix()),
+			Value:    &values[i],
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	day := 24 * time.Hour.Seconds()
+	hour := time.Hour.Seconds()
+	utcDay := float64(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC).Unix())
+	tokyoDay := float64(time.Date(2020, time.January, 2, 0, 0, 0, 0, tokyo).Unix())
+	kolkataHour := float64(time.Date(2020, time.January, 2, 3, 0, 0, 0, kolkata).Unix())
+	avg := float64(2)
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		buckets  []preader.Bucket
+	}{
+		"read daily buckets in UTC": {
+			pageMeta: readers.PageMetadata{Interval: "24h"},
+			buckets: []preader.Bucket{
+				{From: utcDay, To: utcDay + day, Avg: &values[0], Min: &values[0], Max: &values[0]},
+				{From: utcDay + day, To: utcDay + 2*day, Avg: &values[1], Min: &values[1], Max: &values[1]},
+			},
+		},
+		"read daily buckets in time zone east of UTC": {
+			pageMeta: readers.PageMetadata{Interval: "24h", Timezone: "Asia/Tokyo"},
+			buckets: []preader.Bucket{
+				{From: tokyoDay, To: tokyoDay + day, Avg: &avg, Min: &values[0], Max: &values[1]},
+			},
+		},
+		"read hourly buckets in time zone with half hour offset": {
+			pageMeta: readers.PageMetadata{
+				Interval: "1h",
+				From:     float64(times[0].Unix()),
+				To:       float64(times[0].Unix()) + hour,
+				Timezone: "Asia/Kolkata",
+			},
+			buckets: []preader.Bucket{
+				{From: kolkataHour, To: kolkataHour + hour, Avg: &values[0], Min: &values[0], Max: &values[0]},
+				{From: kolkataHour + hour, To: kolkataHour + 2*hour},
+			},
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := reader.ReadAggregated(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.buckets, page.Buckets, fmt.Sprintf("%s: expected %v got %v", desc, tc.buckets, page.Buckets))
+	}
+}
+
+func TestStreamBuckets(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are received every 100ms, starting a second ago, so that
+	// the buckets completed while streaming are not empty.
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+	messages := []senml.Message{}
+	for i := 0; i < 50; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - 1 + float64(i)/10,
+			Value:    &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	interval := 500 * time.Millisecond
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		interval time.Duration
+		err      error
+	}{
+		"stream buckets with zero interval": {
+			interval: 0,
+			err:      readers.ErrInvalidInterval,
+		},
+		"stream buckets with negative interval": {
+			interval: -interval,
+			err:      readers.ErrInvalidInterval,
+		},
+		"stream buckets of JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			interval: interval,
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		_, err := reader.StreamBuckets(context.Background(), chanID, tc.pageMeta, tc.interval)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+	}
+
+	// Poll of the first bucket fails, so it's read on the next tick.
+	connector, err := pq.NewConnector(dbURL)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	fc := &flakyConnector{Connector: connector, failures: 1, err: &pq.Error{Code: "08006"}}
+	flakyDB := sqlx.NewDb(sql.OpenDB(fc), "postgres")
+	defer flakyDB.Close()
+	flaky := preader.New(flakyDB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buckets, err := flaky.StreamBuckets(ctx, chanID, readers.PageMetadata{}, interval)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	var prev *preader.Bucket
+	for i := 0; i < 3; i++ {
+		select {
+		case b, ok := <-buckets:
+			require.True(t, ok, "expected bucket to be emitted got closed channel")
+			assert.Equal(t, interval.Seconds(), b.To-b.From, fmt.Sprintf("expected bucket of %s got [%f, %f)", interval, b.From, b.To))
+			assert.LessOrEqual(t, b.To, float64(time.Now().UnixNano())/float64(time.Second), "expected completed bucket")
+			assert.NotNil(t, b.Avg, fmt.Sprintf("expected bucket [%f, %f) with messages", b.From, b.To))
+			if prev != nil {
+				assert.Equal(t, prev.To, b.From, fmt.Sprintf("expected bucket right after [%f, %f) got [%f, %f)", prev.From, prev.To, b.From, b.To))
+			}
+			prev = &b
+		case <-time.After(4 * interval):
+			require.Fail(t, "expected bucket to be emitted on tick")
+		}
+	}
+
+	cancel()
+	closed := false
+	timeout := time.After(4 * interval)
+	for !closed {
+		select {
+		case _, ok := <-buckets:
+			closed = !ok
+		case <-timeout:
+			require.Fail(t, "expected channel to be closed on context cancellation")
+		}
+	}
+}
+
+func TestAggregateByPublisher(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	publishers := []string{}
+	for i := 0; i < 3; i++ {
+		pubID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		publishers = append(publishers, pubID)
+	}
+
+	// Publisher values are i*10, i*10+1 and i*10+2, where i is
+	// the publisher index. The newest message is the lowest one.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i, pub := range publishers {
+		for j := 0; j < 3; j++ {
+			val := float64(i*10 + j)
+			msg := senml.Message{
+				Channel:   chanID,
+				Publisher: pub,
+				Protocol:  mqttProt,
+				Time:      now - float64(j),
+				Value:     &val,
+			}
+			messages = append(messages, msg)
+		}
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		values   map[string]float64
+		err      error
+	}{
+		"aggregate average value by publisher": {
+			pageMeta: readers.PageMetadata{Aggregation: readers.AvgAggregation},
+			values: map[string]float64{
+				publishers[0]: 1,
+				publishers[1]: 11,
+				publishers[2]: 21,
+			},
+		},
+		"aggregate maximal value by publisher": {
+			pageMeta: readers.PageMetadata{Aggregation: readers.MaxAggregation},
+			values: map[string]float64{
+				publishers[0]: 2,
+				publishers[1]: 12,
+				publishers[2]: 22,
+			},
+		},
+		"aggregate count of values by publisher": {
+			pageMeta: readers.PageMetadata{Aggregation: readers.CountAggregation},
+			values: map[string]float64{
+				publishers[0]: 3,
+				publishers[1]: 3,
+				publishers[2]: 3,
+			},
+		},
+		"aggregate average value by publisher with time window": {
+			pageMeta: readers.PageMetadata{
+				Aggregation: readers.AvgAggregation,
+				From:        now - 1,
+			},
+			values: map[string]float64{
+				publishers[0]: 0.5,
+				publishers[1]: 10.5,
+				publishers[2]: 20.5,
+			},
+		},
+		"aggregate sum of values by publisher with value filter": {
+			pageMeta: readers.PageMetadata{
+				Aggregation: readers.SumAggregation,
+				ValueFrom:   float(11),
+			},
+			values: map[string]float64{
+				publishers[1]: 23,
+				publishers[2]: 63,
+			},
+		},
+		"aggregate by publisher with invalid aggregation": {
+			pageMeta: readers.PageMetadata{Aggregation: "median"},
+			err:      readers.ErrInvalidAggregation,
+		},
+	}
+
+	for desc, tc := range cases {
+		values, err := reader.AggregateByPublisher(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.values, values, fmt.Sprintf("%s: expected %v got %v", desc, tc.values, values))
+	}
+}
+
+func TestAggregateBySubtopic(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Room values are i*10, i*10+1 and i*10+2, where i is
+	// the room index. The newest message is the lowest one.
+	rooms := []string{"kitchen", "bedroom", "garage"}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i, room := range rooms {
+		for j := 0; j < 3; j++ {
+			val := float64(i*10 + j)
+			msg := senml.Message{
+				Channel:  chanID,
+				Subtopic: room,
+				Protocol: mqttProt,
+				Time:     now - float64(j),
+				Value:    &val,
+			}
+			messages = append(messages, msg)
+		}
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		values   map[string]float64
+		err      error
+	}{
+		"aggregate average value by subtopic": {
+			pageMeta: readers.PageMetadata{Aggregation: readers.AvgAggregation},
+			values: map[string]float64{
+				rooms[0]: 1,
+				rooms[1]: 11,
+				rooms[2]: 21,
+			},
+		},
+		"aggregate minimal value by subtopic": {
+			pageMeta: readers.PageMetadata{Aggregation: readers.MinAggregation},
+			values: map[string]float64{
+				rooms[0]: 0,
+				rooms[1]: 10,
+				rooms[2]: 20,
+			},
+		},
+		"aggregate average value by subtopic with time window": {
+			pageMeta: readers.PageMetadata{
+				Aggregation: readers.AvgAggregation,
+				From:        now - 1,
+			},
+			values: map[string]float64{
+				rooms[0]: 0.5,
+				rooms[1]: 10.5,
+				rooms[2]: 20.5,
+			},
+		},
+		"aggregate sum of values by subtopic with value filter": {
+			pageMeta: readers.PageMetadata{
+				Aggregation: readers.SumAggregation,
+				ValueFrom:   float(11),
+			},
+			values: map[string]float64{
+				rooms[1]: 23,
+				rooms[2]: 63,
+			},
+		},
+		"aggregate by subtopic with invalid aggregation": {
+			pageMeta: readers.PageMetadata{Aggregation: "median"},
+			err:      readers.ErrInvalidAggregation,
+		},
+	}
+
+	for desc, tc := range cases {
+		values, err := reader.AggregateBySubtopic(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.values, values, fmt.Sprintf("%s: expected %v got %v", desc, tc.values, values))
+	}
+}
+
+func TestCountByPayloadField(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	payloads := []map[string]interface{}{
+		{"status": "ok", "device": map[string]interface{}{"status": "on"}},
+		{"status": "ok", "device": map[string]interface{}{"status": "off"}},
+		{"status": "ok"},
+		{"status": "error", "device": map[string]interface{}{"status": "on"}},
+		{"status": "error"},
+		{"status": float64(500)},
+		{"status": nil},
+		{"temp": float64(20)},
+	}
+	// The oldest message is the first one.
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i, pld := range payloads {
+		flat, err := mfjson.Flatten(pld)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		messages = append(messages, mfjson.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Created:  (now - int64(len(payloads)-i)) * int64(time.Second),
+			Payload:  flat,
+		})
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   messages,
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		field    string
+		pageMeta readers.PageMetadata
+		counts   map[string]uint64
+		err      error
+	}{
+		"count messages by payload field": {
+			field:    "status",
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			counts: map[string]uint64{
+				"ok":    3,
+				"error": 2,
+				"500":   1,
+			},
+		},
+		"count messages by nested payload field": {
+			field:    "device/status",
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			counts: map[string]uint64{
+				"on":  2,
+				"off": 1,
+			},
+		},
+		"count messages by payload field with time window": {
+			field: "status",
+			pageMeta: readers.PageMetadata{
+				Format: jsonFormat,
+				From:   float64(now - 6),
+			},
+			counts: map[string]uint64{
+				"ok":    1,
+				"error": 2,
+				"500":   1,
+			},
+		},
+		"count messages by missing payload field": {
+			field:    "pressure",
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			counts:   map[string]uint64{},
+		},
+		"count messages by empty payload field": {
+			field:    "",
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			err:      readers.ErrInvalidPayloadFilter,
+		},
+		"count messages by payload field with empty key": {
+			field:    "device/",
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			err:      readers.ErrInvalidPayloadFilter,
+		},
+		"count SenML messages by payload field": {
+			field:    "status",
+			pageMeta: readers.PageMetadata{},
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		counts, err := reader.CountByPayloadField(chanID, tc.field, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.counts, counts, fmt.Sprintf("%s: expected %v got %v", desc, tc.counts, counts))
+	}
+}
+
+func TestCountByProtocol(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Protocols take turns, the newest message is the first one,
+	// so the older messages are mostly received over HTTP.
+	protocols := []string{mqttProt, "http", "coap", "http"}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 2*len(protocols); i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: protocols[i%len(protocols)],
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	jsonMsg := mfjson.Message{
+		Channel:  chanID,
+		Protocol: "coap",
+		Created:  time.Now().Unix(),
+		Payload:  map[string]interface{}{"temp": float64(20)},
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   []mfjson.Message{jsonMsg},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		counts   map[string]uint64
+		err      error
+	}{
+		"count messages by protocol": {
+			pageMeta: readers.PageMetadata{},
+			counts: map[string]uint64{
+				mqttProt: 2,
+				"http":   4,
+				"coap":   2,
+			},
+		},
+		"count messages by protocol within time window": {
+			pageMeta: readers.PageMetadata{From: now - 2},
+			counts: map[string]uint64{
+				mqttProt: 1,
+				"http":   1,
+				"coap":   1,
+			},
+		},
+		"count messages by protocol within time window outside messages": {
+			pageMeta: readers.PageMetadata{To: now - 10},
+			counts:   map[string]uint64{},
+		},
+		"count messages by protocol with protocol filter": {
+			pageMeta: readers.PageMetadata{Protocols: []string{mqttProt, "http"}},
+			counts: map[string]uint64{
+				mqttProt: 2,
+				"http":   4,
+			},
+		},
+		"count JSON messages by protocol": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			counts:   map[string]uint64{"coap": 1},
+		},
+		"count messages by protocol with invalid format": {
+			pageMeta: readers.PageMetadata{Format: "unknown"},
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		counts, err := reader.CountByProtocol(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.counts, counts, fmt.Sprintf("%s: expected %v got %v", desc, tc.counts, counts))
+	}
+}
+
+func TestSubtopicsAboveThreshold(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Room values are i*10, i*10+1 and i*10+2, where i is the room
+	// index, so room averages are 1, 11 and 21. The newest message
+	// is the lowest one.
+	rooms := []string{"kitchen", "bedroom", "garage"}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i, room := range rooms {
+		for j := 0; j < 3; j++ {
+			val := float64(i*10 + j)
+			msg := senml.Message{
+				Channel:  chanID,
+				Subtopic: room,
+				Protocol: mqttProt,
+				Time:     now - float64(j),
+				Value:    &val,
+			}
+			messages = append(messages, msg)
+		}
+	}
+	// Messages without subtopic or value don't qualify.
+	high := float64(100)
+	messages = append(messages,
+		senml.Message{Channel: chanID, Protocol: mqttProt, Time: now, Value: &high},
+		senml.Message{Channel: chanID, Subtopic: "hall", Protocol: mqttProt, Time: now, StringValue: &vs},
+	)
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		threshold float64
+		pageMeta  readers.PageMetadata
+		subtopics []string
+		err       error
+	}{
+		"read subtopics above threshold": {
+			threshold: 10,
+			subtopics: []string{rooms[1], rooms[2]},
+		},
+		"read subtopics above threshold equal to average": {
+			threshold: 11,
+			subtopics: []string{rooms[2]},
+		},
+		"read subtopics above threshold lower than all averages": {
+			threshold: -1,
+			subtopics: []string{rooms[1], rooms[2], rooms[0]},
+		},
+		"read subtopics above threshold greater than all averages": {
+			threshold: 50,
+			subtopics: []string{},
+		},
+		"read subtopics above threshold within time window": {
+			threshold: 10.5,
+			pageMeta:  readers.PageMetadata{From: now - 1},
+			subtopics: []string{rooms[2]},
+		},
+		"read subtopics above threshold of JSON messages": {
+			threshold: 10,
+			pageMeta:  readers.PageMetadata{Format: jsonFormat},
+			err:       readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		subtopics, err := reader.SubtopicsAboveThreshold(chanID, tc.threshold, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.subtopics, subtopics, fmt.Sprintf("%s: expected %v got %v", desc, tc.subtopics, subtopics))
+	}
+}
+
+func TestCountByInterval(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Two messages are received in the first hour, none in the
+	// second one and one in the third hour of the time range.
+	start := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	times := []time.Time{
+		start.Add(10 * time.Minute),
+		start.Add(20 * time.Minute),
+		start.Add(2*time.Hour + 5*time.Minute),
+	}
+	messages := []senml.Message{}
+	for _, tm := range times {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     float64(tm.Unix()),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	hourly := []preader.IntervalCount{
+		{BucketStart: start, Count: 2},
+		{BucketStart: start.Add(time.Hour), Count: 0},
+		{BucketStart: start.Add(2 * time.Hour), Count: 1},
+	}
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		interval string
+		counts   []preader.IntervalCount
+		err      error
+	}{
+		"count messages by hour within time range": {
+			pageMeta: readers.PageMetadata{
+				From: float64(start.Unix()),
+				To:   float64(start.Add(3 * time.Hour).Unix()),
+			},
+			interval: "hour",
+			counts:   hourly,
+		},
+		"count messages by hour without time range": {
+			pageMeta: readers.PageMetadata{},
+			interval: "hour",
+			counts:   hourly,
+		},
+		"count messages by hour within wider time range": {
+			pageMeta: readers.PageMetadata{
+				From: float64(start.Add(-time.Hour).Unix()),
+				To:   float64(start.Add(4 * time.Hour).Unix()),
+			},
+			interval: "hour",
+			counts: append([]preader.IntervalCount{{BucketStart: start.Add(-time.Hour)}},
+				append(hourly, preader.IntervalCount{BucketStart: start.Add(3 * time.Hour)})...),
+		},
+		"count messages by minute within bucket boundaries": {
+			pageMeta: readers.PageMetadata{
+				From: float64(start.Add(10 * time.Minute).Unix()),
+				To:   float64(start.Add(12 * time.Minute).Unix()),
+			},
+			interval: "minute",
+			counts: []preader.IntervalCount{
+				{BucketStart: start.Add(10 * time.Minute), Count: 1},
+				{BucketStart: start.Add(11 * time.Minute), Count: 0},
+			},
+		},
+		"count messages for empty channel": {
+			pageMeta: readers.PageMetadata{Subtopic: subtopic},
+			interval: "hour",
+			counts:   []preader.IntervalCount{},
+		},
+		"count messages by unsupported interval": {
+			pageMeta: readers.PageMetadata{},
+			interval: "fortnight",
+			err:      readers.ErrInvalidInterval,
+		},
+		"count messages by injected interval": {
+			pageMeta: readers.PageMetadata{},
+			interval: "hour'); DROP TABLE messages; --",
+			err:      readers.ErrInvalidInterval,
+		},
+	}
+
+	for desc, tc := range cases {
+		counts, err := reader.CountByInterval(chanID, tc.pageMeta, tc.interval)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.counts, counts, fmt.Sprintf("%s: expected %v got %v", desc, tc.counts, counts))
+	}
+}
+
+func TestCountByIntervalTimezone(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are received on different days in UTC, but on the
+	// same day both east and west of it.
+	times := []time.Time{
+		time.Date(2020, time.January, 1, 22, 0, 0, 0, time.UTC),
+		time.Date(2020, time.January, 2, 2, 0, 0, 0, time.UTC),
+	}
+	messages := []senml.Message{}
+	for _, tm := range times {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     float64(tm.Unix()),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	newYork, err := time.LoadLocation("America/New_York")
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		timezone string
+		counts   []preader.IntervalCount
+		err      error
+	}{
+		"count messages by day in default time zone": {
+			timezone: "",
+			counts: []preader.IntervalCount{
+				{BucketStart: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+				{BucketStart: time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC), Count: 1},
+			},
+		},
+		"count messages by day in UTC": {
+			timezone: "UTC",
+			counts: []preader.IntervalCount{
+				{BucketStart: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+				{BucketStart: time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC), Count: 1},
+			},
+		},
+		"count messages by day in time zone east of UTC": {
+			timezone: "Asia/Tokyo",
+			counts: []preader.IntervalCount{
+				{BucketStart: time.Date(2020, time.January, 2, 0, 0, 0, 0, tokyo), Count: 2},
+			},
+		},
+		"count messages by day in time zone west of UTC": {
+			timezone: "America/New_York",
+			counts: []preader.IntervalCount{
+				{BucketStart: time.Date(2020, time.January, 1, 0, 0, 0, 0, newYork), Count: 2},
+			},
+		},
+		"count messages by day in unknown time zone": {
+			timezone: "Mars/Olympus_Mons",
+			err:      readers.ErrInvalidTimezone,
+		},
+		"count messages by day in local time zone": {
+			timezone: "Local",
+			err:      readers.ErrInvalidTimezone,
+		},
+		"count messages by day in injected time zone": {
+			timezone: "UTC'); DROP TABLE messages; --",
+			err:      readers.ErrInvalidTimezone,
+		},
+	}
+
+	for desc, tc := range cases {
+		counts, err := reader.CountByInterval(chanID, readers.PageMetadata{Timezone: tc.timezone}, "day")
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		require.Equal(t, len(tc.counts), len(counts), fmt.Sprintf("%s: expected %v got %v", desc, tc.counts, counts))
+		for i, c := range counts {
+			assert.True(t, tc.counts[i].BucketStart.Equal(c.BucketStart), fmt.Sprintf("%s: expected bucket start %s got %s", desc, tc.counts[i].BucketStart, c.BucketStart))
+			assert.Equal(t, tc.counts[i].BucketStart.Location().String(), c.BucketStart.Location().String(), fmt.Sprintf("%s: expected bucket start in %s got %s", desc, tc.counts[i].BucketStart.Location(), c.BucketStart.Location()))
+			assert.Equal(t, tc.counts[i].Count, c.Count, fmt.Sprintf("%s: expected count %d got %d", desc, tc.counts[i].Count, c.Count))
+		}
+	}
+}
+
+func TestMissingIntervals(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// No message is received within the third and the fourth hour.
+	day := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		day.Add(30 * time.Minute),
+		day.Add(90 * time.Minute),
+		day.Add(270 * time.Minute),
+		day.Add(310 * time.Minute),
+	}
+	messages := []senml.Message{}
+	for _, tm := range times {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     float64(tm.Unix()),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		interval string
+		gaps     []time.Time
+		err      error
+	}{
+		"find missing hours between the first and the last message": {
+			pageMeta: readers.PageMetadata{},
+			interval: "hour",
+			gaps:     []time.Time{day.Add(2 * time.Hour), day.Add(3 * time.Hour)},
+		},
+		"find missing hours within time range": {
+			pageMeta: readers.PageMetadata{
+				From: float64(day.Unix()),
+				To:   float64(day.Add(7 * time.Hour).Unix()),
+			},
+			interval: "hour",
+			gaps:     []time.Time{day.Add(2 * time.Hour), day.Add(3 * time.Hour), day.Add(6 * time.Hour)},
+		},
+		"find missing minutes within time range": {
+			pageMeta: readers.PageMetadata{
+				From: float64(day.Add(30 * time.Minute).Unix()),
+				To:   float64(day.Add(33 * time.Minute).Unix()),
+			},
+			interval: "minute",
+			gaps:     []time.Time{day.Add(31 * time.Minute), day.Add(32 * time.Minute)},
+		},
+		"find missing days": {
+			pageMeta: readers.PageMetadata{},
+			interval: "day",
+			gaps:     []time.Time{},
+		},
+		"find missing intervals with invalid interval": {
+			pageMeta: readers.PageMetadata{},
+			interval: "fortnight",
+			err:      readers.ErrInvalidInterval,
+		},
+		"find missing intervals of JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			interval: "hour",
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		gaps, err := reader.MissingIntervals(chanID, tc.pageMeta, tc.interval)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		require.Equal(t, len(tc.gaps), len(gaps), fmt.Sprintf("%s: expected %v got %v", desc, tc.gaps, gaps))
+		for i, g := range gaps {
+			assert.True(t, tc.gaps[i].Equal(g), fmt.Sprintf("%s: expected gap %s got %s", desc, tc.gaps[i], g))
+		}
+	}
+}
+
+func TestReadMovingAverage(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Values grow by 2, one per second.
+	values := []float64{2, 4, 6, 8, 10}
+	start := float64(time.Now().Unix()) - float64(len(values))
+	messages := []senml.Message{}
+	for i := range values {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     start + float64(i),
+			Value:    &values[i],
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		window   int
+		points   []preader.AggPoint
+		err      error
+	}{
+		"read moving average without preceding values": {
+			window: 0,
+			points: []preader.AggPoint{
+				{Time: start, Value: 2},
+				{Time: start + 1, Value: 4},
+				{Time: start + 2, Value: 6},
+				{Time: start + 3, Value: 8},
+				{Time: start + 4, Value: 10},
+			},
+		},
+		"read moving average over two preceding values": {
+			window: 2,
+			points: []preader.AggPoint{
+				{Time: start, Value: 2},
+				{Time: start + 1, Value: 3},
+				{Time: start + 2, Value: 4},
+				{Time: start + 3, Value: 6},
+				{Time: start + 4, Value: 8},
+			},
+		},
+		"read moving average over window wider than messages": {
+			window: 10,
+			points: []preader.AggPoint{
+				{Time: start, Value: 2},
+				{Time: start + 1, Value: 3},
+				{Time: start + 2, Value: 4},
+				{Time: start + 3, Value: 5},
+				{Time: start + 4, Value: 6},
+			},
+		},
+		"read moving average page preceded by messages": {
+			pageMeta: readers.PageMetadata{Offset: 3, Limit: 2},
+			window:   1,
+			points: []preader.AggPoint{
+				{Time: start + 3, Value: 7},
+				{Time: start + 4, Value: 9},
+			},
+		},
+		"read moving average with negative window": {
+			window: -1,
+			err:    readers.ErrInvalidWindow,
+		},
+		"read moving average of JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			window:   1,
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		points, err := reader.ReadMovingAverage(chanID, tc.pageMeta, tc.window)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.points, points, fmt.Sprintf("%s: expected %v got %v", desc, tc.points, points))
+	}
+}
+
+func TestReadDeltas(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Counter grows monotonically, one reading per second.
+	values := []float64{10, 12, 15, 15, 21}
+	start := float64(time.Now().Unix()) - float64(len(values))
+	messages := []senml.Message{}
+	for i := range values {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     start + float64(i),
+			Value:    &values[i],
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	delta := func(d float64) *float64 { return &d }
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		points   []preader.DeltaPoint
+		err      error
+	}{
+		"read deltas": {
+			points: []preader.DeltaPoint{
+				{Time: start, Delta: nil},
+				{Time: start + 1, Delta: delta(2)},
+				{Time: start + 2, Delta: delta(3)},
+				{Time: start + 3, Delta: delta(0)},
+				{Time: start + 4, Delta: delta(6)},
+			},
+		},
+		"read deltas page preceded by messages": {
+			pageMeta: readers.PageMetadata{Offset: 2, Limit: 2},
+			points: []preader.DeltaPoint{
+				{Time: start + 2, Delta: delta(3)},
+				{Time: start + 3, Delta: delta(0)},
+			},
+		},
+		"read deltas within time range": {
+			pageMeta: readers.PageMetadata{From: start + 3},
+			points: []preader.DeltaPoint{
+				{Time: start + 3, Delta: nil},
+				{Time: start + 4, Delta: delta(6)},
+			},
+		},
+		"read deltas of empty channel": {
+			pageMeta: readers.PageMetadata{Subtopic: subtopic},
+			points:   []preader.DeltaPoint{},
+		},
+		"read deltas of JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		points, err := reader.ReadDeltas(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.points, points, fmt.Sprintf("%s: expected %v got %v", desc, tc.points, points))
+	}
+}
+
+func TestAggregateQueryError(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		err  *pq.Error
+		code string
+	}{
+		"aggregate messages of missing table": {
+			err: &pq.Error{Code: "42P01"},
+		},
+		"aggregate messages with syntax error": {
+			err:  &pq.Error{Code: "42601"},
+			code: "42601",
+		},
+	}
+
+	for desc, tc := range cases {
+		connector, err := pq.NewConnector(dbURL)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		fc := &flakyConnector{Connector: connector, failures: 1, err: tc.err}
+		flakyDB := sqlx.NewDb(sql.OpenDB(fc), "postgres")
+
+		reader := preader.New(flakyDB)
+		_, err = reader.Aggregate(chanID, readers.PageMetadata{Aggregation: readers.AvgAggregation})
+		if tc.code == "" {
+			assert.True(t, stderrors.Is(err, readers.ErrTableNotFound), fmt.Sprintf("%s: expected %s got %s", desc, readers.ErrTableNotFound, err))
+			flakyDB.Close()
+			continue
+		}
+		var qe *preader.QueryError
+		assert.True(t, stderrors.As(err, &qe), fmt.Sprintf("%s: expected query error got %s", desc, err))
+		if qe != nil {
+			assert.Equal(t, tc.code, qe.Code(), fmt.Sprintf("%s: expected code %s got %s", desc, tc.code, qe.Code()))
+		}
+		flakyDB.Close()
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/arrow"
+)
+
+// Number of messages columns are allocated for ahead of reading.
+const maxPrealloc = 1000
+
+// Columns represents page of SenML messages as parallel slices, one per
+// message field, so that the i-th element of each slice belongs to the
+// i-th message. Times are in nanoseconds since the epoch. Valid marks the
+// messages with numeric value, while the values of the rest are zero.
+// Absent text fields are empty strings.
+type Columns struct {
+	Times      []int64   `json:"times"`
+	Values     []float64 `json:"values"`
+	Valid      []bool    `json:"valid"`
+	Publishers []string  `json:"publishers"`
+	Subtopics  []string  `json:"subtopics"`
+	Names      []string  `json:"names"`
+	Units      []string  `json:"units"`
+}
+
+func (tr postgresRepository) ReadColumnar(chanID string, rpm readers.PageMetadata) (Columns, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return Columns{}, err
+	}
+	if !tr.senml[rpm.Format] {
+		return Columns{}, readers.ErrInvalidFormat
+	}
+	rpm.Limit = tr.limit(rpm.Limit)
+
+	order, err := tr.fmtOrder(rpm)
+	if err != nil {
+		return Columns{}, err
+	}
+
+	q := fmt.Sprintf(`SELECT time, value, COALESCE(CAST(publisher AS TEXT), ''), COALESCE(subtopic, ''),
+		COALESCE(name, ''), COALESCE(unit, '')
+	FROM %s WHERE %s AND %s ORDER BY %s
+	LIMIT :limit OFFSET :offset;`, tr.fmtSource(chanID, rpm), tr.condition(chanID, rpm), tr.fmtCursor(rpm), order)
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return Columns{}, readError(err)
+	}
+	defer rows.Close()
+
+	// Slices are allocated for the full page at once, unless
+	// the page is too large to be allocated ahead of reading.
+	size := rpm.Limit
+	if size > maxPrealloc {
+		size = maxPrealloc
+	}
+	cols := Columns{
+		Times:      make([]int64, 0, size),
+		Values:     make([]float64, 0, size),
+		Valid:      make([]bool, 0, size),
+		Publishers: make([]string, 0, size),
+		Subtopics:  make([]string, 0, size),
+		Names:      make([]string, 0, size),
+		Units:      make([]string, 0, size),
+	}
+	for rows.Next() {
+		var tm float64
+		var val sql.NullFloat64
+		var pub, sub, name, unit string
+		if err := rows.Scan(&tm, &val, &pub, &sub, &name, &unit); err != nil {
+			return Columns{}, errors.Wrap(errReadMessages, err)
+		}
+		cols.Times = append(cols.Times, int64(math.Round(tm*float64(time.Second))))
+		cols.Values = append(cols.Values, val.Float64)
+		cols.Valid = append(cols.Valid, val.Valid)
+		cols.Publishers = append(cols.Publishers, pub)
+		cols.Subtopics = append(cols.Subtopics, sub)
+		cols.Names = append(cols.Names, name)
+		cols.Units = append(cols.Units, unit)
+	}
+	if err := rows.Err(); err != nil {
+		return Columns{}, errors.Wrap(errReadMessages, err)
+	}
+
+	return cols, nil
+}
+
+// arrowSchema is the schema of the records ReadArrow reads, whose columns
+// match the Columns fields.
+var arrowSchema = arrow.Schema{
+	Fields: []arrow.Field{
+		{Name: "time", Type: arrow.Timestamp},
+		{Name: "value", Type: arrow.Float64, Nullable: true},
+		{Name: "publisher", Type: arrow.String},
+		{Name: "subtopic", Type: arrow.String},
+		{Name: "name", Type: arrow.String},
+		{Name: "unit", Type: arrow.String},
+	},
+}
+
+func (tr postgresRepository) ReadArrow(chanID string, rpm readers.PageMetadata) (arrow.Record, error) {
+	cols, err := tr.ReadColumnar(chanID, rpm)
+	if err != nil {
+		return arrow.Record{}, err
+	}
+
+	n := len(cols.Times)
+	times := arrow.NewTimestampBuilder(n)
+	values := arrow.NewFloat64Builder(n)
+	for i := 0; i < n; i++ {
+		times.Append(cols.Times[i])
+		if cols.Valid[i] {
+			values.Append(cols.Values[i])
+			continue
+		}
+		values.AppendNull()
+	}
+	columns := []arrow.Array{times.Array(), values.Array()}
+	for _, col := range [][]string{cols.Publishers, cols.Subtopics, cols.Names, cols.Units} {
+		b := arrow.NewStringBuilder(n)
+		for _, v := range col {
+			b.Append(v)
+		}
+		columns = append(columns, b.Array())
+	}
+
+	return arrow.NewRecord(arrowSchema, columns)
+}
@@ -0,0 +1,198 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pwriter "github.com/mainflux/mainflux/consumers/writers/postgres"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/arrow"
+	preader "github.com/mainflux/mainflux/readers/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadColumnar(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	publishers := []string{}
+	for i := 0; i < 2; i++ {
+		pubID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		publishers = append(publishers, pubID)
+	}
+
+	// Every fifth message carries string value only,
+	// so it's read into columns as invalid value.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 4*limit; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: publishers[i%len(publishers)],
+			Subtopic:  fmt.Sprintf("room%d", i%3),
+			Protocol:  mqttProt,
+			Name:      msgName,
+			Time:      now - float64(i),
+		}
+		if i%2 == 0 {
+			msg.Unit = "C"
+		}
+		switch i % 5 {
+		case 0:
+			msg.StringValue = &vs
+		default:
+			val := float64(i % 7)
+			msg.Value = &val
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		err      error
+	}{
+		"read columns": {
+			pageMeta: readers.PageMetadata{Limit: 4 * limit},
+		},
+		"read columns with offset and limit": {
+			pageMeta: readers.PageMetadata{Offset: 3, Limit: limit},
+		},
+		"read columns in ascending order": {
+			pageMeta: readers.PageMetadata{Limit: limit, Direction: readers.AscDirection},
+		},
+		"read columns sorted by value": {
+			pageMeta: readers.PageMetadata{Limit: 4 * limit, Sort: "value,time"},
+		},
+		"read columns of publisher": {
+			pageMeta: readers.PageMetadata{Limit: 4 * limit, Publisher: publishers[1]},
+		},
+		"read columns of subtopic within time window": {
+			pageMeta: readers.PageMetadata{Limit: 4 * limit, Subtopic: "room1", From: now - float64(2*limit)},
+		},
+		"read columns of JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			err:      readers.ErrInvalidFormat,
+		},
+		"read columns sorted by invalid column": {
+			pageMeta: readers.PageMetadata{Sort: "payload"},
+			err:      readers.ErrInvalidSort,
+		},
+	}
+
+	for desc, tc := range cases {
+		cols, err := reader.ReadColumnar(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+
+		// Columns are compared to the same page read as messages.
+		page, err := reader.ReadAll(chanID, tc.pageMeta)
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		expected := []senml.Message{}
+		for _, m := range page.Messages {
+			expected = append(expected, m.(senml.Message))
+		}
+		require.NotEmpty(t, expected, fmt.Sprintf("%s: expected messages to be read", desc))
+
+		for _, col := range []interface{}{cols.Times, cols.Values, cols.Valid, cols.Publishers, cols.Subtopics, cols.Names, cols.Units} {
+			require.Len(t, col, len(expected), fmt.Sprintf("%s: expected %d rows", desc, len(expected)))
+		}
+		for i, msg := range expected {
+			// Messages are stored with whole seconds time.
+			tm := int64(msg.Time) * int64(time.Second)
+			assert.Equal(t, tm, cols.Times[i], fmt.Sprintf("%s: unexpected time at row %d", desc, i))
+			assert.Equal(t, msg.Value != nil, cols.Valid[i], fmt.Sprintf("%s: unexpected value validity at row %d", desc, i))
+			if msg.Value != nil {
+				assert.Equal(t, *msg.Value, cols.Values[i], fmt.Sprintf("%s: unexpected value at row %d", desc, i))
+			} else {
+				assert.Equal(t, float64(0), cols.Values[i], fmt.Sprintf("%s: expected zero value at row %d", desc, i))
+			}
+			assert.Equal(t, msg.Publisher, cols.Publishers[i], fmt.Sprintf("%s: unexpected publisher at row %d", desc, i))
+			assert.Equal(t, msg.Subtopic, cols.Subtopics[i], fmt.Sprintf("%s: unexpected subtopic at row %d", desc, i))
+			assert.Equal(t, msg.Name, cols.Names[i], fmt.Sprintf("%s: unexpected name at row %d", desc, i))
+			assert.Equal(t, msg.Unit, cols.Units[i], fmt.Sprintf("%s: unexpected unit at row %d", desc, i))
+		}
+	}
+}
+
+func TestReadArrow(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Every third message carries string value only,
+	// so its value is read as null.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Subtopic:  fmt.Sprintf("room%d", i%2),
+			Protocol:  mqttProt,
+			Name:      msgName,
+			Unit:      "C",
+			Time:      now - float64(i),
+		}
+		if i%3 == 0 {
+			msg.StringValue = &vs
+		} else {
+			val := float64(i)
+			msg.Value = &val
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	_, err = reader.ReadArrow(chanID, readers.PageMetadata{Format: jsonFormat})
+	assert.Equal(t, readers.ErrInvalidFormat, err, fmt.Sprintf("expected %s got %s", readers.ErrInvalidFormat, err))
+
+	rec, err := reader.ReadArrow(chanID, readers.PageMetadata{Limit: limit})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	schema := arrow.Schema{
+		Fields: []arrow.Field{
+			{Name: "time", Type: arrow.Timestamp},
+			{Name: "value", Type: arrow.Float64, Nullable: true},
+			{Name: "publisher", Type: arrow.String},
+			{Name: "subtopic", Type: arrow.String},
+			{Name: "name", Type: arrow.String},
+			{Name: "unit", Type: arrow.String},
+		},
+	}
+	assert.Equal(t, schema, rec.Schema(), fmt.Sprintf("expected schema %v got %v", schema, rec.Schema()))
+	require.Equal(t, len(messages), rec.NumRows(), fmt.Sprintf("expected %d rows got %d", len(messages), rec.NumRows()))
+
+	times := rec.Column(0).(*arrow.TimestampArray)
+	values := rec.Column(1).(*arrow.Float64Array)
+	subtopics := rec.Column(3).(*arrow.StringArray)
+	// Messages are read in descending time order, as they are written.
+	for i, msg := range messages {
+		assert.Equal(t, int64(msg.Time)*int64(time.Second), times.Value(i), fmt.Sprintf("unexpected time at row %d", i))
+		assert.Equal(t, msg.Value == nil, values.IsNull(i), fmt.Sprintf("unexpected value validity at row %d", i))
+		if msg.Value != nil {
+			assert.Equal(t, *msg.Value, values.Value(i), fmt.Sprintf("unexpected value at row %d", i))
+		}
+		assert.Equal(t, msg.Subtopic, subtopics.Value(i), fmt.Sprintf("unexpected subtopic at row %d", i))
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import "sync"
+
+// Optional columns, which are looked up rather than expected to exist,
+// since they are added by migrations the reader doesn't own.
+const (
+	deletedColumn  = "deleted_at"
+	ingestedColumn = "ingested"
+)
+
+// columnCache caches which tables have the looked up columns, since table
+// layout is not expected to change while the service is running.
+type columnCache struct {
+	mu      sync.RWMutex
+	columns map[string]bool
+}
+
+func newColumnCache() *columnCache {
+	return &columnCache{columns: map[string]bool{}}
+}
+
+func (cc *columnCache) get(table, column string) (bool, bool) {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	exists, ok := cc.columns[table+"."+column]
+	return exists, ok
+}
+
+func (cc *columnCache) set(table, column string, exists bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.columns[table+"."+column] = exists
+}
+
+// detectColumn looks up the column of the table, unless it's already
+// known whether the table has it. Tables which don't exist yet are looked
+// up again, since they may be created with the column later on.
+func (tr postgresRepository) detectColumn(table, column string) (bool, error) {
+	if exists, ok := tr.columns.get(table, column); ok {
+		return exists, nil
+	}
+
+	q := `SELECT EXISTS (
+		SELECT 1 FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = $1
+	) AS table_exists, EXISTS (
+		SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2
+	) AS column_exists;`
+	var found struct {
+		Table  bool `db:"table_exists"`
+		Column bool `db:"column_exists"`
+	}
+	if err := tr.db.Get(&found, q, table, column); err != nil {
+		return false, readError(err)
+	}
+	exists := found.Column
+	if found.Table {
+		tr.columns.set(table, column, exists)
+	}
+
+	return exists, nil
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
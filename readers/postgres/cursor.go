@@ -0,0 +1,122 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/readers"
+)
+
+var _ readers.MessageCursor = (*messageCursor)(nil)
+
+type messageCursor struct {
+	rows      *sqlx.Rows
+	pm        readers.PageMetadata
+	senml     bool
+	unmarshal unmarshalFunc
+	msg       readers.Message
+	err       error
+}
+
+func (tr postgresRepository) Stream(chanID string, rpm readers.PageMetadata) (readers.MessageCursor, error) {
+	return tr.StreamContext(context.Background(), chanID, rpm)
+}
+
+func (tr postgresRepository) StreamContext(ctx context.Context, chanID string, rpm readers.PageMetadata) (readers.MessageCursor, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	order, err := tr.fmtOrder(rpm)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := tr.fmtColumns(rpm)
+	if err != nil {
+		return nil, err
+	}
+
+	page := `OFFSET :offset`
+	if rpm.Limit > 0 {
+		page = `LIMIT :limit OFFSET :offset`
+	}
+	// Messages are read from the same source and with the same columns
+	// as the page of messages, while total is never counted.
+	q := fmt.Sprintf(`SELECT %s FROM (
+		SELECT *, 0 AS total FROM %s WHERE %s AND %s
+	) AS streamed ORDER BY %s %s;`,
+		columns, tr.fmtSource(chanID, rpm), tr.condition(chanID, rpm), tr.fmtCursor(rpm), order, page)
+
+	rows, err := tr.namedQuery(ctx, q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, readError(err)
+	}
+
+	return &messageCursor{
+		rows:      rows,
+		pm:        rpm,
+		senml:     tr.senml[rpm.Format],
+		unmarshal: tr.unmarshal(rpm.Format),
+	}, nil
+}
+
+func (tr postgresRepository) StreamNDJSON(ctx context.Context, w io.Writer, chanID string, rpm readers.PageMetadata) error {
+	cursor, err := tr.StreamContext(ctx, chanID, rpm)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	// Encoder terminates each message with a newline.
+	enc := json.NewEncoder(w)
+	for cursor.Next() {
+		if err := enc.Encode(cursor.Message()); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func (mc *messageCursor) Next() bool {
+	if mc.err != nil || !mc.rows.Next() {
+		mc.msg = nil
+		return false
+	}
+
+	m, err := scanMessage(mc.rows, mc.pm, mc.senml, mc.unmarshal)
+	if err != nil {
+		mc.err = errors.Wrap(errReadMessages, err)
+		mc.msg = nil
+		return false
+	}
+	mc.msg = m.msg
+
+	return true
+}
+
+func (mc *messageCursor) Message() readers.Message {
+	return mc.msg
+}
+
+func (mc *messageCursor) Err() error {
+	if mc.err != nil {
+		return mc.err
+	}
+	if err := mc.rows.Err(); err != nil {
+		return errors.Wrap(errReadMessages, err)
+	}
+
+	return nil
+}
+
+func (mc *messageCursor) Close() error {
+	return mc.rows.Close()
+}
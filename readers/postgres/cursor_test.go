@@ -0,0 +1,240 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	pwriter "github.com/mainflux/mainflux/consumers/writers/postgres"
+	mfjson "github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	preader "github.com/mainflux/mainflux/readers/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	wrongID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are sorted from the newest to the oldest.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < benchMsgsNum; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		chanID   string
+		pageMeta readers.PageMetadata
+		first    int
+		count    int
+	}{
+		"stream all messages": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{},
+			count:    benchMsgsNum,
+		},
+		"stream limited number of messages": {
+			chanID: chanID,
+			pageMeta: readers.PageMetadata{
+				Offset: limit,
+				Limit:  limit,
+			},
+			first: limit,
+			count: limit,
+		},
+		"stream messages before cursor": {
+			chanID: chanID,
+			pageMeta: readers.PageMetadata{
+				Before: messages[limit-1].Time,
+			},
+			first: limit,
+			count: benchMsgsNum - limit,
+		},
+		"stream messages for non-existent channel": {
+			chanID:   wrongID,
+			pageMeta: readers.PageMetadata{},
+		},
+	}
+
+	for desc, tc := range cases {
+		cursor, err := reader.Stream(tc.chanID, tc.pageMeta)
+		require.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+
+		// Messages are compared one by one as they are read.
+		count := 0
+		for cursor.Next() {
+			expected := messages[tc.first+count]
+			assert.Equal(t, expected, cursor.Message(), fmt.Sprintf("%s: expected %v got %v", desc, expected, cursor.Message()))
+			count++
+		}
+		assert.Nil(t, cursor.Err(), fmt.Sprintf("%s: expected no error got %s", desc, cursor.Err()))
+		assert.Equal(t, tc.count, count, fmt.Sprintf("%s: expected %d messages got %d", desc, tc.count, count))
+		assert.Nil(t, cursor.Message(), fmt.Sprintf("%s: expected no message after the last one", desc))
+		err = cursor.Close()
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+	}
+}
+
+func TestStreamReadAll(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Each message is stored twice, in Kelvin.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(273 + i)
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Unit:      "K",
+			Time:      now - float64(i),
+			Value:     &val,
+		}
+		messages = append(messages, msg, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]readers.PageMetadata{
+		"stream deduplicated messages":       {Dedup: true},
+		"stream messages with columns":       {Columns: []string{"publisher", "value"}},
+		"stream messages with normalization": {NormalizeUnit: "Cel"},
+		"stream messages with all the options": {
+			Dedup:         true,
+			Columns:       []string{"time", "value", "unit"},
+			NormalizeUnit: "Cel",
+		},
+	}
+
+	for desc, pm := range cases {
+		pm.Limit = 2 * limit
+		page, err := reader.ReadAll(chanID, pm)
+		require.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+
+		cursor, err := reader.Stream(chanID, pm)
+		require.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		streamed := []readers.Message{}
+		for cursor.Next() {
+			streamed = append(streamed, cursor.Message())
+		}
+		assert.Nil(t, cursor.Err(), fmt.Sprintf("%s: expected no error got %s", desc, cursor.Err()))
+		assert.Nil(t, cursor.Close(), fmt.Sprintf("%s: expected no error closing cursor", desc))
+		assert.ElementsMatch(t, page.Messages, streamed, fmt.Sprintf("%s: expected %v got %v", desc, page.Messages, streamed))
+	}
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are sorted from the newest to the oldest.
+	senmlMsgs := []senml.Message{}
+	jsonMsgs := []mfjson.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		senmlMsgs = append(senmlMsgs, senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Name:      msgName,
+			Time:      now - float64(i),
+			Value:     &v,
+		})
+		jsonMsgs = append(jsonMsgs, mfjson.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Created:   int64(now) - int64(i),
+			Payload:   map[string]interface{}{"index": float64(i), "nested": map[string]interface{}{"ok": true}},
+		})
+	}
+	err = writer.Consume(senmlMsgs)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+	err = writer.Consume(mfjson.Messages{Data: jsonMsgs, Format: jsonFormat})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	// SenML messages are decoded into messages and compared directly.
+	buf := &bytes.Buffer{}
+	err = reader.StreamNDJSON(context.Background(), buf, chanID, readers.PageMetadata{})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	scanner := bufio.NewScanner(buf)
+	count := 0
+	for scanner.Scan() {
+		var msg senml.Message
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		require.Nil(t, err, fmt.Sprintf("line %d: expected valid JSON got %s", count, err))
+		assert.Equal(t, senmlMsgs[count], msg, fmt.Sprintf("line %d: expected %v got %v", count, senmlMsgs[count], msg))
+		count++
+	}
+	assert.Equal(t, len(senmlMsgs), count, fmt.Sprintf("expected %d lines got %d", len(senmlMsgs), count))
+
+	// JSON messages are decoded into maps, with numbers decoded as floats.
+	buf.Reset()
+	err = reader.StreamNDJSON(context.Background(), buf, chanID, readers.PageMetadata{Format: jsonFormat})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	scanner = bufio.NewScanner(buf)
+	count = 0
+	for scanner.Scan() {
+		var msg map[string]interface{}
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		require.Nil(t, err, fmt.Sprintf("line %d: expected valid JSON got %s", count, err))
+		delete(msg, "id")
+		expected := map[string]interface{}{
+			"channel":   chanID,
+			"created":   float64(jsonMsgs[count].Created),
+			"subtopic":  "",
+			"publisher": pubID,
+			"protocol":  mqttProt,
+			"payload":   map[string]interface{}(jsonMsgs[count].Payload),
+		}
+		assert.Equal(t, expected, msg, fmt.Sprintf("line %d: expected %v got %v", count, expected, msg))
+		count++
+	}
+	assert.Equal(t, len(jsonMsgs), count, fmt.Sprintf("expected %d lines got %d", len(jsonMsgs), count))
+
+	// Invalid page metadata fails before anything is written.
+	buf.Reset()
+	err = reader.StreamNDJSON(context.Background(), buf, chanID, readers.PageMetadata{Format: "pg_user"})
+	assert.Equal(t, readers.ErrInvalidFormat, err, fmt.Sprintf("expected %s got %s", readers.ErrInvalidFormat, err))
+	assert.Equal(t, 0, buf.Len(), fmt.Sprintf("expected empty output got %s", buf.String()))
+}
@@ -0,0 +1,40 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"github.com/lib/pq"
+	"github.com/mainflux/mainflux/pkg/errors"
+)
+
+var _ errors.Error = (*QueryError)(nil)
+
+// QueryError is a failure to read messages reported by the database.
+// It carries SQLSTATE code of the failure, so that callers can tell
+// e.g. an undefined column from a connection error.
+type QueryError struct {
+	pqErr *pq.Error
+}
+
+// Code returns SQLSTATE code of the failure.
+func (qe *QueryError) Code() string {
+	return string(qe.pqErr.Code)
+}
+
+func (qe *QueryError) Error() string {
+	return qe.Msg() + " : " + qe.pqErr.Error()
+}
+
+func (qe *QueryError) Msg() string {
+	return errReadMessages.Msg()
+}
+
+func (qe *QueryError) Err() errors.Error {
+	return errors.New(qe.pqErr.Error())
+}
+
+// Unwrap returns the underlying database error.
+func (qe *QueryError) Unwrap() error {
+	return qe.pqErr
+}
@@ -4,69 +4,626 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx" // required for DB access
+	"github.com/lib/pq"
 	"github.com/mainflux/mainflux/pkg/errors"
 	jsont "github.com/mainflux/mainflux/pkg/transformers/json"
 	"github.com/mainflux/mainflux/pkg/transformers/senml"
 	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/arrow"
 )
 
-const errInvalid = "invalid_text_representation"
+const (
+	errInvalid        = "invalid_text_representation"
+	errUndefinedTable = "undefined_table"
+)
 
 const (
 	format = "format"
 	// Table for SenML messages
 	defTable = "messages"
+	// Page size used if page limit is not set
+	defLimit = 10
+	// Separator of the flattened JSON payload keys
+	payloadSep = "/"
+)
+
+var (
+	errReadMessages   = errors.New("failed to read messages from postgres database")
+	errDeleteMessages = errors.New("failed to delete messages from postgres database")
+	errPing           = errors.New("failed to ping postgres database")
+)
+
+var (
+	// Columns SenML messages can be sorted by.
+	senmlOrder = map[string]bool{
+		"time":        true,
+		"update_time": true,
+		"value":       true,
+		"sum":         true,
+		"name":        true,
+		"unit":        true,
+		"publisher":   true,
+		"subtopic":    true,
+		"protocol":    true,
+	}
+
+	// Columns JSON messages can be sorted by.
+	jsonOrder = map[string]bool{
+		"created":   true,
+		"publisher": true,
+		"subtopic":  true,
+		"protocol":  true,
+	}
+
+	// Columns SenML messages can be projected to.
+	senmlColumns = map[string]bool{
+		"id":           true,
+		"channel":      true,
+		"subtopic":     true,
+		"publisher":    true,
+		"protocol":     true,
+		"name":         true,
+		"unit":         true,
+		"value":        true,
+		"string_value": true,
+		"bool_value":   true,
+		"data_value":   true,
+		"sum":          true,
+		"time":         true,
+		"update_time":  true,
+		"ingested":     true,
+	}
+
+	// Columns JSON messages can be projected to.
+	jsonColumns = map[string]bool{
+		"id":        true,
+		"channel":   true,
+		"created":   true,
+		"subtopic":  true,
+		"publisher": true,
+		"protocol":  true,
+		"payload":   true,
+	}
+
+	// Escapes LIKE pattern wildcards, so user input is matched literally.
+	likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+	// SQL operators used to compare message value.
+	comparators = map[string]string{
+		"":                          "=",
+		readers.EqualKey:            "=",
+		readers.GreaterThanKey:      ">",
+		readers.GreaterThanEqualKey: ">=",
+		readers.LowerThanKey:        "<",
+		readers.LowerThanEqualKey:   "<=",
+		readers.NotEqualKey:         "<>",
+	}
+
+	// SQL operators comparing message value to zero.
+	signs = map[string]string{
+		"":                   "",
+		readers.PositiveSign: ">",
+		readers.NegativeSign: "<",
+		readers.ZeroSign:     "=",
+	}
 )
 
-var errReadMessages = errors.New("failed to read messages from postgres database")
+var _ Repository = (*postgresRepository)(nil)
+
+// Repository specifies PostgreSQL message reader API. It extends generic
+// message repository with queries specific to PostgreSQL.
+type Repository interface {
+	readers.MessageRepository
+
+	// ReadAllContext is ReadAll which aborts the queries when the given
+	// context is done.
+	ReadAllContext(ctx context.Context, chanID string, pm readers.PageMetadata) (readers.MessagesPage, error)
+
+	// ReadLast retrieves the n newest messages that match the given page
+	// metadata. Page limit, offset, cursor and order are overridden.
+	ReadLast(chanID string, n uint64, pm readers.PageMetadata) (readers.MessagesPage, error)
+
+	// ReadGroupedBySubtopic retrieves the page of messages that match the
+	// given page metadata, grouped by their subtopic. Messages of each
+	// subtopic keep the page order.
+	ReadGroupedBySubtopic(chanID string, pm readers.PageMetadata) (map[string][]readers.Message, error)
+
+	// FirstPerPublisher retrieves up to n oldest messages of each publisher
+	// that match the given page metadata, ordered by publisher and time.
+	FirstPerPublisher(chanID string, pm readers.PageMetadata, n int) ([]readers.Message, error)
+
+	// ReadColumnar retrieves the page of SenML messages that match the given
+	// page metadata, with each field of the messages gathered in its own
+	// slice. Page consists of the same messages ReadAll reads, sorted the
+	// same way.
+	ReadColumnar(chanID string, pm readers.PageMetadata) (Columns, error)
+
+	// ReadArrow retrieves the same page ReadColumnar does as an Arrow
+	// record, with a typed column per message field, so that it can be
+	// handed off to analytics engines. Missing values are nulls.
+	ReadArrow(chanID string, pm readers.PageMetadata) (arrow.Record, error)
+
+	// BuildQuery returns the query and its named parameters ReadAll runs
+	// to read the given page, without running it.
+	BuildQuery(chanID string, pm readers.PageMetadata) (string, map[string]interface{}, error)
+
+	// Explain returns JSON formatted plan of the query ReadAll runs to read
+	// the given page, so that index usage can be verified.
+	Explain(chanID string, pm readers.PageMetadata) (string, error)
+
+	// Aggregate applies aggregate function specified in page metadata to
+	// values of the messages that match the given page metadata. If there
+	// are no such messages, zero is returned.
+	Aggregate(chanID string, pm readers.PageMetadata) (float64, error)
+
+	// DistinctValueCount returns number of distinct values of the messages
+	// that match the given page metadata. Messages without value are not
+	// counted.
+	DistinctValueCount(chanID string, pm readers.PageMetadata) (uint64, error)
+
+	// AggregatePercentile returns continuous percentile p, within [0, 1]
+	// range, of values of the messages that match the given page metadata.
+	// If there are no such messages, zero is returned.
+	AggregatePercentile(chanID string, pm readers.PageMetadata, p float64) (float64, error)
+
+	// AggregatePercentileByInterval returns continuous percentile p, within
+	// [0, 1] range, of values of the messages that match the given page
+	// metadata received within each of the calendar intervals the same way
+	// CountByInterval splits them. Intervals without messages are omitted.
+	AggregatePercentileByInterval(chanID string, pm readers.PageMetadata, p float64, interval string) ([]PercentilePoint, error)
+
+	// AggregateByPublisher applies aggregate function specified in page
+	// metadata to values of each publisher messages that match the given
+	// page metadata. Publishers with no such messages are omitted.
+	AggregateByPublisher(chanID string, pm readers.PageMetadata) (map[string]float64, error)
 
-var _ readers.MessageRepository = (*postgresRepository)(nil)
+	// AggregateBySubtopic applies aggregate function specified in page
+	// metadata to values of each subtopic messages that match the given
+	// page metadata. Subtopics with no such messages are omitted.
+	AggregateBySubtopic(chanID string, pm readers.PageMetadata) (map[string]float64, error)
+
+	// SubtopicsAboveThreshold returns sorted list of non-empty subtopics
+	// whose messages that match the given page metadata have average value
+	// greater than the threshold.
+	SubtopicsAboveThreshold(chanID string, threshold float64, pm readers.PageMetadata) ([]string, error)
+
+	// CountByProtocol returns number of messages that match the given page
+	// metadata for each protocol they were received over. Protocols without
+	// such messages are omitted.
+	CountByProtocol(chanID string, pm readers.PageMetadata) (map[string]uint64, error)
+
+	// StreamBuckets emits value statistics of the bucket of the given
+	// interval length on each tick of that interval, once the bucket is
+	// complete. Buckets are aligned the same way ReadAggregated aligns them,
+	// and page metadata interval and time range are overridden. Buckets
+	// which failed to be read are emitted on the next tick, so emitted
+	// buckets follow each other. Channel is closed once the context is done.
+	StreamBuckets(ctx context.Context, chanID string, pm readers.PageMetadata, interval time.Duration) (<-chan Bucket, error)
+
+	// CountByPayloadField returns number of JSON messages that match the
+	// given page metadata for each value of the payload field. Nested
+	// fields are referred to by their flattened key, such as "sensor/status".
+	// Messages without the field, or with null field, are not counted.
+	CountByPayloadField(chanID, field string, pm readers.PageMetadata) (map[string]uint64, error)
+
+	// ReadAggregated splits time range specified in page metadata into
+	// buckets of page metadata interval length and returns value statistics
+	// of each bucket. If time range is open, it is bounded by the oldest
+	// and the newest message. Buckets are aligned to the epoch in page
+	// metadata time zone, using its offset from UTC at the time range start,
+	// so that daily buckets start at the local midnight.
+	ReadAggregated(chanID string, pm readers.PageMetadata) (AggregatedPage, error)
+
+	// CountByInterval returns number of messages that match the given page
+	// metadata received within each of the calendar intervals (such as
+	// "hour" or "day") of the time range. Intervals are aligned in page
+	// metadata time zone, UTC by default. Intervals without messages are
+	// reported with zero count.
+	CountByInterval(chanID string, pm readers.PageMetadata, interval string) ([]IntervalCount, error)
+
+	// MissingIntervals returns start times of the calendar intervals of
+	// the time range, split the same way CountByInterval splits them,
+	// within which no message matching the given page metadata was received.
+	MissingIntervals(chanID string, pm readers.PageMetadata, interval string) ([]time.Time, error)
+
+	// ReadMovingAverage returns values of the messages that match the
+	// given page metadata, each averaged with up to window preceding
+	// values. Points are sorted by time, from the oldest to the newest.
+	ReadMovingAverage(chanID string, pm readers.PageMetadata, window int) ([]AggPoint, error)
+
+	// ReadDeltas returns differences between values of the consecutive
+	// messages that match the given page metadata. Points are sorted by
+	// time, from the oldest to the newest.
+	ReadDeltas(chanID string, pm readers.PageMetadata) ([]DeltaPoint, error)
+
+	// Stream returns cursor over all the messages that match the given page
+	// metadata. Page limit and offset are applied only if set.
+	Stream(chanID string, pm readers.PageMetadata) (readers.MessageCursor, error)
+
+	// StreamContext is Stream which aborts reading when the given context
+	// is done.
+	StreamContext(ctx context.Context, chanID string, pm readers.PageMetadata) (readers.MessageCursor, error)
+
+	// StreamNDJSON writes the messages that match the given page metadata
+	// to the writer as newline-delimited JSON, one message per line, as
+	// they are read from the database.
+	StreamNDJSON(ctx context.Context, w io.Writer, chanID string, pm readers.PageMetadata) error
+
+	// DeleteAll removes messages that match the given page metadata and
+	// returns number of removed messages. Page limit and offset are not
+	// applied. Page metadata with no filters removes all the channel
+	// messages, so it has to be forced explicitly.
+	DeleteAll(chanID string, pm readers.PageMetadata) (uint64, error)
+
+	// DeleteByIDs removes the channel messages with the given IDs from all
+	// the allowed message tables at once and returns number of removed
+	// messages. No messages are removed if no IDs are given, or if any of
+	// them is malformed.
+	DeleteByIDs(chanID string, ids []string) (uint64, error)
+
+	// Subtopics returns sorted list of distinct non-empty subtopics of the
+	// channel messages stored in all the known tables. Subtopics of the
+	// soft-deleted messages are not returned.
+	Subtopics(chanID string) ([]string, error)
+
+	// Publishers returns sorted list of distinct publishers of the messages
+	// that match the given page metadata.
+	Publishers(chanID string, pm readers.PageMetadata) ([]string, error)
+
+	// Counts returns number of messages of each of the given channels that
+	// match the given page metadata. Channels without such messages are
+	// counted as zero.
+	Counts(channels []string, pm readers.PageMetadata) (map[string]uint64, error)
+
+	// TimeSpan returns time of the oldest and the newest message that match
+	// the given page metadata. If there are no such messages, zero times
+	// are returned.
+	TimeSpan(chanID string, pm readers.PageMetadata) (time.Time, time.Time, error)
+
+	// Exists checks whether any of the messages match the given page
+	// metadata, without reading or counting them.
+	Exists(chanID string, pm readers.PageMetadata) (bool, error)
+
+	// StorageBytes returns approximate number of bytes the channel messages
+	// take in all the allowed message tables. It sums the sizes of the
+	// stored rows, which excludes indexes and table storage overhead.
+	StorageBytes(chanID string) (uint64, error)
+
+	// Latest returns the newest message that matches the given page
+	// metadata. If there is no such message, ErrNotFound is returned.
+	Latest(chanID string, pm readers.PageMetadata) (readers.Message, error)
+
+	// LatestMany returns the newest message of each of the given channels
+	// that matches the given page metadata. Channels without such messages
+	// are omitted.
+	LatestMany(channels []string, pm readers.PageMetadata) (map[string]readers.Message, error)
+
+	// Message returns the channel message with the given ID, read from the
+	// table of page metadata format. Soft-deleted message is returned only
+	// if page metadata includes deleted messages, while other page metadata
+	// fields are not applied. If there is no such message, ErrNotFound is
+	// returned.
+	Message(chanID, id string, pm readers.PageMetadata) (readers.Message, error)
+
+	// Ping checks that the database is reachable within the given
+	// context deadline.
+	Ping(ctx context.Context) error
+}
 
 type postgresRepository struct {
-	db *sqlx.DB
+	db        *sqlx.DB
+	replica   *sqlx.DB
+	formats   map[string]bool
+	senml     map[string]bool
+	cbor      map[string]bool
+	defFormat string
+	stmts     *stmtCache
+	reads     chan struct{}
+	columns   *columnCache
+	maxLimit  uint64
+	timeout   time.Duration
+	attempts  int
+	backoff   time.Duration
+}
+
+// unmarshalFunc decodes stored message payload.
+type unmarshalFunc func(data []byte, v interface{}) error
+
+// Option configures PostgreSQL message repository.
+type Option func(*postgresRepository)
+
+// WithFormats registers tables created by the JSON transformer, which are
+// allowed to be read in addition to the SenML messages table.
+func WithFormats(formats ...string) Option {
+	return func(tr *postgresRepository) {
+		for _, f := range formats {
+			tr.formats[f] = true
+		}
+	}
+}
+
+// WithSenMLFormats registers tables with the same layout as the SenML
+// messages table, which are read as SenML messages.
+func WithSenMLFormats(formats ...string) Option {
+	return func(tr *postgresRepository) {
+		for _, f := range formats {
+			tr.formats[f] = true
+			tr.senml[f] = true
+		}
+	}
+}
+
+// WithCBORFormats registers tables with the same layout as the JSON
+// transformer tables, which store CBOR encoded payload into BYTEA column.
+// Payload filters are not applied to these tables.
+func WithCBORFormats(formats ...string) Option {
+	return func(tr *postgresRepository) {
+		for _, f := range formats {
+			tr.formats[f] = true
+			tr.cbor[f] = true
+		}
+	}
+}
+
+// WithDefaultTable sets the table messages are read from if page metadata
+// doesn't specify the format. The table must be one of the allowed formats,
+// otherwise reading messages without the format fails. SenML tables other
+// than the messages table must be registered using WithSenMLFormats.
+func WithDefaultTable(name string) Option {
+	return func(tr *postgresRepository) {
+		tr.defFormat = name
+	}
+}
+
+// WithMaxLimit sets the maximum number of messages read at once. Greater
+// page limits are reduced to it.
+func WithMaxLimit(limit uint64) Option {
+	return func(tr *postgresRepository) {
+		tr.maxLimit = limit
+	}
+}
+
+// WithStatementTimeout aborts read, such as reading messages page or
+// aggregating values, if it takes longer than the given timeout, regardless
+// of the context deadline. Streams are not affected, as they are expected
+// to be long running.
+func WithStatementTimeout(timeout time.Duration) Option {
+	return func(tr *postgresRepository) {
+		tr.timeout = timeout
+	}
+}
+
+// WithMaxOpenConns limits the number of open connections to the database
+// and its replica.
+func WithMaxOpenConns(n int) Option {
+	return func(tr *postgresRepository) {
+		for _, db := range tr.pools() {
+			db.SetMaxOpenConns(n)
+		}
+	}
+}
+
+// WithMaxIdleConns limits the number of idle connections kept in the pool
+// of the database and its replica.
+func WithMaxIdleConns(n int) Option {
+	return func(tr *postgresRepository) {
+		for _, db := range tr.pools() {
+			db.SetMaxIdleConns(n)
+		}
+	}
+}
+
+// WithConnMaxLifetime closes connections to the database and its replica
+// once they are reused for longer than the given duration.
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(tr *postgresRepository) {
+		for _, db := range tr.pools() {
+			db.SetConnMaxLifetime(d)
+		}
+	}
 }
 
 // New returns new PostgreSQL writer.
-func New(db *sqlx.DB) readers.MessageRepository {
-	return &postgresRepository{
-		db: db,
+func New(db *sqlx.DB, opts ...Option) Repository {
+	return newRepository(db, nil, opts...)
+}
+
+// NewWithReplica returns new PostgreSQL reader which reads messages from
+// the replica database, while messages are deleted from the primary one.
+// If replica is nil, the primary database is used for reading as well.
+func NewWithReplica(db, replica *sqlx.DB, opts ...Option) Repository {
+	return newRepository(db, replica, opts...)
+}
+
+func newRepository(db, replica *sqlx.DB, opts ...Option) *postgresRepository {
+	tr := &postgresRepository{
+		db:        db,
+		replica:   replica,
+		formats:   map[string]bool{defTable: true},
+		senml:     map[string]bool{defTable: true},
+		cbor:      map[string]bool{},
+		defFormat: defTable,
+		columns:   newColumnCache(),
 	}
+	for _, opt := range opts {
+		opt(tr)
+	}
+
+	return tr
 }
 
 func (tr postgresRepository) ReadAll(chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
-	order := "created"
-	if rpm.Format == "" {
-		order = "time"
-		rpm.Format = defTable
+	return tr.ReadAllContext(context.Background(), chanID, rpm)
+}
+
+func (tr postgresRepository) ReadAllContext(ctx context.Context, chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	if err := tr.acquire(ctx); err != nil {
+		return readers.MessagesPage{}, err
+	}
+	defer tr.release()
+
+	if tr.timeout <= 0 {
+		return tr.readAll(ctx, chanID, rpm)
 	}
 
-	q := fmt.Sprintf(`SELECT * FROM %s
-    WHERE %s ORDER BY %s DESC
-	LIMIT :limit OFFSET :offset;`, rpm.Format, fmtCondition(chanID, rpm), order)
+	qctx, cancel := context.WithTimeout(ctx, tr.timeout)
+	defer cancel()
 
-	params := map[string]interface{}{
-		"channel":      chanID,
-		"limit":        rpm.Limit,
-		"offset":       rpm.Offset,
-		"subtopic":     rpm.Subtopic,
-		"publisher":    rpm.Publisher,
-		"name":         rpm.Name,
-		"protocol":     rpm.Protocol,
-		"value":        rpm.Value,
-		"bool_value":   rpm.BoolValue,
-		"string_value": rpm.StringValue,
-		"data_value":   rpm.DataValue,
-		"from":         rpm.From,
-		"to":           rpm.To,
-	}
-
-	rows, err := tr.db.NamedQuery(q, params)
+	page, err := tr.readAll(qctx, chanID, rpm)
+	// Expired parent context is reported as is, since
+	// it's not the statement timeout that aborted query.
+	if err != nil && qctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return readers.MessagesPage{}, readers.ErrQueryTimeout
+	}
+
+	return page, err
+}
+
+func (tr postgresRepository) ReadLast(chanID string, n uint64, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	rpm.Limit = n
+	rpm.Offset = 0
+	rpm.Before = 0
+	rpm.After = 0
+	rpm.PageToken = ""
+	rpm.Sort = ""
+	rpm.Direction = readers.DescDirection
+
+	return tr.ReadAll(chanID, rpm)
+}
+
+func (tr postgresRepository) ReadGroupedBySubtopic(chanID string, rpm readers.PageMetadata) (map[string][]readers.Message, error) {
+	page, err := tr.ReadAll(chanID, rpm)
 	if err != nil {
-		return readers.MessagesPage{}, errors.Wrap(errReadMessages, err)
+		return nil, err
+	}
+
+	groups := map[string][]readers.Message{}
+	for _, msg := range page.Messages {
+		subtopic := ""
+		switch m := msg.(type) {
+		case senml.Message:
+			subtopic = m.Subtopic
+		case IngestedMessage:
+			subtopic = m.Subtopic
+		case map[string]interface{}:
+			subtopic, _ = m[fieldName(rpm, "subtopic")].(string)
+		}
+		groups[subtopic] = append(groups[subtopic], msg)
+	}
+
+	return groups, nil
+}
+
+func (tr postgresRepository) FirstPerPublisher(chanID string, rpm readers.PageMetadata, n int) ([]readers.Message, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	// Ranked messages are selected by ID, so that the row
+	// number isn't scanned along with the message columns.
+	tc := tr.timeColumn(rpm.Format)
+	q := fmt.Sprintf(`SELECT * FROM %s WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY publisher ORDER BY %s ASC, id ASC) AS rank
+			FROM %s WHERE %s
+		) AS ranked WHERE rank <= :n
+	) ORDER BY publisher, %s ASC, id ASC;`, rpm.Format, tc, rpm.Format, tr.condition(chanID, rpm), tc)
+	params := fmtParams(chanID, rpm)
+	params["n"] = n
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		return nil, readError(err)
+	}
+	defer rows.Close()
+
+	messages := []readers.Message{}
+	for rows.Next() {
+		m, err := scanMessage(rows.Rows, rpm, tr.senml[rpm.Format], tr.unmarshal(rpm.Format))
+		if err != nil {
+			return nil, errors.Wrap(errReadMessages, err)
+		}
+		messages = append(messages, m.msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errReadMessages, err)
+	}
+
+	return messages, nil
+}
+
+func (tr postgresRepository) BuildQuery(chanID string, rpm readers.PageMetadata) (string, map[string]interface{}, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return "", nil, err
+	}
+	rpm.Limit = tr.limit(rpm.Limit)
+
+	q, err := tr.fmtReadQuery(chanID, rpm)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return q, fmtParams(chanID, rpm), nil
+}
+
+func (tr postgresRepository) Explain(chanID string, rpm readers.PageMetadata) (string, error) {
+	q, params, err := tr.BuildQuery(chanID, rpm)
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := tr.readQuery(`EXPLAIN (FORMAT JSON) `+q, params)
+	if err != nil {
+		return "", readError(err)
+	}
+	defer rows.Close()
+
+	var plan string
+	if rows.Next() {
+		if err := rows.Scan(&plan); err != nil {
+			return "", errors.Wrap(errReadMessages, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", errors.Wrap(errReadMessages, err)
+	}
+
+	return plan, nil
+}
+
+func (tr postgresRepository) readAll(ctx context.Context, chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return readers.MessagesPage{}, err
+	}
+	// Applied limit is returned in the page metadata.
+	rpm.Limit = tr.limit(rpm.Limit)
+
+	q, err := tr.fmtReadQuery(chanID, rpm)
+	if err != nil {
+		return readers.MessagesPage{}, err
+	}
+	// Separately calculated totals are not affected by the page cursor.
+	crpm := rpm
+	crpm.Before, crpm.After, crpm.PageToken = 0, 0, ""
+
+	params := fmtParams(chanID, rpm)
+
+	rows, err := tr.namedQuery(ctx, q, params)
+	if err != nil {
+		return readers.MessagesPage{}, readError(err)
 	}
 	defer rows.Close()
 
@@ -74,112 +631,1356 @@ func (tr postgresRepository) ReadAll(chanID string, rpm readers.PageMetadata) (r
 		PageMetadata: rpm,
 		Messages:     []readers.Message{},
 	}
-	switch rpm.Format {
-	case defTable:
-		for rows.Next() {
-			msg := dbMessage{Message: senml.Message{}}
-			if err := rows.StructScan(&msg); err != nil {
-				return readers.MessagesPage{}, errors.Wrap(errReadMessages, err)
-			}
+	var cursor float64
+	var last pageToken
+	for rows.Next() {
+		m, err := scanMessage(rows, rpm, tr.senml[rpm.Format], tr.unmarshal(rpm.Format))
+		if err != nil {
+			return readers.MessagesPage{}, errors.Wrap(errReadMessages, err)
+		}
+
+		page.Messages = append(page.Messages, m.msg)
+		page.Total = m.total
+		cursor = m.time
+		last = pageToken{Time: m.time, ID: m.id}
+	}
+	if err := rows.Err(); err != nil {
+		return readers.MessagesPage{}, errors.Wrap(errReadMessages, err)
+	}
 
-			page.Messages = append(page.Messages, msg.Message)
+	// Full page indicates that there may be more messages
+	// past the last one, so cursor to them is returned.
+	if rpm.Limit > 0 && uint64(len(page.Messages)) == rpm.Limit {
+		page.Cursor = cursor
+		if tr.timeSorted(rpm) {
+			page.NextPageToken = encodePageToken(last)
 		}
-	default:
-		for rows.Next() {
-			msg := jsonMessage{}
-			if err := rows.StructScan(&msg); err != nil {
-				return readers.MessagesPage{}, errors.Wrap(errReadMessages, err)
-			}
-			m, err := msg.toMap()
-			if err != nil {
-				return readers.MessagesPage{}, errors.Wrap(errReadMessages, err)
-			}
-			m["payload"] = jsont.ParseFlat(m["payload"])
-			page.Messages = append(page.Messages, m)
+	}
+
+	// Empty page which skips no messages shows that none of the messages
+	// match, so the total is known to be zero without counting them.
+	skipped := rpm.Offset > 0 || hasCursor(rpm)
+	if len(page.Messages) == 0 && !skipped {
+		return page, nil
+	}
+
+	if rpm.CountMode == readers.EstimateCount {
+		total, err := tr.estimate(ctx, chanID, crpm)
+		if err != nil {
+			return readers.MessagesPage{}, err
 		}
+		page.Total = total
+		page.Estimated = true
+
+		return page, nil
+	}
 
+	// Page past the last message or the cursor carries
+	// no total, so it has to be counted separately.
+	if len(page.Messages) == 0 || hasCursor(rpm) {
+		total, err := tr.count(ctx, chanID, crpm)
+		if err != nil {
+			return readers.MessagesPage{}, err
+		}
+		page.Total = total
 	}
 
-	q = fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s;`, rpm.Format, fmtCondition(chanID, rpm))
-	rows, err = tr.db.NamedQuery(q, params)
+	return page, nil
+}
+
+func (tr postgresRepository) count(ctx context.Context, chanID string, rpm readers.PageMetadata) (uint64, error) {
+	q := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s;`, tr.fmtSource(chanID, rpm), tr.condition(chanID, rpm))
+	rows, err := tr.namedQuery(ctx, q, fmtParams(chanID, rpm))
 	if err != nil {
-		return readers.MessagesPage{}, errors.Wrap(errReadMessages, err)
+		return 0, readError(err)
 	}
 	defer rows.Close()
 
 	total := uint64(0)
 	if rows.Next() {
 		if err := rows.Scan(&total); err != nil {
-			return page, err
+			return 0, errors.Wrap(errReadMessages, err)
 		}
 	}
-	page.Total = total
 
-	return page, nil
+	return total, nil
+}
+
+func (tr postgresRepository) DeleteAll(chanID string, rpm readers.PageMetadata) (uint64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return 0, err
+	}
+
+	cond := tr.fmtCondition(chanID, rpm)
+	if cond == tr.fmtCondition(chanID, readers.PageMetadata{Channels: rpm.Channels}) && !rpm.Force {
+		return 0, readers.ErrUnfilteredDelete
+	}
+
+	q := fmt.Sprintf(`DELETE FROM %s WHERE %s;`, rpm.Format, cond)
+	res, err := tr.db.NamedExec(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return 0, errors.Wrap(errDeleteMessages, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(errDeleteMessages, err)
+	}
+
+	return uint64(n), nil
 }
 
-func fmtCondition(chanID string, rpm readers.PageMetadata) string {
-	condition := `channel = :channel`
+func (tr postgresRepository) DeleteByIDs(chanID string, ids []string) (uint64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	for _, id := range ids {
+		if _, err := uuid.FromString(id); err != nil {
+			return 0, readers.ErrInvalidMessageID
+		}
+	}
 
-	var query map[string]interface{}
-	meta, err := json.Marshal(rpm)
+	tx, err := tr.db.Beginx()
 	if err != nil {
-		return condition
+		return 0, errors.Wrap(errDeleteMessages, err)
+	}
+
+	params := map[string]interface{}{
+		"channel": chanID,
+		"ids":     pq.Array(ids),
 	}
-	json.Unmarshal(meta, &query)
+	var total uint64
+	for format := range tr.formats {
+		// Failed statement aborts the transaction, unless it's
+		// rolled back to the savepoint preceding it.
+		if _, err := tx.Exec(`SAVEPOINT delete_by_ids;`); err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(errDeleteMessages, err)
+		}
+		q := fmt.Sprintf(`DELETE FROM %s WHERE channel = :channel AND id = ANY(CAST(:ids AS UUID[]));`, format)
+		res, err := tx.NamedExec(q, params)
+		if err != nil {
+			// Table of allowed format may not be created yet.
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == errUndefinedTable {
+				if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT delete_by_ids;`); err != nil {
+					tx.Rollback()
+					return 0, errors.Wrap(errDeleteMessages, err)
+				}
+				continue
+			}
+			tx.Rollback()
+			return 0, errors.Wrap(errDeleteMessages, err)
+		}
 
-	for name := range query {
-		switch name {
-		case
-			"subtopic",
-			"publisher",
-			"name",
-			"protocol":
-			condition = fmt.Sprintf(`%s AND %s = :%s`, condition, name, name)
-		case "v":
-			condition = fmt.Sprintf(`%s AND value = :value`, condition)
-		case "vb":
-			condition = fmt.Sprintf(`%s AND bool_value = :bool_value`, condition)
-		case "vs":
-			condition = fmt.Sprintf(`%s AND string_value = :string_value`, condition)
-		case "vd":
-			condition = fmt.Sprintf(`%s AND data_value = :data_value`, condition)
-		case "from":
-			condition = fmt.Sprintf(`%s AND time >= :from`, condition)
-		case "to":
-			condition = fmt.Sprintf(`%s AND time < :to`, condition)
+		n, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(errDeleteMessages, err)
 		}
+		total += uint64(n)
 	}
-	return condition
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(errDeleteMessages, err)
+	}
+
+	return total, nil
 }
 
-type dbMessage struct {
-	ID string `db:"id"`
-	senml.Message
+func (tr postgresRepository) Subtopics(chanID string) ([]string, error) {
+	// Channel column types differ between SenML and JSON
+	// tables, so each table is queried separately.
+	subtopics := map[string]bool{}
+	for format := range tr.formats {
+		if err := tr.detectSoftDelete(format); err != nil {
+			return nil, err
+		}
+		q := fmt.Sprintf(`SELECT DISTINCT subtopic FROM %s
+		WHERE channel = :channel AND subtopic <> ''%s;`, format, tr.deletedCondition(format, false))
+
+		rows, err := tr.readQuery(q, map[string]interface{}{"channel": chanID})
+		if err != nil {
+			err = readError(err)
+			// Table of allowed format may not be created yet.
+			if err == readers.ErrTableNotFound {
+				continue
+			}
+			return nil, err
+		}
+		for rows.Next() {
+			var subtopic string
+			if err := rows.Scan(&subtopic); err != nil {
+				rows.Close()
+				return nil, errors.Wrap(errReadMessages, err)
+			}
+			subtopics[subtopic] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, errors.Wrap(errReadMessages, err)
+		}
+	}
+
+	ret := []string{}
+	for subtopic := range subtopics {
+		ret = append(ret, subtopic)
+	}
+	sort.Strings(ret)
+
+	return ret, nil
 }
 
-type jsonMessage struct {
-	ID        string `db:"id"`
-	Channel   string `db:"channel"`
-	Created   int64  `db:"created"`
-	Subtopic  string `db:"subtopic"`
-	Publisher string `db:"publisher"`
-	Protocol  string `db:"protocol"`
-	Payload   []byte `db:"payload"`
+func (tr postgresRepository) Publishers(chanID string, rpm readers.PageMetadata) ([]string, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf(`SELECT DISTINCT publisher FROM %s WHERE %s ORDER BY publisher;`,
+		rpm.Format, tr.condition(chanID, rpm))
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, readError(err)
+	}
+	defer rows.Close()
+
+	publishers := []string{}
+	for rows.Next() {
+		var publisher string
+		if err := rows.Scan(&publisher); err != nil {
+			return nil, errors.Wrap(errReadMessages, err)
+		}
+		publishers = append(publishers, publisher)
+	}
+
+	return publishers, nil
 }
 
-func (msg jsonMessage) toMap() (map[string]interface{}, error) {
-	ret := map[string]interface{}{
-		"id":        msg.ID,
-		"channel":   msg.Channel,
-		"created":   msg.Created,
-		"subtopic":  msg.Subtopic,
-		"publisher": msg.Publisher,
-		"protocol":  msg.Protocol,
-		"payload":   map[string]interface{}{},
+func (tr postgresRepository) Counts(channels []string, rpm readers.PageMetadata) (map[string]uint64, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]uint64{}
+	if len(channels) == 0 {
+		return counts, nil
+	}
+	for _, ch := range channels {
+		counts[ch] = 0
+	}
+
+	// All the channels are matched by the channels condition.
+	chanID := channels[0]
+	rpm.Channels = channels[1:]
+	q := fmt.Sprintf(`SELECT channel, COUNT(*) FROM %s WHERE %s GROUP BY channel;`,
+		tr.fmtSource(chanID, rpm), tr.condition(chanID, rpm))
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, readError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var channel string
+		var count uint64
+		if err := rows.Scan(&channel, &count); err != nil {
+			return nil, errors.Wrap(errReadMessages, err)
+		}
+		counts[channel] = count
+	}
+
+	return counts, nil
+}
+
+func (tr postgresRepository) TimeSpan(chanID string, rpm readers.PageMetadata) (time.Time, time.Time, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	col := tr.timeValue(rpm.Format)
+	q := fmt.Sprintf(`SELECT MIN(%s), MAX(%s) FROM %s WHERE %s;`,
+		col, col, tr.fmtSource(chanID, rpm), tr.condition(chanID, rpm))
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return time.Time{}, time.Time{}, readError(err)
+	}
+	defer rows.Close()
+
+	// Both bounds are NULL if there are no matching messages.
+	var min, max sql.NullFloat64
+	if rows.Next() {
+		if err := rows.Scan(&min, &max); err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(errReadMessages, err)
+		}
+	}
+	if !min.Valid || !max.Valid {
+		return time.Time{}, time.Time{}, nil
+	}
+
+	return toTime(min.Float64), toTime(max.Float64), nil
+}
+
+// toTime converts message time in seconds to UTC time.
+func toTime(secs float64) time.Time {
+	sec, frac := math.Modf(secs)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC()
+}
+
+func (tr postgresRepository) Exists(chanID string, rpm readers.PageMetadata) (bool, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return false, err
+	}
+
+	// Scan stops at the first matching message.
+	q := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE %s LIMIT 1);`,
+		tr.fmtSource(chanID, rpm), tr.condition(chanID, rpm))
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return false, readError(err)
+	}
+	defer rows.Close()
+
+	exists := false
+	if rows.Next() {
+		if err := rows.Scan(&exists); err != nil {
+			return false, errors.Wrap(errReadMessages, err)
+		}
+	}
+
+	return exists, nil
+}
+
+func (tr postgresRepository) StorageBytes(chanID string) (uint64, error) {
+	var total uint64
+	for f := range tr.formats {
+		q := fmt.Sprintf(`SELECT COALESCE(SUM(pg_column_size(m.*)), 0) FROM %s AS m WHERE channel = :channel;`, f)
+		rows, err := tr.readQuery(q, map[string]interface{}{"channel": chanID})
+		if err != nil {
+			err = readError(err)
+			// Table of allowed format may not be created yet.
+			if err == readers.ErrTableNotFound {
+				continue
+			}
+			return 0, err
+		}
+
+		var size uint64
+		if rows.Next() {
+			if err := rows.Scan(&size); err != nil {
+				rows.Close()
+				return 0, errors.Wrap(errReadMessages, err)
+			}
+		}
+		rows.Close()
+		total += size
+	}
+
+	return total, nil
+}
+
+func (tr postgresRepository) Latest(chanID string, rpm readers.PageMetadata) (readers.Message, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf(`SELECT * FROM %s WHERE %s ORDER BY %s DESC LIMIT 1;`,
+		rpm.Format, tr.condition(chanID, rpm), tr.timeColumn(rpm.Format))
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, readError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, errors.Wrap(errReadMessages, err)
+		}
+		return nil, readers.ErrNotFound
+	}
+
+	m, err := scanMessage(rows.Rows, rpm, tr.senml[rpm.Format], tr.unmarshal(rpm.Format))
+	if err != nil {
+		return nil, errors.Wrap(errReadMessages, err)
+	}
+
+	return m.msg, nil
+}
+
+func (tr postgresRepository) LatestMany(channels []string, rpm readers.PageMetadata) (map[string]readers.Message, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	latest := map[string]readers.Message{}
+	if len(channels) == 0 {
+		return latest, nil
+	}
+
+	// All the channels are matched by the channels condition.
+	chanID := channels[0]
+	rpm.Channels = channels[1:]
+	q := fmt.Sprintf(`SELECT DISTINCT ON (channel) * FROM %s WHERE %s ORDER BY channel, %s DESC;`,
+		rpm.Format, tr.condition(chanID, rpm), tr.timeColumn(rpm.Format))
+
+	rows, err := tr.readQuery(q, fmtParams(chanID, rpm))
+	if err != nil {
+		return nil, readError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanMessage(rows.Rows, rpm, tr.senml[rpm.Format], tr.unmarshal(rpm.Format))
+		if err != nil {
+			return nil, errors.Wrap(errReadMessages, err)
+		}
+		channel := ""
+		switch msg := m.msg.(type) {
+		case senml.Message:
+			channel = msg.Channel
+		case IngestedMessage:
+			channel = msg.Channel
+		case map[string]interface{}:
+			channel, _ = msg[fieldName(rpm, "channel")].(string)
+		}
+		latest[channel] = m.msg
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errReadMessages, err)
+	}
+
+	return latest, nil
+}
+
+func (tr postgresRepository) Message(chanID, id string, rpm readers.PageMetadata) (readers.Message, error) {
+	if err := tr.validate(&rpm); err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf(`SELECT * FROM %s WHERE channel = :channel AND id = :id%s;`,
+		rpm.Format, tr.deletedCondition(rpm.Format, rpm.IncludeDeleted))
+	params := map[string]interface{}{
+		"channel": chanID,
+		"id":      id,
+	}
+
+	rows, err := tr.readQuery(q, params)
+	if err != nil {
+		// Malformed ID can't belong to any message.
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == errInvalid {
+			return nil, readers.ErrNotFound
+		}
+		return nil, readError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, errors.Wrap(errReadMessages, err)
+		}
+		return nil, readers.ErrNotFound
+	}
+
+	m, err := scanMessage(rows.Rows, rpm, tr.senml[rpm.Format], tr.unmarshal(rpm.Format))
+	if err != nil {
+		return nil, errors.Wrap(errReadMessages, err)
+	}
+
+	return m.msg, nil
+}
+
+func (tr postgresRepository) Ping(ctx context.Context) error {
+	if _, err := tr.db.ExecContext(ctx, `SELECT 1;`); err != nil {
+		return errors.Wrap(errPing, err)
+	}
+
+	return nil
+}
+
+// estimate returns number of messages matching the given page metadata
+// estimated by the query planner.
+func (tr postgresRepository) estimate(ctx context.Context, chanID string, rpm readers.PageMetadata) (uint64, error) {
+	q := fmt.Sprintf(`EXPLAIN (FORMAT JSON) SELECT * FROM %s WHERE %s;`, tr.fmtSource(chanID, rpm), tr.condition(chanID, rpm))
+	rows, err := tr.namedQuery(ctx, q, fmtParams(chanID, rpm))
+	if err != nil {
+		return 0, readError(err)
+	}
+	defer rows.Close()
+
+	var plan []byte
+	if rows.Next() {
+		if err := rows.Scan(&plan); err != nil {
+			return 0, errors.Wrap(errReadMessages, err)
+		}
+	}
+
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil || len(explained) == 0 {
+		return 0, errors.Wrap(errReadMessages, err)
+	}
+
+	return uint64(explained[0].Plan.Rows), nil
+}
+
+// scannedMessage is a message along with the values used
+// for paging, stored in the same database row.
+type scannedMessage struct {
+	msg   readers.Message
+	id    string
+	time  float64
+	total uint64
+}
+
+// unmarshal returns payload decoder of the given format.
+func (tr postgresRepository) unmarshal(format string) unmarshalFunc {
+	if tr.cbor[format] {
+		return cbor.Unmarshal
+	}
+	return json.Unmarshal
+}
+
+// scanMessage scans the current row into SenML message if the row is read
+// from SenML table, or into JSON message otherwise. Unless raw payload is
+// requested, JSON payload is parsed into nested maps.
+func scanMessage(rows *sqlx.Rows, rpm readers.PageMetadata, isSenML bool, unmarshal unmarshalFunc) (scannedMessage, error) {
+	if isSenML {
+		msg := dbMessage{}
+		if err := rows.StructScan(&msg); err != nil {
+			return scannedMessage{}, err
+		}
+
+		if msg.NormValue.Valid {
+			msg.Value = msg.NormValue
+		}
+		if msg.NormUnit.Valid {
+			msg.Unit = msg.NormUnit
+		}
+		sm := msg.toMessage()
+		var m readers.Message = sm
+		if rpm.IngestTime {
+			m = IngestedMessage{Message: sm, IngestTime: msg.Ingested.Float64}
+		}
+		if len(rpm.Rename) > 0 {
+			fields, err := renameFields(m, rpm.Rename)
+			if err != nil {
+				return scannedMessage{}, err
+			}
+			m = fields
+		}
+
+		return scannedMessage{msg: m, id: msg.PageID, time: msg.PageTime, total: msg.Total}, nil
+	}
+
+	msg := jsonMessage{}
+	if err := rows.StructScan(&msg); err != nil {
+		return scannedMessage{}, err
+	}
+	m, err := msg.toMap(unmarshal)
+	if err != nil {
+		return scannedMessage{}, err
+	}
+	if !rpm.RawPayload {
+		m["payload"] = jsont.ParseFlat(m["payload"])
+	}
+	if len(rpm.Rename) > 0 {
+		if m, err = renameFields(m, rpm.Rename); err != nil {
+			return scannedMessage{}, err
+		}
+	}
+
+	return scannedMessage{msg: m, id: msg.PageID, time: msg.PageTime, total: msg.Total}, nil
+}
+
+// renameFields returns message fields, as they are marshaled to JSON,
+// with the given fields renamed. Renamed fields take precedence over the
+// fields which already have the same name.
+func renameFields(msg readers.Message, rename map[string]string) (map[string]interface{}, error) {
+	fields, ok := msg.(map[string]interface{})
+	if !ok {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make(map[string]interface{}, len(fields))
+	for name, val := range fields {
+		if _, ok := rename[name]; !ok {
+			ret[name] = val
+		}
+	}
+	for name, val := range fields {
+		if to, ok := rename[name]; ok {
+			ret[to] = val
+		}
+	}
+
+	return ret, nil
+}
+
+// fieldName returns name the message field is returned with.
+func fieldName(rpm readers.PageMetadata, name string) string {
+	if to, ok := rpm.Rename[name]; ok {
+		return to
+	}
+
+	return name
+}
+
+// pools returns connection pools of the database and its replica.
+func (tr postgresRepository) pools() []*sqlx.DB {
+	if tr.replica != nil {
+		return []*sqlx.DB{tr.db, tr.replica}
+	}
+
+	return []*sqlx.DB{tr.db}
+}
+
+// readDB returns database messages are read from.
+func (tr postgresRepository) readDB() *sqlx.DB {
+	if tr.replica != nil {
+		return tr.replica
+	}
+
+	return tr.db
+}
+
+// readRows are rows of the read query, which hold the read slot
+// and the statement timeout until they're closed.
+type readRows struct {
+	*sqlx.Rows
+	ctx     context.Context
+	cancel  context.CancelFunc
+	release func()
+	closed  bool
+}
+
+// Err returns ErrQueryTimeout if rows weren't read before the
+// statement timeout, and the error of rows iteration otherwise.
+func (rr *readRows) Err() error {
+	err := rr.Rows.Err()
+	if err != nil && rr.ctx.Err() == context.DeadlineExceeded {
+		return readers.ErrQueryTimeout
+	}
+
+	return err
+}
+
+// Close closes rows and frees the read slot.
+func (rr *readRows) Close() error {
+	if rr.closed {
+		return nil
+	}
+	rr.closed = true
+	err := rr.Rows.Close()
+	rr.cancel()
+	rr.release()
+
+	return err
+}
+
+// readQuery runs read query the same way messages pages are read,
+// bounded by the number of concurrent reads and statement timeout.
+func (tr postgresRepository) readQuery(q string, params interface{}) (*readRows, error) {
+	ctx := context.Background()
+	if err := tr.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	qctx, cancel := context.WithCancel(ctx)
+	if tr.timeout > 0 {
+		qctx, cancel = context.WithTimeout(ctx, tr.timeout)
+	}
+	rows, err := tr.namedQuery(qctx, q, params)
+	if err != nil {
+		expired := qctx.Err() == context.DeadlineExceeded
+		cancel()
+		tr.release()
+		if expired {
+			return nil, readers.ErrQueryTimeout
+		}
+		return nil, err
+	}
+
+	return &readRows{Rows: rows, ctx: qctx, cancel: cancel, release: tr.release}, nil
+}
+
+// readError returns typed error if query failed since message table
+// doesn't exist, error carrying failure code if query was rejected by
+// the database, and wrapped error otherwise.
+func readError(err error) error {
+	if err == readers.ErrQueryTimeout || err == readers.ErrTooManyRequests {
+		return err
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		if pqErr.Code.Name() == errUndefinedTable {
+			return readers.ErrTableNotFound
+		}
+		return &QueryError{pqErr: pqErr}
+	}
+
+	return errors.Wrap(errReadMessages, err)
+}
+
+// limit returns page limit bounded by the maximum limit.
+func (tr postgresRepository) limit(limit uint64) uint64 {
+	if limit == 0 {
+		limit = defLimit
+	}
+	if tr.maxLimit > 0 && limit > tr.maxLimit {
+		return tr.maxLimit
+	}
+	return limit
+}
+
+// validate sets default message format and checks page metadata
+// values which are interpolated into queries.
+func (tr postgresRepository) validate(rpm *readers.PageMetadata) error {
+	if err := rpm.Validate(); err != nil {
+		return err
+	}
+	if rpm.Format == "" {
+		rpm.Format = tr.defFormat
+	}
+	// Format is interpolated into the query as a table name, so it
+	// must never reach the database unless it is a known table.
+	if !tr.formats[rpm.Format] {
+		return readers.ErrInvalidFormat
+	}
+	if _, ok := unitConversions[rpm.NormalizeUnit]; rpm.NormalizeUnit != "" && !ok {
+		return readers.ErrInvalidUnit
+	}
+	if err := tr.detectSoftDelete(rpm.Format); err != nil {
+		return err
+	}
+	if err := tr.detectIngested(*rpm); err != nil {
+		return err
+	}
+	// CBOR payload is not queryable.
+	if tr.cbor[rpm.Format] {
+		rpm.PayloadFilters = nil
+		rpm.PayloadContains = nil
+		rpm.PayloadComparisons = nil
+	}
+	for _, pc := range rpm.PayloadComparisons {
+		if !validPayloadPath(pc.Path) {
+			return readers.ErrInvalidPayloadFilter
+		}
+	}
+	if len(rpm.PayloadContains) > 0 {
+		contains, err := flatPayload(rpm.PayloadContains)
+		if err != nil {
+			return readers.ErrInvalidPayloadFilter
+		}
+		rpm.PayloadContains = contains
+	}
+	if _, err := location(rpm.Timezone); err != nil {
+		return err
+	}
+	// Relative time window is resolved when messages are read,
+	// unless it's overridden by the explicit time bounds.
+	if rpm.Last > 0 && rpm.From == 0 && rpm.To == 0 {
+		rpm.From = float64(time.Now().Add(-rpm.Last).UnixNano()) / float64(time.Second)
+	}
+	if rpm.PageToken != "" {
+		if _, err := decodePageToken(rpm.PageToken); err != nil {
+			return err
+		}
+		if !tr.timeSorted(*rpm) {
+			return readers.ErrInvalidPageToken
+		}
+	}
+
+	return nil
+}
+
+func fmtParams(chanID string, rpm readers.PageMetadata) map[string]interface{} {
+	params := map[string]interface{}{
+		"channel":               chanID,
+		"channels":              pq.Array(append([]string{chanID}, rpm.Channels...)),
+		"limit":                 rpm.Limit,
+		"offset":                rpm.Offset,
+		"subtopic":              rpm.Subtopic,
+		"publisher":             rpm.Publisher,
+		"name":                  rpm.Name,
+		"protocol":              rpm.Protocol,
+		"value":                 rpm.Value,
+		"bool_value":            rpm.BoolValue,
+		"string_value":          rpm.StringValue,
+		"data_value":            rpm.DataValue,
+		"from":                  rpm.From,
+		"to":                    rpm.To,
+		"value_from":            rpm.ValueFrom,
+		"value_to":              rpm.ValueTo,
+		"before":                rpm.Before,
+		"after":                 rpm.After,
+		"subtopics":             pq.Array(rpm.Subtopics),
+		"publishers":            pq.Array(rpm.Publishers),
+		"protocols":             pq.Array(rpm.Protocols),
+		"exclude_publishers":    pq.Array(rpm.ExcludePublishers),
+		"unit":                  rpm.Unit,
+		"normalize_unit":        rpm.NormalizeUnit,
+		"sum_from":              rpm.SumFrom,
+		"sum_to":                rpm.SumTo,
+		"subtopic_prefix":       likeEscaper.Replace(rpm.SubtopicPrefix),
+		"string_value_contains": likeEscaper.Replace(rpm.StringValueContains),
+		"payload_contains":      string(rpm.PayloadContains),
+		"update_time_from":      rpm.UpdateTimeFrom,
+		"update_time_to":        rpm.UpdateTimeTo,
+	}
+
+	// Page token is validated before the query is built.
+	if rpm.PageToken != "" {
+		token, _ := decodePageToken(rpm.PageToken)
+		params["token_time"] = token.Time
+		params["token_id"] = token.ID
+	}
+
+	// Payload values are compared as JSON, so both
+	// numeric and string values match exactly.
+	for i, key := range payloadKeys(rpm) {
+		val, err := json.Marshal(rpm.PayloadFilters[key])
+		if err != nil {
+			continue
+		}
+		params[fmt.Sprintf("payload_key_%d", i)] = key
+		params[fmt.Sprintf("payload_value_%d", i)] = string(val)
+	}
+
+	// Nested payload fields are stored flattened.
+	for i, pc := range rpm.PayloadComparisons {
+		params[fmt.Sprintf("payload_path_%d", i)] = strings.Join(pc.Path, payloadSep)
+		params[fmt.Sprintf("payload_number_%d", i)] = pc.Value
+	}
+
+	return params
+}
+
+// location returns time zone of the given IANA name, defaulting to UTC.
+// Local time zone is rejected, since it doesn't refer to the same zone in
+// the database.
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, readers.ErrInvalidTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, readers.ErrInvalidTimezone
+	}
+
+	return loc, nil
+}
+
+// validPayloadPath checks that the path refers to a flattened payload
+// field, whose keys are neither empty nor contain the separator.
+func validPayloadPath(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	for _, key := range path {
+		if key == "" || strings.Contains(key, payloadSep) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// flatPayload flattens JSON object the same way JSON transformer
+// flattens stored payload, so that nested objects are compared.
+func flatPayload(payload json.RawMessage) (json.RawMessage, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, readers.ErrInvalidPayloadFilter
+	}
+	flat, err := jsont.Flatten(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(flat)
+}
+
+// payloadKeys returns sorted payload filter keys, so that
+// condition and params refer to the same filter indices.
+func payloadKeys(rpm readers.PageMetadata) []string {
+	keys := []string{}
+	for key := range rpm.PayloadFilters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// fmtOrder returns ORDER BY expression for the given page metadata. Sort
+// column defaults to the message time column of the requested format.
+// Multiple comma separated sort columns are applied in the given order,
+// all in the requested direction. Messages without the sorted column are
+// placed as requested, or the way database places NULLs by default.
+func (tr postgresRepository) fmtOrder(rpm readers.PageMetadata) (string, error) {
+	columns, order := jsonOrder, []string{tr.timeColumn(rpm.Format)}
+	if tr.senml[rpm.Format] {
+		columns = senmlOrder
+	}
+
+	if rpm.Sort != "" {
+		order = strings.Split(rpm.Sort, ",")
+	}
+
+	dir, err := fmtDirection(rpm.Direction)
+	if err != nil {
+		return "", err
+	}
+
+	nulls := ""
+	switch rpm.NullsOrder {
+	case readers.NullsFirst:
+		nulls = " NULLS FIRST"
+	case readers.NullsLast:
+		nulls = " NULLS LAST"
+	}
+
+	keys := []string{}
+	for _, col := range order {
+		col = strings.TrimSpace(col)
+		if !columns[col] {
+			return "", readers.ErrInvalidSort
+		}
+		// Message time is ordered by the same expression page
+		// cursor is compared with.
+		if col == tr.timeColumn(rpm.Format) {
+			col = tr.timeValue(rpm.Format)
+		}
+		keys = append(keys, fmt.Sprintf("%s %s%s", col, dir, nulls))
+	}
+	// Messages are ordered by ID last, so that the order is stable.
+	keys = append(keys, fmt.Sprintf("id %s", dir))
+
+	return strings.Join(keys, ", "), nil
+}
+
+// fmtReadQuery returns query reading the page of messages which match
+// the given validated page metadata.
+func (tr postgresRepository) fmtReadQuery(chanID string, rpm readers.PageMetadata) (string, error) {
+	order, err := tr.fmtOrder(rpm)
+	if err != nil {
+		return "", err
+	}
+
+	columns, err := tr.fmtColumns(rpm)
+	if err != nil {
+		return "", err
+	}
+
+	// Total is calculated by the window function in the same query. Pages
+	// past the cursor are counted separately instead, since the window
+	// function would have to read all the messages before the cursor.
+	// Estimated total is calculated separately as well, which is
+	// cheaper than counting all the matching messages.
+	total := `COUNT(*) OVER ()`
+	if rpm.CountMode == readers.EstimateCount || hasCursor(rpm) {
+		total = `0`
+	}
+	cond := tr.condition(chanID, rpm)
+	if hasCursor(rpm) {
+		cond = fmt.Sprintf(`%s AND %s`, cond, tr.fmtCursor(rpm))
+	}
+	// Message time and ID are always read, since page cursor is based on them.
+	q := fmt.Sprintf(`SELECT %s, %s AS page_time, id AS page_id FROM (
+		SELECT *, %s AS total FROM %s WHERE %s
+	) AS counted ORDER BY %s
+	LIMIT :limit OFFSET :offset;`, columns, tr.timeValue(rpm.Format), total, tr.fmtSource(chanID, rpm), cond, order)
+
+	return q, nil
+}
+
+// fmtColumns returns comma separated list of the columns read from the
+// database, which are verified to be one of the message columns.
+func (tr postgresRepository) fmtColumns(rpm readers.PageMetadata) (string, error) {
+	// Normalized value and unit are read along with the stored ones,
+	// and replace them once the message is scanned.
+	var value, unit string
+	if rpm.NormalizeUnit != "" && tr.senml[rpm.Format] {
+		value, unit = fmtNormalized(rpm.NormalizeUnit)
+	}
+	if len(rpm.Columns) == 0 {
+		if value == "" {
+			return `*`, nil
+		}
+		return fmt.Sprintf(`*, %s AS norm_value, %s AS norm_unit`, value, unit), nil
+	}
+
+	allowed := jsonColumns
+	if tr.senml[rpm.Format] {
+		allowed = senmlColumns
+	}
+	// Ingest time is read only from the tables which record it.
+	ingested, _ := tr.columns.get(rpm.Format, ingestedColumn)
+	columns := []string{}
+	for _, c := range rpm.Columns {
+		if !allowed[c] || (c == ingestedColumn && !ingested) {
+			return "", readers.ErrInvalidColumn
+		}
+		columns = append(columns, c)
+		switch {
+		case c == "value" && value != "":
+			columns = append(columns, value+" AS norm_value")
+		case c == "unit" && unit != "":
+			columns = append(columns, unit+" AS norm_unit")
+		}
+	}
+	if rpm.IngestTime && ingested && !contains(rpm.Columns, ingestedColumn) {
+		columns = append(columns, ingestedColumn)
+	}
+	columns = append(columns, "total")
+
+	return strings.Join(columns, ", "), nil
+}
+
+// detectIngested looks up the ingested column of the SenML table, if
+// page metadata reads ingest time. Tables without the column are read
+// without ingest time.
+func (tr postgresRepository) detectIngested(rpm readers.PageMetadata) error {
+	if !tr.senml[rpm.Format] || (!rpm.IngestTime && !contains(rpm.Columns, ingestedColumn)) {
+		return nil
+	}
+	_, err := tr.detectColumn(rpm.Format, ingestedColumn)
+
+	return err
+}
+
+// fmtSource returns the table messages are read from. Duplicates are
+// removed using DISTINCT ON, which keeps the first row of each publisher
+// and time group, so it must be sorted by the same columns first. Page
+// order is applied to the deduplicated messages afterwards.
+func (tr postgresRepository) fmtSource(chanID string, rpm readers.PageMetadata) string {
+	if !rpm.Dedup {
+		return rpm.Format
+	}
+
+	tc := tr.timeColumn(rpm.Format)
+	return fmt.Sprintf(`(SELECT DISTINCT ON (publisher, %s) * FROM %s WHERE %s ORDER BY publisher, %s) AS deduped`,
+		tc, rpm.Format, tr.condition(chanID, rpm), tc)
+}
+
+// timeColumn returns name of the column containing message time.
+func (tr postgresRepository) timeColumn(format string) string {
+	if tr.senml[format] {
+		return "time"
+	}
+
+	return "created"
+}
+
+// timeValue returns expression of the message time in seconds. JSON
+// messages are created in nanoseconds, while time bounds, cursors and
+// page tokens are all in seconds.
+func (tr postgresRepository) timeValue(format string) string {
+	if tr.senml[format] {
+		return "time"
+	}
+
+	return "CAST(created AS FLOAT) / 1e9"
+}
+
+func fmtDirection(dir string) (string, error) {
+	switch dir {
+	case "", readers.DescDirection:
+		return "DESC", nil
+	case readers.AscDirection:
+		return "ASC", nil
+	default:
+		return "", readers.ErrInvalidDirection
+	}
+}
+
+// fmtCursor returns condition selecting messages past the page cursor.
+func (tr postgresRepository) fmtCursor(rpm readers.PageMetadata) string {
+	condition := `TRUE`
+	if rpm.Before != 0 {
+		condition = fmt.Sprintf(`%s AND %s < :before`, condition, tr.timeValue(rpm.Format))
+	}
+	if rpm.After != 0 {
+		condition = fmt.Sprintf(`%s AND %s > :after`, condition, tr.timeValue(rpm.Format))
+	}
+	// Messages of the same time are ordered by ID, so the page
+	// is continued past both the last message time and ID.
+	if rpm.PageToken != "" {
+		op := "<"
+		if rpm.Direction == readers.AscDirection {
+			op = ">"
+		}
+		condition = fmt.Sprintf(`%s AND (%s, id) %s (:token_time, CAST(:token_id AS UUID))`, condition, tr.timeValue(rpm.Format), op)
+	}
+
+	return condition
+}
+
+// hasCursor checks whether the page is read past the page cursor.
+func hasCursor(rpm readers.PageMetadata) bool {
+	return rpm.Before != 0 || rpm.After != 0 || rpm.PageToken != ""
+}
+
+// timeSorted checks whether messages are sorted by time only,
+// which is required for page tokens.
+func (tr postgresRepository) timeSorted(rpm readers.PageMetadata) bool {
+	return rpm.Sort == "" || rpm.Sort == tr.timeColumn(rpm.Format)
+}
+
+// fmtCondition returns condition selecting messages that match the given
+// page metadata. Conditions are always joined in the same order, so
+// the same page metadata results in the same query. Since conditions are
+// joined with AND, any condition combining predicates with OR has to be
+// parenthesized.
+func (tr postgresRepository) fmtCondition(chanID string, rpm readers.PageMetadata) string {
+	conds := []string{`channel = :channel`}
+	if len(rpm.Channels) > 0 {
+		conds[0] = `channel = ANY(:channels)`
+	}
+	add := func(cond string, args ...interface{}) {
+		conds = append(conds, fmt.Sprintf(cond, args...))
+	}
+	isSenML := tr.senml[rpm.Format]
+
+	if rpm.Subtopic != "" {
+		add(`subtopic = :subtopic`)
+	}
+	if rpm.Publisher != "" {
+		add(`publisher = :publisher`)
+	}
+	if rpm.Name != "" {
+		if rpm.NameCaseInsensitive {
+			add(`LOWER(name) = LOWER(:name)`)
+		} else {
+			add(`name = :name`)
+		}
+	}
+	if rpm.Protocol != "" {
+		add(`protocol = :protocol`)
+	}
+	// Zero value is compared only by explicit comparator, which
+	// otherwise applies to the string value, if one is set.
+	if rpm.Value != 0 || (rpm.Comparator != "" && rpm.StringValue == "") {
+		add(`value %s :value`, comparators[rpm.Comparator])
+	}
+	if rpm.BoolValue {
+		add(`bool_value = :bool_value`)
+	}
+	if rpm.StringValue != "" {
+		op := "="
+		if rpm.Comparator == readers.NotEqualKey {
+			op = "<>"
+		}
+		add(`string_value %s :string_value`, op)
+	}
+	if rpm.DataValue != "" {
+		add(`data_value = :data_value`)
+	}
+	if rpm.From != 0 {
+		add(`%s >= :from`, tr.timeValue(rpm.Format))
+	}
+	if rpm.To != 0 {
+		op := "<"
+		if rpm.ToInclusive {
+			op = "<="
+		}
+		add(`%s %s :to`, tr.timeValue(rpm.Format), op)
+	}
+	if rpm.ValueFrom != nil {
+		add(`value >= :value_from`)
+	}
+	if rpm.ValueTo != nil {
+		add(`value < :value_to`)
+	}
+	if rpm.ValueSign != "" {
+		add(`value %s 0`, signs[rpm.ValueSign])
+	}
+	if len(rpm.Subtopics) > 0 {
+		add(`subtopic = ANY(:subtopics)`)
+	}
+	if len(rpm.Publishers) > 0 {
+		add(`publisher = ANY(:publishers)`)
+	}
+	if len(rpm.Protocols) > 0 {
+		add(`protocol = ANY(:protocols)`)
+	}
+	if len(rpm.ExcludePublishers) > 0 {
+		add(`publisher <> ALL(:exclude_publishers)`)
+	}
+	if rpm.SubtopicPrefix != "" {
+		add(`subtopic LIKE :subtopic_prefix || '%%'`)
+	}
+	// Payload keys and values are passed as parameters,
+	// so they are never interpolated into the query.
+	if !isSenML {
+		for i, key := range payloadKeys(rpm) {
+			if _, err := json.Marshal(rpm.PayloadFilters[key]); err != nil {
+				continue
+			}
+			add(`payload->CAST(:payload_key_%d AS TEXT) = CAST(:payload_value_%d AS JSONB)`, i, i)
+		}
+		if len(rpm.PayloadContains) > 0 {
+			add(`payload @> CAST(:payload_contains AS JSONB)`)
+		}
+		// Fields are cast only if they are numeric, so that
+		// other values don't fail the query.
+		for i, pc := range rpm.PayloadComparisons {
+			add(`CASE WHEN jsonb_typeof(payload->CAST(:payload_path_%d AS TEXT)) = 'number' THEN CAST(payload->>CAST(:payload_path_%d AS TEXT) AS NUMERIC) END %s :payload_number_%d`,
+				i, i, comparators[pc.Comparator], i)
+		}
+	}
+	if isSenML {
+		if rpm.Unit != "" {
+			add(`unit = :unit`)
+		}
+		if rpm.SumFrom != 0 {
+			add(`sum >= :sum_from`)
+		}
+		if rpm.SumTo != 0 {
+			add(`sum < :sum_to`)
+		}
+		if rpm.StringValueContains != "" {
+			add(`string_value LIKE '%%' || :string_value_contains || '%%'`)
+		}
+		if rpm.HasStringValue {
+			add(`string_value IS NOT NULL`)
+		}
+		if rpm.HasBoolValue {
+			add(`bool_value IS NOT NULL`)
+		}
+		if rpm.HasDataValue {
+			add(`data_value IS NOT NULL`)
+		}
+		if rpm.DataValueNotEmpty {
+			add(`data_value IS NOT NULL AND data_value <> ''`)
+		}
+		if rpm.UpdateTimeFrom != 0 {
+			add(`update_time >= :update_time_from`)
+		}
+		if rpm.UpdateTimeTo != 0 {
+			add(`update_time < :update_time_to`)
+		}
+	}
+
+	return strings.Join(conds, " AND ")
+}
+
+// dbMessage is scanned into nullable types, since any SenML column
+// may be NULL and absent value must not be read as zero value.
+type dbMessage struct {
+	ID          string          `db:"id"`
+	Channel     sql.NullString  `db:"channel"`
+	Subtopic    sql.NullString  `db:"subtopic"`
+	Publisher   sql.NullString  `db:"publisher"`
+	Protocol    sql.NullString  `db:"protocol"`
+	Name        sql.NullString  `db:"name"`
+	Unit        sql.NullString  `db:"unit"`
+	Time        sql.NullFloat64 `db:"time"`
+	UpdateTime  sql.NullFloat64 `db:"update_time"`
+	Value       sql.NullFloat64 `db:"value"`
+	StringValue sql.NullString  `db:"string_value"`
+	DataValue   sql.NullString  `db:"data_value"`
+	BoolValue   sql.NullBool    `db:"bool_value"`
+	Sum         sql.NullFloat64 `db:"sum"`
+	Ingested    sql.NullFloat64 `db:"ingested"`
+	DeletedAt   sql.NullString  `db:"deleted_at"`
+	NormValue   sql.NullFloat64 `db:"norm_value"`
+	NormUnit    sql.NullString  `db:"norm_unit"`
+	Total       uint64          `db:"total"`
+	PageTime    float64         `db:"page_time"`
+	PageID      string          `db:"page_id"`
+}
+
+// IngestedMessage is SenML message along with the time it was stored
+// at, in seconds. Ingest time is zero for messages stored before it
+// was recorded.
+type IngestedMessage struct {
+	senml.Message
+	IngestTime float64 `json:"ingest_time,omitempty"`
+}
+
+func (msg dbMessage) toMessage() senml.Message {
+	return senml.Message{
+		Channel:     msg.Channel.String,
+		Subtopic:    msg.Subtopic.String,
+		Publisher:   msg.Publisher.String,
+		Protocol:    msg.Protocol.String,
+		Name:        msg.Name.String,
+		Unit:        msg.Unit.String,
+		Time:        msg.Time.Float64,
+		UpdateTime:  msg.UpdateTime.Float64,
+		Value:       nullFloat(msg.Value),
+		StringValue: nullString(msg.StringValue),
+		DataValue:   nullString(msg.DataValue),
+		BoolValue:   nullBool(msg.BoolValue),
+		Sum:         nullFloat(msg.Sum),
+	}
+}
+
+func nullString(val sql.NullString) *string {
+	if !val.Valid {
+		return nil
+	}
+
+	return &val.String
+}
+
+func nullBool(val sql.NullBool) *bool {
+	if !val.Valid {
+		return nil
+	}
+
+	return &val.Bool
+}
+
+type jsonMessage struct {
+	ID        string         `db:"id"`
+	Channel   string         `db:"channel"`
+	Created   int64          `db:"created"`
+	Subtopic  string         `db:"subtopic"`
+	Publisher string         `db:"publisher"`
+	Protocol  string         `db:"protocol"`
+	Payload   []byte         `db:"payload"`
+	DeletedAt sql.NullString `db:"deleted_at"`
+	Total     uint64         `db:"total"`
+	PageTime  float64        `db:"page_time"`
+	PageID    string         `db:"page_id"`
+}
+
+func (msg jsonMessage) toMap(unmarshal unmarshalFunc) (map[string]interface{}, error) {
+	ret := map[string]interface{}{
+		"id":        msg.ID,
+		"channel":   msg.Channel,
+		"created":   msg.Created,
+		"subtopic":  msg.Subtopic,
+		"publisher": msg.Publisher,
+		"protocol":  msg.Protocol,
+		"payload":   map[string]interface{}{},
+	}
+	// Payload is empty if it's not read.
+	if len(msg.Payload) == 0 {
+		return ret, nil
 	}
 	pld := make(map[string]interface{})
-	if err := json.Unmarshal(msg.Payload, &pld); err != nil {
+	if err := unmarshal(msg.Payload, &pld); err != nil {
 		return nil, err
 	}
 	ret["payload"] = pld
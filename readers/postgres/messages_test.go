@@ -4,11 +4,22 @@
 package postgres_test
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	pwriter "github.com/mainflux/mainflux/consumers/writers/postgres"
+	"github.com/mainflux/mainflux/pkg/errors"
+	mfjson "github.com/mainflux/mainflux/pkg/transformers/json"
 	"github.com/mainflux/mainflux/pkg/transformers/senml"
 	"github.com/mainflux/mainflux/pkg/uuid"
 	"github.com/mainflux/mainflux/readers"
@@ -25,6 +36,10 @@ const (
 	mqttProt    = "mqtt"
 	httpProt    = "http"
 	msgName     = "temperature"
+	jsonFormat  = "json_messages"
+	cborFormat  = "cbor_messages"
+
+	benchMsgsNum = 10000
 )
 
 var (
@@ -293,10 +308,5419 @@ func TestReadSenml(t *testing.T) {
 	}
 }
 
-func fromSenml(in []senml.Message) []readers.Message {
-	var ret []readers.Message
-	for _, m := range in {
-		ret = append(ret, m)
+func TestReadSenmlDirection(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are sorted from the newest to the oldest.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages = append(messages, msg)
 	}
-	return ret
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reversed := []senml.Message{}
+	for i := len(messages) - 1; i >= 0; i-- {
+		reversed = append(reversed, messages[i])
+	}
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		dir      string
+		messages []readers.Message
+		err      error
+	}{
+		"read messages with default direction": {
+			dir:      "",
+			messages: fromSenml(messages),
+		},
+		"read messages in descending order": {
+			dir:      readers.DescDirection,
+			messages: fromSenml(messages),
+		},
+		"read messages in ascending order": {
+			dir:      readers.AscDirection,
+			messages: fromSenml(reversed),
+		},
+		"read messages with invalid direction": {
+			dir: "asc; DROP TABLE messages",
+			err: readers.ErrInvalidDirection,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Limit:     limit,
+			Direction: tc.dir,
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+	}
+}
+
+func TestReadSenmlSort(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// The newer the message is, the lower its value is.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	byValue := []senml.Message{}
+	for i := len(messages) - 1; i >= 0; i-- {
+		byValue = append(byValue, messages[i])
+	}
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		sort     string
+		messages []readers.Message
+		err      error
+	}{
+		"read messages sorted by default column": {
+			sort:     "",
+			messages: fromSenml(messages),
+		},
+		"read messages sorted by time": {
+			sort:     "time",
+			messages: fromSenml(messages),
+		},
+		"read messages sorted by value": {
+			sort:     "value",
+			messages: fromSenml(byValue),
+		},
+		"read messages sorted by JSON column": {
+			sort: "created",
+			err:  readers.ErrInvalidSort,
+		},
+		"read messages sorted by invalid column": {
+			sort: "value; DROP TABLE messages",
+			err:  readers.ErrInvalidSort,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Limit: limit,
+			Sort:  tc.sort,
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+	}
+}
+
+func TestReadSenmlCompositeSort(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Each two consecutive messages share the same value.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(i / 2)
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Top values first, the newer first among the tied ones.
+	descending := []senml.Message{}
+	// Bottom values first, the older first among the tied ones.
+	ascending := []senml.Message{}
+	for i := limit - 2; i >= 0; i -= 2 {
+		descending = append(descending, messages[i], messages[i+1])
+		ascending = append([]senml.Message{messages[i+1], messages[i]}, ascending...)
+	}
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		sort     string
+		dir      string
+		messages []readers.Message
+		err      error
+	}{
+		"read messages sorted by value then time descending": {
+			sort:     "value,time",
+			dir:      readers.DescDirection,
+			messages: fromSenml(descending),
+		},
+		"read messages sorted by value then time ascending": {
+			sort:     "value, time",
+			dir:      readers.AscDirection,
+			messages: fromSenml(ascending),
+		},
+		"read messages sorted by invalid secondary column": {
+			sort: "value,created",
+			err:  readers.ErrInvalidSort,
+		},
+		"read messages sorted by empty secondary column": {
+			sort: "value,",
+			err:  readers.ErrInvalidSort,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Limit:     limit,
+			Sort:      tc.sort,
+			Direction: tc.dir,
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+	}
+}
+
+func TestReadSenmlComparator(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Message values are in range [0, limit).
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	// Index of the message whose value equals the queried one.
+	idx := int(v)
+
+	cases := map[string]struct {
+		comparator string
+		messages   []readers.Message
+		err        error
+	}{
+		"read messages with default comparator": {
+			comparator: "",
+			messages:   fromSenml(messages[idx : idx+1]),
+		},
+		"read messages with equal comparator": {
+			comparator: readers.EqualKey,
+			messages:   fromSenml(messages[idx : idx+1]),
+		},
+		"read messages with greater-than comparator": {
+			comparator: readers.GreaterThanKey,
+			messages:   fromSenml(messages[idx+1:]),
+		},
+		"read messages with greater-than-or-equal comparator": {
+			comparator: readers.GreaterThanEqualKey,
+			messages:   fromSenml(messages[idx:]),
+		},
+		"read messages with lower-than comparator": {
+			comparator: readers.LowerThanKey,
+			messages:   fromSenml(messages[:idx]),
+		},
+		"read messages with lower-than-or-equal comparator": {
+			comparator: readers.LowerThanEqualKey,
+			messages:   fromSenml(messages[:idx+1]),
+		},
+		"read messages with invalid comparator": {
+			comparator: "like",
+			err:        readers.ErrInvalidComparator,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Limit:      limit,
+			Value:      v,
+			Comparator: tc.comparator,
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.ElementsMatch(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlNotEqual(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Numeric values are in range [0, limit), followed by
+	// the string values, so each kind lacks the other value.
+	numeric := []senml.Message{}
+	strs := []senml.Message{}
+	states := []string{"on", "off", "on", "idle"}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(i)
+		numeric = append(numeric, senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &val,
+		})
+	}
+	for i := range states {
+		strs = append(strs, senml.Message{
+			Channel:     chanID,
+			Protocol:    mqttProt,
+			Time:        now - float64(limit+i),
+			StringValue: &states[i],
+		})
+	}
+	err = writer.Consume(append(append([]senml.Message{}, numeric...), strs...))
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	// Index of the message whose value equals the queried one.
+	idx := int(v)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with value not equal": {
+			pageMeta: readers.PageMetadata{
+				Value:      v,
+				Comparator: readers.NotEqualKey,
+			},
+			messages: append(append([]senml.Message{}, numeric[:idx]...), numeric[idx+1:]...),
+		},
+		"read messages with value not equal to zero": {
+			pageMeta: readers.PageMetadata{
+				Value:      0,
+				Comparator: readers.NotEqualKey,
+			},
+			messages: numeric[1:],
+		},
+		"read messages with value equal to zero": {
+			pageMeta: readers.PageMetadata{
+				Value:      0,
+				Comparator: readers.EqualKey,
+			},
+			messages: numeric[:1],
+		},
+		"read messages with value greater than zero": {
+			pageMeta: readers.PageMetadata{
+				Value:      0,
+				Comparator: readers.GreaterThanKey,
+			},
+			messages: numeric[1:],
+		},
+		"read messages with value lower than zero": {
+			pageMeta: readers.PageMetadata{
+				Value:      0,
+				Comparator: readers.LowerThanKey,
+			},
+			messages: []senml.Message{},
+		},
+		"read messages with string value not equal": {
+			pageMeta: readers.PageMetadata{
+				StringValue: "on",
+				Comparator:  readers.NotEqualKey,
+			},
+			messages: []senml.Message{strs[1], strs[3]},
+		},
+		"read messages with string value equal": {
+			pageMeta: readers.PageMetadata{
+				StringValue: "on",
+			},
+			messages: []senml.Message{strs[0], strs[2]},
+		},
+	}
+
+	for desc, tc := range cases {
+		tc.pageMeta.Limit = 2 * limit
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlValueRange(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Message values are in range [-limit/2, limit/2).
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(i - limit/2)
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	// Index of the message with zero value.
+	zero := limit / 2
+	cases := map[string]struct {
+		from     *float64
+		to       *float64
+		messages []readers.Message
+	}{
+		"read messages with value range": {
+			from:     messages[3].Value,
+			to:       messages[7].Value,
+			messages: fromSenml(messages[3:7]),
+		},
+		"read messages with lower value bound": {
+			from:     messages[3].Value,
+			messages: fromSenml(messages[3:]),
+		},
+		"read messages with upper value bound": {
+			to:       messages[7].Value,
+			messages: fromSenml(messages[:7]),
+		},
+		"read messages with zero lower value bound": {
+			from:     float(0),
+			to:       messages[zero+2].Value,
+			messages: fromSenml(messages[zero : zero+2]),
+		},
+		"read messages with zero upper value bound": {
+			from:     messages[zero-2].Value,
+			to:       float(0),
+			messages: fromSenml(messages[zero-2 : zero]),
+		},
+		"read messages with only zero upper value bound": {
+			to:       float(0),
+			messages: fromSenml(messages[:zero]),
+		},
+		"read messages without value range": {
+			messages: fromSenml(messages),
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Limit:     limit,
+			ValueFrom: tc.from,
+			ValueTo:   tc.to,
+		})
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlValueSign(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Values alternate between positive, negative and zero.
+	signs := map[string][]senml.Message{}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		val := float64(i + 1)
+		sign := readers.PositiveSign
+		switch i % 3 {
+		case 1:
+			val, sign = -val, readers.NegativeSign
+		case 2:
+			val, sign = 0, readers.ZeroSign
+		}
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &val,
+		}
+		signs[sign] = append(signs[sign], msg)
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+		err      error
+	}{
+		"read messages with positive value": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				ValueSign: readers.PositiveSign,
+			},
+			messages: signs[readers.PositiveSign],
+		},
+		"read messages with negative value": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				ValueSign: readers.NegativeSign,
+			},
+			messages: signs[readers.NegativeSign],
+		},
+		"read messages with zero value": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				ValueSign: readers.ZeroSign,
+			},
+			messages: signs[readers.ZeroSign],
+		},
+		"read messages with negative value and time window": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				ValueSign: readers.NegativeSign,
+				From:      messages[limit-1].Time,
+				To:        messages[1].Time,
+			},
+			messages: signs[readers.NegativeSign][1:3],
+		},
+		"read messages without value sign": {
+			pageMeta: readers.PageMetadata{
+				Limit: 3 * limit,
+			},
+			messages: messages,
+		},
+		"read messages with invalid value sign": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				ValueSign: "odd",
+			},
+			err: readers.ErrInvalidValueSign,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlLast(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are published every hour, half an hour
+	// apart from the full hour, during the last two days.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 48; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i*3600+1800),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+		err      error
+	}{
+		"read messages of the last day": {
+			pageMeta: readers.PageMetadata{
+				Limit: 48,
+				Last:  24 * time.Hour,
+			},
+			messages: messages[:24],
+		},
+		"read messages of the last hour": {
+			pageMeta: readers.PageMetadata{
+				Limit: 48,
+				Last:  time.Hour,
+			},
+			messages: messages[:1],
+		},
+		"read messages of the last day with explicit from": {
+			pageMeta: readers.PageMetadata{
+				Limit: 48,
+				Last:  24 * time.Hour,
+				From:  messages[2].Time,
+			},
+			messages: messages[:3],
+		},
+		"read messages of the last hour with explicit to": {
+			pageMeta: readers.PageMetadata{
+				Limit: 48,
+				Last:  time.Hour,
+				To:    messages[45].Time,
+			},
+			messages: messages[46:],
+		},
+		"read messages with negative relative time window": {
+			pageMeta: readers.PageMetadata{
+				Limit: 48,
+				Last:  -time.Hour,
+			},
+			err: readers.ErrInvalidLast,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlIngestTime(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Ingest time column is added by the writer migrations,
+	// which are not applied to the test database.
+	_, err = db.Exec(`ALTER TABLE messages ADD COLUMN IF NOT EXISTS ingested FLOAT DEFAULT EXTRACT(EPOCH FROM CURRENT_TIMESTAMP)`)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Device clocks are a day behind and an hour ahead of the server.
+	before := float64(time.Now().Unix())
+	skews := []float64{-24 * 3600, 3600}
+	messages := []senml.Message{}
+	for i, skew := range skews {
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: fmt.Sprintf("device-%d", i),
+			Protocol: mqttProt,
+			Time:     before + skew,
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+	after := float64(time.Now().Unix() + 1)
+
+	reader := preader.New(db)
+
+	result, err := reader.ReadAll(chanID, readers.PageMetadata{Limit: limit, Direction: readers.AscDirection, IngestTime: true})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	require.Len(t, result.Messages, len(messages), fmt.Sprintf("expected %d messages got %d", len(messages), len(result.Messages)))
+	for i, m := range result.Messages {
+		msg, ok := m.(preader.IngestedMessage)
+		require.True(t, ok, fmt.Sprintf("expected message with ingest time got %T", m))
+		assert.Equal(t, messages[i], msg.Message, fmt.Sprintf("expected %v got %v", messages[i], msg.Message))
+		assert.True(t, msg.IngestTime >= before && msg.IngestTime <= after, fmt.Sprintf("expected ingest time within [%f, %f] got %f", before, after, msg.IngestTime))
+		skew := msg.Time - msg.IngestTime
+		assert.InDelta(t, skews[i], skew, after-before, fmt.Sprintf("expected device clock skew %f got %f", skews[i], skew))
+	}
+
+	// Messages are returned as is, unless ingest time is requested.
+	result, err = reader.ReadAll(chanID, readers.PageMetadata{Limit: limit})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	assert.ElementsMatch(t, fromSenml(messages), result.Messages, fmt.Sprintf("expected %v got %v", messages, result.Messages))
+
+	// Messages stored before ingest time was recorded carry none.
+	_, err = db.Exec(`UPDATE messages SET ingested = NULL WHERE channel = $1`, chanID)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	msg, err := reader.Latest(chanID, readers.PageMetadata{IngestTime: true})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	expected := preader.IngestedMessage{Message: messages[1]}
+	assert.Equal(t, expected, msg, fmt.Sprintf("expected %v got %v", expected, msg))
+
+	// Ingest time is projected along with the requested columns.
+	result, err = reader.ReadAll(chanID, readers.PageMetadata{Limit: limit, Columns: []string{"subtopic"}, IngestTime: true})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	assert.Len(t, result.Messages, len(messages), fmt.Sprintf("expected %d messages got %d", len(messages), len(result.Messages)))
+}
+
+func TestReadSenmlIngestTimeWithoutColumn(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Table doesn't record ingest time.
+	format := "unrecorded_messages"
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE messages INCLUDING ALL)`, format))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS ingested`, format))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	msg := senml.Message{
+		Channel:  chanID,
+		Protocol: mqttProt,
+		Time:     float64(time.Now().Unix()),
+		Value:    &v,
+	}
+	err = writer.Consume([]senml.Message{msg})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+	_, err = db.Exec(fmt.Sprintf(`INSERT INTO %s SELECT id, channel, subtopic, publisher, protocol, name, unit, value, string_value,
+		bool_value, data_value, sum, time, update_time FROM messages WHERE channel = $1`, format), chanID)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db, preader.WithSenMLFormats(format))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []readers.Message
+		err      error
+	}{
+		"read messages with ingest time": {
+			pageMeta: readers.PageMetadata{Format: format, Limit: limit, IngestTime: true},
+			messages: []readers.Message{preader.IngestedMessage{Message: msg}},
+		},
+		"read messages with ingest time and columns": {
+			pageMeta: readers.PageMetadata{Format: format, Limit: limit, IngestTime: true, Columns: []string{"time", "value"}},
+			messages: []readers.Message{preader.IngestedMessage{Message: senml.Message{Time: msg.Time, Value: msg.Value}}},
+		},
+		"read ingest time column": {
+			pageMeta: readers.PageMetadata{Format: format, Limit: limit, Columns: []string{"ingested"}},
+			err:      readers.ErrInvalidColumn,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+	}
+}
+
+func TestReadSenmlCursor(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are sorted from the newest to the oldest.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []readers.Message
+		cursor   float64
+	}{
+		"read first page": {
+			pageMeta: readers.PageMetadata{Limit: limit},
+			messages: fromSenml(messages[:limit]),
+			cursor:   messages[limit-1].Time,
+		},
+		"read page before cursor": {
+			pageMeta: readers.PageMetadata{
+				Limit:  limit,
+				Before: messages[limit-1].Time,
+			},
+			messages: fromSenml(messages[limit : 2*limit]),
+			cursor:   messages[2*limit-1].Time,
+		},
+		"read last page before cursor": {
+			pageMeta: readers.PageMetadata{
+				Limit:  2 * limit,
+				Before: messages[2*limit-1].Time,
+			},
+			messages: fromSenml(messages[2*limit:]),
+		},
+		"read page after cursor": {
+			pageMeta: readers.PageMetadata{
+				Limit:     limit,
+				After:     messages[2*limit].Time,
+				Direction: readers.AscDirection,
+			},
+			messages: fromSenml(messages[limit : 2*limit]),
+			cursor:   messages[limit].Time,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(messages), result.Total))
+		assert.Equal(t, tc.cursor, result.Cursor, fmt.Sprintf("%s: expected %v got %v", desc, tc.cursor, result.Cursor))
+	}
+}
+
+func TestStorageBytes(t *testing.T) {
+	writer := pwriter.New(db)
+
+	small, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	large, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	empty, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	now := float64(time.Now().Unix())
+	for ch, n := range map[string]int{small: 2, large: 20 * limit} {
+		messages := []senml.Message{}
+		for i := 0; i < n; i++ {
+			messages = append(messages, senml.Message{
+				Channel:  ch,
+				Protocol: mqttProt,
+				Time:     now - float64(i),
+				Value:    &v,
+			})
+		}
+		err = writer.Consume(messages)
+		require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data: []mfjson.Message{{
+			Channel:  small,
+			Protocol: mqttProt,
+			Created:  time.Now().Unix(),
+			Payload:  map[string]interface{}{"temperature": float64(20)},
+		}},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	// Table of the missing format doesn't exist, so it's skipped.
+	allFormats := preader.New(db, preader.WithFormats(jsonFormat, "missing_messages"))
+
+	smallSize, err := reader.StorageBytes(small)
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	largeSize, err := reader.StorageBytes(large)
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	emptySize, err := reader.StorageBytes(empty)
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	allSize, err := allFormats.StorageBytes(small)
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+
+	assert.True(t, smallSize > 0, fmt.Sprintf("expected small channel size to be positive got %d", smallSize))
+	assert.True(t, largeSize > smallSize, fmt.Sprintf("expected large channel size %d to exceed small channel size %d", largeSize, smallSize))
+	assert.Equal(t, uint64(0), emptySize, fmt.Sprintf("expected empty channel size 0 got %d", emptySize))
+	assert.True(t, allSize > smallSize, fmt.Sprintf("expected size %d of all formats to exceed SenML size %d", allSize, smallSize))
+}
+
+func TestLatest(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID2, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	wrongID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are sorted from the newest to the oldest and
+	// alternate between two subtopics and two publishers.
+	subtopics := []string{"temperature", "humidity"}
+	publishers := []string{pubID, pubID2}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: publishers[i%2],
+			Subtopic:  subtopics[(i/2)%2],
+			Protocol:  mqttProt,
+			Name:      msgName,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		chanID   string
+		pageMeta readers.PageMetadata
+		msg      readers.Message
+		err      error
+	}{
+		"read latest message": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{},
+			msg:      messages[0],
+		},
+		"read latest message with subtopic": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Subtopic: subtopics[1]},
+			msg:      messages[2],
+		},
+		"read latest message with publisher": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Publisher: pubID2},
+			msg:      messages[1],
+		},
+		"read latest message with subtopic and publisher": {
+			chanID: chanID,
+			pageMeta: readers.PageMetadata{
+				Subtopic:  subtopics[1],
+				Publisher: pubID2,
+			},
+			msg: messages[3],
+		},
+		"read latest message with name": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Name: msgName},
+			msg:      messages[0],
+		},
+		"read latest message with non-existent subtopic": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Subtopic: "not-present"},
+			err:      readers.ErrNotFound,
+		},
+		"read latest message for non-existent channel": {
+			chanID:   wrongID,
+			pageMeta: readers.PageMetadata{},
+			err:      readers.ErrNotFound,
+		},
+	}
+
+	for desc, tc := range cases {
+		msg, err := reader.Latest(tc.chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.msg, msg, fmt.Sprintf("%s: expected %v got %v", desc, tc.msg, msg))
+	}
+}
+
+func TestReadSenmlSubtopics(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	subtopics := []string{"temperature", "humidity", "pressure"}
+	messages := map[string][]senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		st := subtopics[i%len(subtopics)]
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Subtopic:  st,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages[st] = append(messages[st], msg)
+		all = append(all, msg)
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []readers.Message
+	}{
+		"read messages with single subtopic in list": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Subtopics: subtopics[:1],
+			},
+			messages: fromSenml(messages[subtopics[0]]),
+		},
+		"read messages with multiple subtopics": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Subtopics: subtopics[:2],
+			},
+			messages: fromSenml(append(messages[subtopics[0]], messages[subtopics[1]]...)),
+		},
+		"read messages with non-existent subtopics": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Subtopics: []string{"not-present", "missing"},
+			},
+			messages: []readers.Message{},
+		},
+		"read messages with empty subtopics": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Subtopics: []string{},
+			},
+			messages: fromSenml(all),
+		},
+		"read messages with subtopic and subtopics": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Subtopic:  subtopics[1],
+				Subtopics: subtopics[:2],
+			},
+			messages: fromSenml(messages[subtopics[1]]),
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlPublishers(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	publishers := []string{}
+	for i := 0; i < 4; i++ {
+		pubID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		publishers = append(publishers, pubID)
+	}
+
+	messages := map[string][]senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 4*limit; i++ {
+		pub := publishers[i%len(publishers)]
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pub,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages[pub] = append(messages[pub], msg)
+		all = append(all, msg)
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with two publishers": {
+			pageMeta: readers.PageMetadata{
+				Limit:      4 * limit,
+				Publishers: publishers[:2],
+			},
+			messages: append(append([]senml.Message{}, messages[publishers[0]]...), messages[publishers[1]]...),
+		},
+		"read messages with three publishers": {
+			pageMeta: readers.PageMetadata{
+				Limit:      4 * limit,
+				Publishers: publishers[:3],
+			},
+			messages: append(append(append([]senml.Message{}, messages[publishers[0]]...), messages[publishers[1]]...), messages[publishers[2]]...),
+		},
+		"read messages with empty publishers": {
+			pageMeta: readers.PageMetadata{
+				Limit:      4 * limit,
+				Publishers: []string{},
+			},
+			messages: all,
+		},
+		"read messages with publisher and publishers": {
+			pageMeta: readers.PageMetadata{
+				Limit:      4 * limit,
+				Publisher:  publishers[1],
+				Publishers: publishers[:2],
+			},
+			messages: messages[publishers[1]],
+		},
+		"read messages with publishers and time window": {
+			pageMeta: readers.PageMetadata{
+				Limit:      4 * limit,
+				Publishers: publishers[:2],
+				From:       all[limit-1].Time,
+			},
+			messages: append(append([]senml.Message{}, messages[publishers[0]][:3]...), messages[publishers[1]][:3]...),
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlExcludePublishers(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	publishers := []string{}
+	for i := 0; i < 3; i++ {
+		pubID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		publishers = append(publishers, pubID)
+	}
+
+	messages := map[string][]senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		pub := publishers[i%len(publishers)]
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pub,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages[pub] = append(messages[pub], msg)
+		all = append(all, msg)
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages excluding publisher": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				ExcludePublishers: publishers[:1],
+			},
+			messages: append(append([]senml.Message{}, messages[publishers[1]]...), messages[publishers[2]]...),
+		},
+		"read messages excluding two publishers": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				ExcludePublishers: publishers[:2],
+			},
+			messages: messages[publishers[2]],
+		},
+		"read messages excluding all publishers": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				ExcludePublishers: publishers,
+			},
+			messages: []senml.Message{},
+		},
+		"read messages with empty excluded publishers": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				ExcludePublishers: []string{},
+			},
+			messages: all,
+		},
+		"read messages with publishers excluding one of them": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				Publishers:        publishers[:2],
+				ExcludePublishers: publishers[1:2],
+			},
+			messages: messages[publishers[0]],
+		},
+		"read messages of publisher excluding it": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				Publisher:         publishers[0],
+				ExcludePublishers: publishers[:1],
+			},
+			messages: []senml.Message{},
+		},
+		"read messages excluding publisher within time window": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				ExcludePublishers: publishers[2:],
+				From:              all[5].Time,
+			},
+			messages: []senml.Message{all[0], all[1], all[3], all[4]},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlProtocols(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	protocols := []string{mqttProt, "http", "coap"}
+	messages := map[string][]senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		prot := protocols[i%len(protocols)]
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: prot,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages[prot] = append(messages[prot], msg)
+		all = append(all, msg)
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with two protocols": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Protocols: protocols[:2],
+			},
+			messages: append(append([]senml.Message{}, messages[mqttProt]...), messages["http"]...),
+		},
+		"read messages with single protocol": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Protocols: protocols[2:],
+			},
+			messages: messages["coap"],
+		},
+		"read messages with empty protocols": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Protocols: []string{},
+			},
+			messages: all,
+		},
+		"read messages with protocol and protocols": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Protocol:  "http",
+				Protocols: protocols[:2],
+			},
+			messages: messages["http"],
+		},
+		"read messages with non-existent protocols": {
+			pageMeta: readers.PageMetadata{
+				Limit:     3 * limit,
+				Protocols: []string{"amqp", "ws"},
+			},
+			messages: []senml.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadJSONPayloadFilters(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	payloads := []map[string]interface{}{
+		{"status": "alarm", "temperature": float64(30)},
+		{"status": "ok", "temperature": float64(20)},
+		{"status": "alarm", "temperature": float64(20)},
+		{"temperature": float64(30)},
+	}
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i, pld := range payloads {
+		msg := mfjson.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Created:   now - int64(i),
+			Payload:   pld,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   messages,
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		filters  map[string]interface{}
+		messages []mfjson.Message
+	}{
+		"read messages with string payload filter": {
+			filters:  map[string]interface{}{"status": "alarm"},
+			messages: []mfjson.Message{messages[0], messages[2]},
+		},
+		"read messages with numeric payload filter": {
+			filters:  map[string]interface{}{"temperature": 30},
+			messages: []mfjson.Message{messages[0], messages[3]},
+		},
+		"read messages with multiple payload filters": {
+			filters:  map[string]interface{}{"status": "alarm", "temperature": 20},
+			messages: []mfjson.Message{messages[2]},
+		},
+		"read messages with non-matching payload filter": {
+			filters:  map[string]interface{}{"status": "error"},
+			messages: []mfjson.Message{},
+		},
+		"read messages with missing payload key": {
+			filters:  map[string]interface{}{"humidity": 30},
+			messages: []mfjson.Message{},
+		},
+		"read messages without payload filters": {
+			filters:  map[string]interface{}{},
+			messages: messages,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Format:         jsonFormat,
+			Limit:          limit,
+			PayloadFilters: tc.filters,
+		})
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadJSONPayloadContains(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	payloads := []map[string]interface{}{
+		{"alarm": true, "sensor": map[string]interface{}{"type": "temperature", "value": float64(30)}},
+		{"alarm": false, "sensor": map[string]interface{}{"type": "temperature", "value": float64(20)}},
+		{"alarm": true, "sensor": map[string]interface{}{"type": "humidity", "value": float64(30)}},
+	}
+	// Payload is stored flattened, the way JSON transformer
+	// passes it to the writer, while reader returns it nested.
+	stored := []mfjson.Message{}
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i, pld := range payloads {
+		flat, err := mfjson.Flatten(pld)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		msg := mfjson.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Created:   now - int64(i),
+			Payload:   flat,
+		}
+		stored = append(stored, msg)
+		msg.Payload = pld
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   stored,
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		contains string
+		messages []mfjson.Message
+		err      error
+	}{
+		"read messages containing top level field": {
+			contains: `{"alarm": true}`,
+			messages: []mfjson.Message{messages[0], messages[2]},
+		},
+		"read messages containing partial nested object": {
+			contains: `{"sensor": {"type": "temperature"}}`,
+			messages: []mfjson.Message{messages[0], messages[1]},
+		},
+		"read messages containing multiple fields": {
+			contains: `{"alarm": true, "sensor": {"value": 30}}`,
+			messages: []mfjson.Message{messages[0], messages[2]},
+		},
+		"read messages containing non-matching object": {
+			contains: `{"sensor": {"type": "pressure"}}`,
+			messages: []mfjson.Message{},
+		},
+		"read messages containing invalid object": {
+			contains: `["alarm"]`,
+			err:      readers.ErrInvalidPayloadFilter,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Format:          jsonFormat,
+			Limit:           limit,
+			PayloadContains: json.RawMessage(tc.contains),
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadJSONRawPayload(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	payloads := []map[string]interface{}{
+		{"alarm": true, "sensor": map[string]interface{}{"type": "temperature", "value": float64(30)}},
+		{"alarm": false, "sensor": map[string]interface{}{"location": map[string]interface{}{"room": "kitchen"}}},
+	}
+	// Payload is stored flattened, the way JSON transformer
+	// passes it to the writer.
+	stored := []mfjson.Message{}
+	nested := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i, pld := range payloads {
+		flat, err := mfjson.Flatten(pld)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		msg := mfjson.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Created:  now - int64(i),
+			Payload:  flat,
+		}
+		stored = append(stored, msg)
+		msg.Payload = pld
+		nested = append(nested, msg)
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   stored,
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		raw      bool
+		messages []mfjson.Message
+	}{
+		"read messages with nested payload": {
+			raw:      false,
+			messages: nested,
+		},
+		"read messages with raw payload": {
+			raw:      true,
+			messages: stored,
+		},
+	}
+
+	for desc, tc := range cases {
+		pm := readers.PageMetadata{
+			Format:     jsonFormat,
+			Limit:      limit,
+			RawPayload: tc.raw,
+		}
+		result, err := reader.ReadAll(chanID, pm)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+
+		msg, err := reader.Latest(chanID, pm)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, fromJSON(tc.messages[:1]), withoutIDs([]readers.Message{msg}), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages[0], msg))
+
+		cursor, err := reader.Stream(chanID, pm)
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		streamed := []readers.Message{}
+		for cursor.Next() {
+			streamed = append(streamed, cursor.Message())
+		}
+		assert.Nil(t, cursor.Err(), fmt.Sprintf("%s: expected no error got %s", desc, cursor.Err()))
+		cursor.Close()
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(streamed), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, streamed))
+	}
+}
+
+func TestReadJSONPayloadComparisons(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	payloads := []map[string]interface{}{
+		{"sensor": map[string]interface{}{"temp": float64(35), "humidity": float64(40)}},
+		{"sensor": map[string]interface{}{"temp": float64(25), "humidity": float64(60)}},
+		{"sensor": map[string]interface{}{"temp": "hot"}},
+		{"sensor": map[string]interface{}{"humidity": float64(50)}},
+		{"temp": float64(40)},
+	}
+	// Payload is stored flattened, the way JSON transformer
+	// passes it to the writer, while reader returns it nested.
+	stored := []mfjson.Message{}
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i, pld := range payloads {
+		flat, err := mfjson.Flatten(pld)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		msg := mfjson.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Created:  now - int64(i),
+			Payload:  flat,
+		}
+		stored = append(stored, msg)
+		msg.Payload = pld
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   stored,
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+	temp := []string{"sensor", "temp"}
+
+	cases := map[string]struct {
+		comparisons []readers.PayloadComparison
+		messages    []mfjson.Message
+		err         error
+	}{
+		"read messages with nested field greater than value": {
+			comparisons: []readers.PayloadComparison{{Path: temp, Comparator: readers.GreaterThanKey, Value: 30}},
+			messages:    []mfjson.Message{messages[0]},
+		},
+		"read messages with nested field equal to value": {
+			comparisons: []readers.PayloadComparison{{Path: temp, Value: 25}},
+			messages:    []mfjson.Message{messages[1]},
+		},
+		"read messages with nested field lower than or equal to value": {
+			comparisons: []readers.PayloadComparison{{Path: temp, Comparator: readers.LowerThanEqualKey, Value: 35}},
+			messages:    []mfjson.Message{messages[0], messages[1]},
+		},
+		"read messages with multiple nested field comparisons": {
+			comparisons: []readers.PayloadComparison{
+				{Path: temp, Comparator: readers.GreaterThanKey, Value: 20},
+				{Path: []string{"sensor", "humidity"}, Comparator: readers.GreaterThanEqualKey, Value: 50},
+			},
+			messages: []mfjson.Message{messages[1]},
+		},
+		"read messages with non-matching nested field comparison": {
+			comparisons: []readers.PayloadComparison{{Path: temp, Comparator: readers.GreaterThanKey, Value: 100}},
+			messages:    []mfjson.Message{},
+		},
+		"read messages with missing nested field": {
+			comparisons: []readers.PayloadComparison{{Path: []string{"sensor", "pressure"}, Comparator: readers.GreaterThanKey, Value: 0}},
+			messages:    []mfjson.Message{},
+		},
+		"read messages with top level field": {
+			comparisons: []readers.PayloadComparison{{Path: []string{"temp"}, Comparator: readers.GreaterThanKey, Value: 30}},
+			messages:    []mfjson.Message{messages[4]},
+		},
+		"read messages with empty path": {
+			comparisons: []readers.PayloadComparison{{Path: []string{}, Value: 30}},
+			err:         readers.ErrInvalidPayloadFilter,
+		},
+		"read messages with path key containing separator": {
+			comparisons: []readers.PayloadComparison{{Path: []string{"sensor/temp"}, Value: 30}},
+			err:         readers.ErrInvalidPayloadFilter,
+		},
+		"read messages with invalid comparator": {
+			comparisons: []readers.PayloadComparison{{Path: temp, Comparator: "like", Value: 30}},
+			err:         readers.ErrInvalidComparator,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Format:             jsonFormat,
+			Limit:              limit,
+			PayloadComparisons: tc.comparisons,
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadJSONTimeRange(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i := 0; i < limit; i++ {
+		msg := mfjson.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Created:  (now - int64(i)) * int64(time.Second),
+			Payload:  map[string]interface{}{"temperature": float64(i)},
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   messages,
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []mfjson.Message
+	}{
+		"read JSON messages from time": {
+			pageMeta: readers.PageMetadata{From: float64(now - 2)},
+			messages: messages[0:3],
+		},
+		"read JSON messages to time": {
+			pageMeta: readers.PageMetadata{To: float64(now - 2)},
+			messages: messages[3:],
+		},
+		"read JSON messages within time range": {
+			pageMeta: readers.PageMetadata{From: float64(now - 5), To: float64(now - 2)},
+			messages: messages[3:6],
+		},
+		"read JSON messages within inclusive time range": {
+			pageMeta: readers.PageMetadata{From: float64(now - 5), To: float64(now - 2), ToInclusive: true},
+			messages: messages[2:6],
+		},
+		"read JSON messages within empty time range": {
+			pageMeta: readers.PageMetadata{From: float64(now + 1)},
+			messages: []mfjson.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		tc.pageMeta.Format = jsonFormat
+		tc.pageMeta.Limit = limit
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadAllContext(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := map[string]struct {
+		ctx      context.Context
+		messages []readers.Message
+		err      error
+	}{
+		"read messages with active context": {
+			ctx:      context.Background(),
+			messages: fromSenml(messages),
+		},
+		"read messages with cancelled context": {
+			ctx: cancelled,
+			err: context.Canceled,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAllContext(tc.ctx, chanID, readers.PageMetadata{Limit: limit})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.ElementsMatch(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+	}
+}
+
+func TestReadSenmlCountMode(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < msgsNum; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Refresh statistics used by the query planner.
+	_, err = db.Exec(`ANALYZE messages`)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		mode      string
+		estimated bool
+		err       error
+	}{
+		"read messages with default count mode": {
+			mode: "",
+		},
+		"read messages with exact count mode": {
+			mode: readers.ExactCount,
+		},
+		"read messages with estimate count mode": {
+			mode:      readers.EstimateCount,
+			estimated: true,
+		},
+		"read messages with invalid count mode": {
+			mode: "guess",
+			err:  readers.ErrInvalidCountMode,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, readers.PageMetadata{
+			Limit:     limit,
+			CountMode: tc.mode,
+		})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Len(t, result.Messages, limit, fmt.Sprintf("%s: expected %d messages got %d", desc, limit, len(result.Messages)))
+		assert.Equal(t, tc.estimated, result.Estimated, fmt.Sprintf("%s: expected estimated %t got %t", desc, tc.estimated, result.Estimated))
+		switch tc.estimated {
+		case true:
+			assert.NotZero(t, result.Total, fmt.Sprintf("%s: expected non-zero total", desc))
+		default:
+			assert.Equal(t, uint64(msgsNum), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, msgsNum, result.Total))
+		}
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	writer := pwriter.New(db)
+	reader := preader.New(db)
+
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID2, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are sorted from the newest to the oldest and
+	// alternate between two publishers.
+	publishers := []string{pubID, pubID2}
+	now := float64(time.Now().Unix())
+	msgTime := func(i int) float64 {
+		return now - float64(i)
+	}
+
+	cases := map[string]struct {
+		pageMeta  readers.PageMetadata
+		deleted   uint64
+		remaining uint64
+		err       error
+	}{
+		"delete messages older than cutoff": {
+			pageMeta:  readers.PageMetadata{To: msgTime(limit - 1)},
+			deleted:   limit,
+			remaining: limit,
+		},
+		"delete messages within time window": {
+			pageMeta: readers.PageMetadata{
+				From: msgTime(limit - 1),
+				To:   msgTime(1),
+			},
+			deleted:   limit - 2,
+			remaining: limit + 2,
+		},
+		"delete messages by publisher": {
+			pageMeta:  readers.PageMetadata{Publisher: pubID2},
+			deleted:   limit,
+			remaining: limit,
+		},
+		"delete messages by publisher within time window": {
+			pageMeta: readers.PageMetadata{
+				Publisher: pubID2,
+				To:        msgTime(limit - 1),
+			},
+			deleted:   limit / 2,
+			remaining: 3 * limit / 2,
+		},
+		"delete messages with non-existent subtopic": {
+			pageMeta:  readers.PageMetadata{Subtopic: "not-present"},
+			deleted:   0,
+			remaining: 2 * limit,
+		},
+		"delete messages without filter": {
+			pageMeta:  readers.PageMetadata{},
+			remaining: 2 * limit,
+			err:       readers.ErrUnfilteredDelete,
+		},
+		"delete messages without filter with paging": {
+			pageMeta: readers.PageMetadata{
+				Offset: limit,
+				Limit:  limit,
+			},
+			remaining: 2 * limit,
+			err:       readers.ErrUnfilteredDelete,
+		},
+		"delete messages without filter forced": {
+			pageMeta:  readers.PageMetadata{Force: true},
+			deleted:   2 * limit,
+			remaining: 0,
+		},
+	}
+
+	for desc, tc := range cases {
+		// Each case deletes messages from its own channel.
+		chanID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+		messages := []senml.Message{}
+		for i := 0; i < 2*limit; i++ {
+			msg := senml.Message{
+				Channel:   chanID,
+				Publisher: publishers[i%2],
+				Protocol:  mqttProt,
+				Time:      msgTime(i),
+				Value:     &v,
+			}
+			messages = append(messages, msg)
+		}
+		err = writer.Consume(messages)
+		require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+		deleted, err := reader.DeleteAll(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.deleted, deleted, fmt.Sprintf("%s: expected %d got %d", desc, tc.deleted, deleted))
+
+		page, err := reader.ReadAll(chanID, readers.PageMetadata{Limit: 2 * limit})
+		require.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.remaining, page.Total, fmt.Sprintf("%s: expected %d got %d", desc, tc.remaining, page.Total))
+	}
+}
+
+func TestDeleteByIDs(t *testing.T) {
+	writer := pwriter.New(db)
+	reader := preader.New(db, preader.WithFormats(jsonFormat, "missing_messages"))
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	otherID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	now := float64(time.Now().Unix())
+	for _, ch := range []string{chanID, otherID} {
+		messages := []senml.Message{}
+		for i := 0; i < limit; i++ {
+			messages = append(messages, senml.Message{
+				Channel:  ch,
+				Protocol: mqttProt,
+				Time:     now - float64(i),
+				Value:    &v,
+			})
+		}
+		err = writer.Consume(messages)
+		require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data: []mfjson.Message{{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Created:  time.Now().Unix(),
+			Payload:  map[string]interface{}{"temperature": float64(20)},
+		}},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// SenML messages don't carry IDs, so they are read directly.
+	ids := func(ch string) []string {
+		ret := []string{}
+		err := db.Select(&ret, `SELECT CAST(id AS TEXT) FROM messages WHERE channel = $1 ORDER BY time DESC`, ch)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		return ret
+	}
+	senmlIDs := ids(chanID)
+	otherIDs := ids(otherID)
+	page, err := reader.ReadAll(chanID, readers.PageMetadata{Format: jsonFormat, Limit: limit})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	require.Len(t, page.Messages, 1, fmt.Sprintf("expected 1 JSON message got %d", len(page.Messages)))
+	jsonID := page.Messages[0].(map[string]interface{})["id"].(string)
+
+	cases := []struct {
+		desc      string
+		ids       []string
+		deleted   uint64
+		remaining []string
+		err       error
+	}{
+		{
+			desc:      "delete messages with no IDs",
+			ids:       []string{},
+			deleted:   0,
+			remaining: senmlIDs,
+		},
+		{
+			desc:      "delete subset of messages",
+			ids:       senmlIDs[:3],
+			deleted:   3,
+			remaining: senmlIDs[3:],
+		},
+		{
+			desc:      "delete already deleted messages",
+			ids:       senmlIDs[:3],
+			deleted:   0,
+			remaining: senmlIDs[3:],
+		},
+		{
+			desc:      "delete messages of other channel",
+			ids:       otherIDs[:3],
+			deleted:   0,
+			remaining: senmlIDs[3:],
+		},
+		{
+			desc:      "delete messages with malformed ID",
+			ids:       []string{senmlIDs[3], "invalid"},
+			deleted:   0,
+			remaining: senmlIDs[3:],
+			err:       readers.ErrInvalidMessageID,
+		},
+		{
+			desc:      "delete messages of different formats",
+			ids:       []string{senmlIDs[3], jsonID},
+			deleted:   2,
+			remaining: senmlIDs[4:],
+		},
+	}
+
+	for _, tc := range cases {
+		deleted, err := reader.DeleteByIDs(chanID, tc.ids)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.deleted, deleted, fmt.Sprintf("%s: expected %d deleted got %d", tc.desc, tc.deleted, deleted))
+		remaining := ids(chanID)
+		assert.Equal(t, tc.remaining, remaining, fmt.Sprintf("%s: expected %v remaining got %v", tc.desc, tc.remaining, remaining))
+	}
+
+	assert.Equal(t, otherIDs, ids(otherID), "expected messages of other channel to remain")
+	page, err = reader.ReadAll(chanID, readers.PageMetadata{Format: jsonFormat, Limit: limit})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	assert.Empty(t, page.Messages, fmt.Sprintf("expected no JSON messages got %v", page.Messages))
+}
+
+func TestSubtopics(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	wrongID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Subtopics repeat and include empty one.
+	subtopics := []string{"temperature", "humidity", "", "pressure", "humidity"}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 2*limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: subtopics[i%len(subtopics)],
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	err = writer.Consume(mfjson.Messages{
+		Data: []mfjson.Message{
+			{
+				Channel:  chanID,
+				Subtopic: "location",
+				Protocol: mqttProt,
+				Created:  time.Now().Unix(),
+				Payload:  map[string]interface{}{"lat": float64(45)},
+			},
+		},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	cases := map[string]struct {
+		reader    preader.Repository
+		chanID    string
+		subtopics []string
+	}{
+		"read subtopics of existing channel": {
+			reader:    preader.New(db),
+			chanID:    chanID,
+			subtopics: []string{"humidity", "pressure", "temperature"},
+		},
+		"read subtopics of existing channel including JSON messages": {
+			reader:    preader.New(db, preader.WithFormats(jsonFormat)),
+			chanID:    chanID,
+			subtopics: []string{"humidity", "location", "pressure", "temperature"},
+		},
+		"read subtopics of non-existent channel": {
+			reader:    preader.New(db, preader.WithFormats(jsonFormat)),
+			chanID:    wrongID,
+			subtopics: []string{},
+		},
+		"read subtopics with table of allowed format not created": {
+			reader:    preader.New(db, preader.WithFormats(jsonFormat, "missing_messages")),
+			chanID:    chanID,
+			subtopics: []string{"humidity", "location", "pressure", "temperature"},
+		},
+	}
+
+	for desc, tc := range cases {
+		subtopics, err := tc.reader.Subtopics(tc.chanID)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.subtopics, subtopics, fmt.Sprintf("%s: expected %v got %v", desc, tc.subtopics, subtopics))
+	}
+}
+
+func TestPublishers(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	wrongID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	publishers := []string{}
+	for i := 0; i < 3; i++ {
+		pubID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		publishers = append(publishers, pubID)
+	}
+
+	// The last publisher has published only a day ago.
+	day := (24 * time.Hour).Seconds()
+	now := float64(time.Now().Unix())
+	messages := []senml.Message{}
+	for i := 0; i < 2*limit; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: publishers[i%2],
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages = append(messages, msg)
+	}
+	messages = append(messages, senml.Message{
+		Channel:   chanID,
+		Publisher: publishers[2],
+		Protocol:  mqttProt,
+		Time:      now - day - 1,
+		Value:     &v,
+	})
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		chanID     string
+		pageMeta   readers.PageMetadata
+		publishers []string
+	}{
+		"read all publishers": {
+			chanID:     chanID,
+			pageMeta:   readers.PageMetadata{},
+			publishers: publishers,
+		},
+		"read publishers within the last day": {
+			chanID:     chanID,
+			pageMeta:   readers.PageMetadata{From: now - day},
+			publishers: publishers[:2],
+		},
+		"read publishers before the last day": {
+			chanID:     chanID,
+			pageMeta:   readers.PageMetadata{To: now - day},
+			publishers: publishers[2:],
+		},
+		"read publishers of non-existent channel": {
+			chanID:     wrongID,
+			pageMeta:   readers.PageMetadata{},
+			publishers: []string{},
+		},
+	}
+
+	for desc, tc := range cases {
+		publishers, err := reader.Publishers(tc.chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, tc.publishers, publishers, fmt.Sprintf("%s: expected %v got %v", desc, tc.publishers, publishers))
+	}
+}
+
+func TestCounts(t *testing.T) {
+	writer := pwriter.New(db)
+
+	// Each channel holds one message more than the previous one,
+	// while the last channel holds none.
+	channels := []string{}
+	counts := map[string]uint64{}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 4; i++ {
+		chanID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		channels = append(channels, chanID)
+		counts[chanID] = 0
+		if i == 3 {
+			continue
+		}
+		for j := 0; j <= i; j++ {
+			messages = append(messages, senml.Message{
+				Channel:  chanID,
+				Protocol: mqttProt,
+				Time:     now - float64(j),
+				Value:    &v,
+			})
+		}
+		counts[chanID] = uint64(i + 1)
+	}
+	err := writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		channels []string
+		pageMeta readers.PageMetadata
+		counts   map[string]uint64
+	}{
+		"count messages of multiple channels": {
+			channels: channels,
+			counts:   counts,
+		},
+		"count messages of a single channel": {
+			channels: channels[2:3],
+			counts:   map[string]uint64{channels[2]: 3},
+		},
+		"count messages of multiple channels with time filter": {
+			channels: channels,
+			pageMeta: readers.PageMetadata{From: now - 1},
+			counts: map[string]uint64{
+				channels[0]: 1,
+				channels[1]: 2,
+				channels[2]: 2,
+				channels[3]: 0,
+			},
+		},
+		"count messages of no channels": {
+			channels: []string{},
+			counts:   map[string]uint64{},
+		},
+	}
+
+	for desc, tc := range cases {
+		counts, err := reader.Counts(tc.channels, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.counts, counts, fmt.Sprintf("%s: expected %v got %v", desc, tc.counts, counts))
+	}
+}
+
+func TestReadSenmlUnit(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Values are in range [0, 2*limit) and units alternate.
+	units := []string{"Cel", "degF"}
+	messages := map[string][]senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 2*limit; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Unit:     units[i%2],
+			Time:     now - float64(i),
+			Value:    &val,
+		}
+		messages[msg.Unit] = append(messages[msg.Unit], msg)
+		all = append(all, msg)
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with unit": {
+			pageMeta: readers.PageMetadata{
+				Limit: 2 * limit,
+				Unit:  units[0],
+			},
+			messages: messages[units[0]],
+		},
+		"read messages with unit and value filter": {
+			pageMeta: readers.PageMetadata{
+				Limit:      2 * limit,
+				Unit:       units[1],
+				Value:      limit,
+				Comparator: readers.GreaterThanEqualKey,
+			},
+			messages: messages[units[1]][limit/2:],
+		},
+		"read messages with unit and time window": {
+			pageMeta: readers.PageMetadata{
+				Limit: 2 * limit,
+				Unit:  units[0],
+				From:  now - 3,
+			},
+			messages: messages[units[0]][:2],
+		},
+		"read messages with non-existent unit": {
+			pageMeta: readers.PageMetadata{
+				Limit: 2 * limit,
+				Unit:  "K",
+			},
+			messages: []senml.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlNormalizeUnit(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// The same temperature is stored in different units, along
+	// with the humidity, which can't be converted to them.
+	stored := []struct {
+		unit  string
+		value float64
+	}{
+		{unit: "Cel", value: 100},
+		{unit: "degF", value: 212},
+		{unit: "K", value: 373.15},
+		{unit: "%RH", value: 40},
+	}
+	now := float64(time.Now().Unix())
+	messages := []senml.Message{}
+	for i, st := range stored {
+		val := st.value
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Unit:     st.unit,
+			Time:     now - float64(i),
+			Value:    &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		units    []string
+		values   []float64
+		err      error
+	}{
+		"read messages normalized to Celsius": {
+			pageMeta: readers.PageMetadata{
+				Limit:         limit,
+				NormalizeUnit: "Cel",
+			},
+			units:  []string{"Cel", "Cel", "Cel", "%RH"},
+			values: []float64{100, 100, 100, 40},
+		},
+		"read messages normalized to Fahrenheit": {
+			pageMeta: readers.PageMetadata{
+				Limit:         limit,
+				NormalizeUnit: "degF",
+			},
+			units:  []string{"degF", "degF", "degF", "%RH"},
+			values: []float64{212, 212, 212, 40},
+		},
+		"read messages normalized to Kelvin": {
+			pageMeta: readers.PageMetadata{
+				Limit:         limit,
+				NormalizeUnit: "K",
+			},
+			units:  []string{"K", "K", "K", "%RH"},
+			values: []float64{373.15, 373.15, 373.15, 40},
+		},
+		"read messages normalized with value filter": {
+			pageMeta: readers.PageMetadata{
+				Limit:         limit,
+				NormalizeUnit: "Cel",
+				Value:         200,
+				Comparator:    readers.GreaterThanKey,
+			},
+			units:  []string{"Cel", "Cel"},
+			values: []float64{100, 100},
+		},
+		"read messages normalized with projected value": {
+			pageMeta: readers.PageMetadata{
+				Limit:         limit,
+				NormalizeUnit: "Cel",
+				Columns:       []string{"value"},
+			},
+			units:  []string{"", "", "", ""},
+			values: []float64{100, 100, 100, 40},
+		},
+		"read messages without normalization": {
+			pageMeta: readers.PageMetadata{
+				Limit: limit,
+			},
+			units:  []string{"Cel", "degF", "K", "%RH"},
+			values: []float64{100, 212, 373.15, 40},
+		},
+		"read messages normalized to unknown unit": {
+			pageMeta: readers.PageMetadata{
+				Limit:         limit,
+				NormalizeUnit: "lm",
+			},
+			err: readers.ErrInvalidUnit,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		require.Equal(t, len(tc.values), len(result.Messages), fmt.Sprintf("%s: expected %d messages got %d", desc, len(tc.values), len(result.Messages)))
+		// Messages are sorted by time descending, the same way they are stored.
+		for i, m := range result.Messages {
+			msg := m.(senml.Message)
+			require.NotNil(t, msg.Value, fmt.Sprintf("%s: expected value got nil", desc))
+			assert.Equal(t, tc.units[i], msg.Unit, fmt.Sprintf("%s: expected unit %s got %s", desc, tc.units[i], msg.Unit))
+			assert.InDelta(t, tc.values[i], *msg.Value, 1e-9, fmt.Sprintf("%s: expected value %f got %f", desc, tc.values[i], *msg.Value))
+		}
+	}
+}
+
+func TestReadSenmlUpdateTime(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Records are created at the same time, while
+	// each one was updated a second after the previous one.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:    chanID,
+			Protocol:   mqttProt,
+			Time:       now - float64(i),
+			UpdateTime: float64(i),
+			Value:      &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with update time range": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				UpdateTimeFrom: 2,
+				UpdateTimeTo:   5,
+			},
+			messages: messages[2:5],
+		},
+		"read messages with lower update time bound": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				UpdateTimeFrom: 7,
+			},
+			messages: messages[7:],
+		},
+		"read messages with upper update time bound": {
+			pageMeta: readers.PageMetadata{
+				Limit:        limit,
+				UpdateTimeTo: 3,
+			},
+			messages: messages[:3],
+		},
+		"read messages sorted by update time": {
+			pageMeta: readers.PageMetadata{
+				Limit:     limit,
+				Sort:      "update_time",
+				Direction: readers.AscDirection,
+			},
+			messages: messages,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlSumRange(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Cumulative sums grow with each reading, and every
+	// other message carries value instead of the sum.
+	sums := []senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 2*limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Unit:     "kWh",
+			Time:     now + float64(i),
+		}
+		switch i % 2 {
+		case 0:
+			sum := float64(i * 100)
+			msg.Sum = &sum
+			sums = append(sums, msg)
+		default:
+			msg.Value = &v
+		}
+		all = append(all, msg)
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with sum range": {
+			pageMeta: readers.PageMetadata{
+				Limit:   2 * limit,
+				SumFrom: 400,
+				SumTo:   1000,
+			},
+			messages: sums[2:5],
+		},
+		"read messages with lower sum bound": {
+			pageMeta: readers.PageMetadata{
+				Limit:   2 * limit,
+				SumFrom: 400,
+			},
+			messages: sums[2:],
+		},
+		"read messages with upper sum bound": {
+			pageMeta: readers.PageMetadata{
+				Limit: 2 * limit,
+				SumTo: 1000,
+			},
+			messages: sums[:5],
+		},
+		"read messages with out of range sum": {
+			pageMeta: readers.PageMetadata{
+				Limit:   2 * limit,
+				SumFrom: 10000,
+			},
+			messages: []senml.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlSubtopicPrefix(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	subtopics := []string{
+		"building/floor1/room3",
+		"building/floor1/room4",
+		"building/floor2/room1",
+		"buildings/other",
+		"buildingX/room1",
+		"building%/room1",
+	}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i, sub := range subtopics {
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: sub,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages under floor prefix": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				SubtopicPrefix: "building/floor1/",
+			},
+			messages: messages[0:2],
+		},
+		"read messages under building prefix": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				SubtopicPrefix: "building/",
+			},
+			messages: messages[0:3],
+		},
+		"read messages with prefix equal to subtopic": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				SubtopicPrefix: "building/floor2/room1",
+			},
+			messages: messages[2:3],
+		},
+		"read messages with literal percent prefix": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				SubtopicPrefix: "building%",
+			},
+			messages: messages[5:6],
+		},
+		"read messages with literal underscore prefix": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				SubtopicPrefix: "building_",
+			},
+			messages: []senml.Message{},
+		},
+		"read messages with prefix and exact subtopic": {
+			pageMeta: readers.PageMetadata{
+				Limit:          limit,
+				SubtopicPrefix: "building/",
+				Subtopic:       "building/floor1/room4",
+			},
+			messages: messages[1:2],
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlFilterCombinations(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Each protocol publishes to each subtopic, one message per second,
+	// so every combination of filters selects a different subset.
+	protocols := []string{mqttProt, "coap", "http"}
+	subtopics := []string{
+		"building/floor2/room1",
+		"building/floor2/room2",
+		"building/floor1/room1",
+		"building/floor20/room1",
+	}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 4*len(protocols)*len(subtopics); i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: subtopics[i%len(subtopics)],
+			Protocol: protocols[i%len(protocols)],
+			Time:     now - float64(i),
+			Value:    &val,
+		}
+		if i%2 == 0 {
+			msg.DataValue = &vd
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	floor2 := func(msg senml.Message) bool { return strings.HasPrefix(msg.Subtopic, "building/floor2/") }
+	from, to := now-30, now-10
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		match    func(senml.Message) bool
+	}{
+		"read messages with protocol, subtopic prefix and time window": {
+			pageMeta: readers.PageMetadata{
+				Protocol:       "coap",
+				SubtopicPrefix: "building/floor2/",
+				From:           from,
+				To:             to,
+			},
+			match: func(msg senml.Message) bool {
+				return msg.Protocol == "coap" && floor2(msg) && msg.Time >= from && msg.Time < to
+			},
+		},
+		"read messages with protocols, subtopic prefix and time window": {
+			pageMeta: readers.PageMetadata{
+				Protocols:      []string{"coap", "http"},
+				SubtopicPrefix: "building/floor2/",
+				From:           from,
+			},
+			match: func(msg senml.Message) bool {
+				return msg.Protocol != mqttProt && floor2(msg) && msg.Time >= from
+			},
+		},
+		"read messages with protocol, subtopic prefix and value comparison": {
+			pageMeta: readers.PageMetadata{
+				Protocol:       mqttProt,
+				SubtopicPrefix: "building/floor2/",
+				Comparator:     readers.LowerThanKey,
+				Value:          20,
+			},
+			match: func(msg senml.Message) bool {
+				return msg.Protocol == mqttProt && floor2(msg) && *msg.Value < 20
+			},
+		},
+		"read messages with subtopics, protocol and value range": {
+			pageMeta: readers.PageMetadata{
+				Subtopics: subtopics[1:3],
+				Protocol:  "http",
+				ValueFrom: float(5),
+				ValueTo:   float(40),
+			},
+			match: func(msg senml.Message) bool {
+				return (msg.Subtopic == subtopics[1] || msg.Subtopic == subtopics[2]) &&
+					msg.Protocol == "http" && *msg.Value >= 5 && *msg.Value < 40
+			},
+		},
+		"read messages with non-empty data value, protocol and subtopic prefix": {
+			pageMeta: readers.PageMetadata{
+				DataValueNotEmpty: true,
+				Protocol:          "coap",
+				SubtopicPrefix:    "building/floor2/",
+			},
+			match: func(msg senml.Message) bool {
+				return msg.DataValue != nil && msg.Protocol == "coap" && floor2(msg)
+			},
+		},
+		"read messages with exact subtopic, protocol and inclusive time window": {
+			pageMeta: readers.PageMetadata{
+				Subtopic:    subtopics[0],
+				Protocol:    mqttProt,
+				From:        from,
+				To:          to,
+				ToInclusive: true,
+			},
+			match: func(msg senml.Message) bool {
+				return msg.Subtopic == subtopics[0] && msg.Protocol == mqttProt && msg.Time >= from && msg.Time <= to
+			},
+		},
+	}
+
+	for desc, tc := range cases {
+		expected := []senml.Message{}
+		for _, msg := range messages {
+			if tc.match(msg) {
+				expected = append(expected, msg)
+			}
+		}
+		require.NotEmpty(t, expected, fmt.Sprintf("%s: expected filters to select messages", desc))
+
+		tc.pageMeta.Limit = uint64(len(messages))
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(expected), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, expected, result.Messages))
+		assert.Equal(t, uint64(len(expected)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(expected), result.Total))
+	}
+}
+
+func TestReadSenmlNullsOrder(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Every third message carries string value only, so its value is NULL.
+	messages := []senml.Message{}
+	nulls := 0
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+		}
+		switch i % 3 {
+		case 0:
+			msg.StringValue = &vs
+			nulls++
+		default:
+			val := float64(i)
+			msg.Value = &val
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta   readers.PageMetadata
+		nullsFirst bool
+	}{
+		"read messages sorted by value ascending with nulls first": {
+			pageMeta:   readers.PageMetadata{Sort: "value", Direction: readers.AscDirection, NullsOrder: readers.NullsFirst},
+			nullsFirst: true,
+		},
+		"read messages sorted by value ascending with nulls last": {
+			pageMeta:   readers.PageMetadata{Sort: "value", Direction: readers.AscDirection, NullsOrder: readers.NullsLast},
+			nullsFirst: false,
+		},
+		"read messages sorted by value descending with nulls first": {
+			pageMeta:   readers.PageMetadata{Sort: "value", Direction: readers.DescDirection, NullsOrder: readers.NullsFirst},
+			nullsFirst: true,
+		},
+		"read messages sorted by value descending with nulls last": {
+			pageMeta:   readers.PageMetadata{Sort: "value", Direction: readers.DescDirection, NullsOrder: readers.NullsLast},
+			nullsFirst: false,
+		},
+	}
+
+	for desc, tc := range cases {
+		tc.pageMeta.Limit = limit
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		require.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		require.Len(t, result.Messages, limit, fmt.Sprintf("%s: expected %d messages got %d", desc, limit, len(result.Messages)))
+
+		values := []float64{}
+		for i, m := range result.Messages {
+			msg := m.(senml.Message)
+			isNull := i < nulls
+			if !tc.nullsFirst {
+				isNull = i >= limit-nulls
+			}
+			assert.Equal(t, isNull, msg.Value == nil, fmt.Sprintf("%s: unexpected value at position %d: %v", desc, i, msg.Value))
+			if msg.Value != nil {
+				values = append(values, *msg.Value)
+			}
+		}
+		sorted := sort.Float64sAreSorted(values)
+		if tc.pageMeta.Direction == readers.DescDirection {
+			sorted = sort.SliceIsSorted(values, func(i, j int) bool { return values[i] > values[j] })
+		}
+		assert.True(t, sorted, fmt.Sprintf("%s: expected values sorted %s got %v", desc, tc.pageMeta.Direction, values))
+	}
+
+	_, err = reader.ReadAll(chanID, readers.PageMetadata{Limit: limit, Sort: "value", NullsOrder: "middle"})
+	assert.Equal(t, readers.ErrInvalidNullsOrder, err, fmt.Sprintf("expected %s got %s", readers.ErrInvalidNullsOrder, err))
+}
+
+func TestReadAllRename(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	now := time.Now().Unix()
+	senmlMsg := senml.Message{
+		Channel:  chanID,
+		Subtopic: subtopic,
+		Protocol: mqttProt,
+		Name:     msgName,
+		Time:     float64(now),
+		Value:    &v,
+	}
+	err = writer.Consume([]senml.Message{senmlMsg})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	jsonMsg := mfjson.Message{
+		Channel:  chanID,
+		Subtopic: subtopic,
+		Protocol: mqttProt,
+		Created:  now,
+		Payload:  map[string]interface{}{"temp": float64(20)},
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   []mfjson.Message{jsonMsg},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		fields   map[string]interface{}
+		removed  []string
+		err      error
+	}{
+		"read SenML messages with renamed fields": {
+			pageMeta: readers.PageMetadata{
+				Limit:  limit,
+				Rename: map[string]string{"time": "ts", "value": "val"},
+			},
+			fields: map[string]interface{}{
+				"ts":       senmlMsg.Time,
+				"val":      v,
+				"name":     msgName,
+				"subtopic": subtopic,
+				"channel":  chanID,
+			},
+			removed: []string{"time", "value"},
+		},
+		"read SenML messages with swapped field names": {
+			pageMeta: readers.PageMetadata{
+				Limit:  limit,
+				Rename: map[string]string{"name": "subtopic", "subtopic": "name"},
+			},
+			fields: map[string]interface{}{
+				"name":     subtopic,
+				"subtopic": msgName,
+				"time":     senmlMsg.Time,
+			},
+		},
+		"read SenML messages with renamed missing field": {
+			pageMeta: readers.PageMetadata{
+				Limit:  limit,
+				Rename: map[string]string{"sum": "total"},
+			},
+			fields: map[string]interface{}{
+				"name":  msgName,
+				"value": v,
+			},
+			removed: []string{"total"},
+		},
+		"read JSON messages with renamed fields": {
+			pageMeta: readers.PageMetadata{
+				Format: jsonFormat,
+				Limit:  limit,
+				Rename: map[string]string{"created": "ts", "payload": "data"},
+			},
+			fields: map[string]interface{}{
+				"ts":       jsonMsg.Created,
+				"data":     map[string]interface{}{"temp": float64(20)},
+				"subtopic": subtopic,
+			},
+			removed: []string{"created", "payload"},
+		},
+		"read messages with field renamed to empty name": {
+			pageMeta: readers.PageMetadata{
+				Limit:  limit,
+				Rename: map[string]string{"time": ""},
+			},
+			err: readers.ErrInvalidRename,
+		},
+	}
+
+	for desc, tc := range cases {
+		page, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		require.Len(t, page.Messages, 1, fmt.Sprintf("%s: expected single message got %d", desc, len(page.Messages)))
+		msg, ok := page.Messages[0].(map[string]interface{})
+		require.True(t, ok, fmt.Sprintf("%s: expected message fields got %T", desc, page.Messages[0]))
+		for name, val := range tc.fields {
+			assert.Equal(t, val, msg[name], fmt.Sprintf("%s: expected field %s to be %v got %v", desc, name, val, msg[name]))
+		}
+		for _, name := range tc.removed {
+			assert.NotContains(t, msg, name, fmt.Sprintf("%s: expected field %s to be removed", desc, name))
+		}
+	}
+}
+
+func TestReadSenmlStringValueContains(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	values := []string{
+		"sensor error: timeout",
+		"ERROR",
+		"all ok",
+		"disk 100% full",
+		"disk 1000 full",
+		"state_idle",
+		"stateXidle",
+	}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := range values {
+		msg := senml.Message{
+			Channel:     chanID,
+			Protocol:    mqttProt,
+			Time:        now - float64(i),
+			StringValue: &values[i],
+		}
+		if i%2 == 0 {
+			msg.Subtopic = "status"
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with string value containing text": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				StringValueContains: "error",
+			},
+			messages: messages[0:1],
+		},
+		"read messages with string value containing whole value": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				StringValueContains: "all ok",
+			},
+			messages: messages[2:3],
+		},
+		"read messages with string value containing literal percent": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				StringValueContains: "0%",
+			},
+			messages: messages[3:4],
+		},
+		"read messages with string value containing literal underscore": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				StringValueContains: "e_i",
+			},
+			messages: messages[5:6],
+		},
+		"read messages with string value containing text and subtopic": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				StringValueContains: "disk",
+				Subtopic:            "status",
+			},
+			messages: messages[3:4],
+		},
+		"read messages with string value containing missing text": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				StringValueContains: "warning",
+			},
+			messages: []senml.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlNameCaseInsensitive(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	names := []string{"Temp-Sensor", "temp-sensor", "TEMP-SENSOR", "humidity"}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i, name := range names {
+		msg := senml.Message{
+			Channel:  chanID,
+			Name:     name,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with case sensitive name": {
+			pageMeta: readers.PageMetadata{
+				Limit: limit,
+				Name:  "temp-sensor",
+			},
+			messages: messages[1:2],
+		},
+		"read messages with case sensitive mixed case name": {
+			pageMeta: readers.PageMetadata{
+				Limit: limit,
+				Name:  "Temp-sensor",
+			},
+			messages: []senml.Message{},
+		},
+		"read messages with case insensitive name": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				Name:                "Temp-sensor",
+				NameCaseInsensitive: true,
+			},
+			messages: messages[0:3],
+		},
+		"read messages with case insensitive non-existent name": {
+			pageMeta: readers.PageMetadata{
+				Limit:               limit,
+				Name:                "pressure",
+				NameCaseInsensitive: true,
+			},
+			messages: []senml.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Both handles connect to the same database, while the
+	// queries each of them runs are counted separately.
+	open := func() (*flakyConnector, *sqlx.DB) {
+		connector, err := pq.NewConnector(dbURL)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		fc := &flakyConnector{Connector: connector}
+		return fc, sqlx.NewDb(sql.OpenDB(fc), "postgres")
+	}
+	primary, primaryDB := open()
+	defer primaryDB.Close()
+	replica, replicaDB := open()
+	defer replicaDB.Close()
+
+	cases := map[string]struct {
+		replica *sqlx.DB
+		call    func(repo preader.Repository) error
+		primary int
+		read    int
+	}{
+		"read messages from replica": {
+			replica: replicaDB,
+			call: func(repo preader.Repository) error {
+				_, err := repo.ReadAll(chanID, readers.PageMetadata{Limit: limit})
+				return err
+			},
+			primary: 0,
+			read:    1,
+		},
+		"aggregate messages on replica": {
+			replica: replicaDB,
+			call: func(repo preader.Repository) error {
+				_, err := repo.Aggregate(chanID, readers.PageMetadata{Aggregation: readers.AvgAggregation})
+				return err
+			},
+			primary: 0,
+			read:    1,
+		},
+		"delete messages on primary": {
+			replica: replicaDB,
+			call: func(repo preader.Repository) error {
+				_, err := repo.DeleteAll(chanID, readers.PageMetadata{To: now - float64(limit-1)})
+				return err
+			},
+			primary: 1,
+			read:    0,
+		},
+		"read messages from primary without replica": {
+			replica: nil,
+			call: func(repo preader.Repository) error {
+				_, err := repo.ReadAll(chanID, readers.PageMetadata{Limit: limit})
+				return err
+			},
+			primary: 1,
+			read:    0,
+		},
+	}
+
+	for desc, tc := range cases {
+		primary.calls, replica.calls = 0, 0
+		repo := preader.NewWithReplica(primaryDB, tc.replica)
+		err := tc.call(repo)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.primary, primary.calls, fmt.Sprintf("%s: expected %d primary queries got %d", desc, tc.primary, primary.calls))
+		assert.Equal(t, tc.read, replica.calls, fmt.Sprintf("%s: expected %d replica queries got %d", desc, tc.read, replica.calls))
+	}
+}
+
+func TestPoolOptions(t *testing.T) {
+	poolDB, err := sqlx.Open("postgres", dbURL)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	defer poolDB.Close()
+
+	preader.New(poolDB,
+		preader.WithMaxOpenConns(5),
+		preader.WithMaxIdleConns(1),
+		preader.WithConnMaxLifetime(time.Millisecond),
+	)
+
+	stats := poolDB.Stats()
+	assert.Equal(t, 5, stats.MaxOpenConnections, fmt.Sprintf("expected max open connections %d got %d", 5, stats.MaxOpenConnections))
+
+	// Connections released above the idle limit are closed.
+	conns := []*sql.Conn{}
+	for i := 0; i < 3; i++ {
+		conn, err := poolDB.Conn(context.Background())
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	stats = poolDB.Stats()
+	assert.Equal(t, 1, stats.Idle, fmt.Sprintf("expected %d idle connections got %d", 1, stats.Idle))
+	assert.Equal(t, int64(2), stats.MaxIdleClosed, fmt.Sprintf("expected %d connections closed as idle got %d", 2, stats.MaxIdleClosed))
+
+	// Expired idle connection is closed instead of being reused.
+	time.Sleep(10 * time.Millisecond)
+	err = poolDB.Ping()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	stats = poolDB.Stats()
+	assert.True(t, stats.MaxLifetimeClosed > 0, fmt.Sprintf("expected expired connections to be closed got %d", stats.MaxLifetimeClosed))
+}
+
+func TestPoolOptionsWithReplica(t *testing.T) {
+	primaryDB, err := sqlx.Open("postgres", dbURL)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	defer primaryDB.Close()
+	replicaDB, err := sqlx.Open("postgres", dbURL)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	defer replicaDB.Close()
+
+	preader.NewWithReplica(primaryDB, replicaDB,
+		preader.WithMaxOpenConns(5),
+		preader.WithMaxIdleConns(1),
+	)
+
+	for desc, db := range map[string]*sqlx.DB{"primary": primaryDB, "replica": replicaDB} {
+		stats := db.Stats()
+		assert.Equal(t, 5, stats.MaxOpenConnections, fmt.Sprintf("%s: expected max open connections %d got %d", desc, 5, stats.MaxOpenConnections))
+
+		conns := []*sql.Conn{}
+		for i := 0; i < 3; i++ {
+			conn, err := db.Conn(context.Background())
+			require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+		stats = db.Stats()
+		assert.Equal(t, 1, stats.Idle, fmt.Sprintf("%s: expected %d idle connections got %d", desc, 1, stats.Idle))
+	}
+}
+
+func TestPing(t *testing.T) {
+	closedDB, err := sqlx.Open("postgres", dbURL)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	err = closedDB.Close()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := map[string]struct {
+		db  *sqlx.DB
+		ctx context.Context
+		err bool
+	}{
+		"ping live database": {
+			db:  db,
+			ctx: context.Background(),
+			err: false,
+		},
+		"ping live database with cancelled context": {
+			db:  db,
+			ctx: cancelled,
+			err: true,
+		},
+		"ping closed database": {
+			db:  closedDB,
+			ctx: context.Background(),
+			err: true,
+		},
+	}
+
+	for desc, tc := range cases {
+		reader := preader.New(tc.db)
+		err := reader.Ping(tc.ctx)
+		assert.Equal(t, tc.err, err != nil, fmt.Sprintf("%s: expected error %t got %s", desc, tc.err, err))
+	}
+}
+
+func TestReadCBOR(t *testing.T) {
+	// Messages with CBOR payload are not written by any of the
+	// writers, so the table is populated directly.
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id        UUID,
+		created   BIGINT,
+		channel   VARCHAR(254),
+		subtopic  VARCHAR(254),
+		publisher VARCHAR(254),
+		protocol  TEXT,
+		payload   BYTEA,
+		PRIMARY KEY (id)
+	)`, cborFormat))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	payloads := []map[string]interface{}{
+		{"status": "ok", "sensor": map[string]interface{}{"temperature": 21.5, "humidity": float64(40)}},
+		{"status": "alarm", "sensor": map[string]interface{}{"temperature": 35.5}},
+		{"battery": 3.3},
+	}
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i, pld := range payloads {
+		msg := mfjson.Message{
+			Channel:   chanID,
+			Subtopic:  subtopic,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Created:   now - int64(i),
+			Payload:   pld,
+		}
+		messages = append(messages, msg)
+
+		flat, err := mfjson.Flatten(pld)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		data, err := cbor.Marshal(flat)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		id, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+		_, err = db.Exec(fmt.Sprintf(`INSERT INTO %s (id, created, channel, subtopic, publisher, protocol, payload)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`, cborFormat), id, msg.Created, msg.Channel, msg.Subtopic, msg.Publisher, msg.Protocol, data)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	}
+
+	reader := preader.New(db, preader.WithCBORFormats(cborFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []mfjson.Message
+	}{
+		"read CBOR messages": {
+			pageMeta: readers.PageMetadata{
+				Format: cborFormat,
+				Limit:  limit,
+			},
+			messages: messages,
+		},
+		"read CBOR messages with offset": {
+			pageMeta: readers.PageMetadata{
+				Format: cborFormat,
+				Offset: 1,
+				Limit:  limit,
+			},
+			messages: messages[1:],
+		},
+		"read CBOR messages ignoring payload filters": {
+			pageMeta: readers.PageMetadata{
+				Format:         cborFormat,
+				Limit:          limit,
+				PayloadFilters: map[string]interface{}{"status": "ok"},
+			},
+			messages: messages,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(messages), result.Total))
+	}
+
+	// Reading CBOR table as JSON fails to decode the payload.
+	jsonReader := preader.New(db, preader.WithFormats(cborFormat))
+	_, err = jsonReader.ReadAll(chanID, readers.PageMetadata{Format: cborFormat, Limit: limit})
+	assert.NotNil(t, err, "expected error reading CBOR payload as JSON")
+}
+
+func TestReadSenmlColumns(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Name:      msgName,
+			Unit:      "C",
+			Time:      now - float64(i),
+			Value:     &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Projected messages carry only time and value.
+	projected := []senml.Message{}
+	for _, m := range messages {
+		projected = append(projected, senml.Message{Time: m.Time, Value: m.Value})
+	}
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+		cursor   float64
+		err      error
+	}{
+		"read messages with projected columns": {
+			pageMeta: readers.PageMetadata{
+				Limit:   limit,
+				Columns: []string{"time", "value"},
+			},
+			messages: projected,
+			cursor:   messages[limit-1].Time,
+		},
+		"read messages with projected columns sorted by omitted column": {
+			pageMeta: readers.PageMetadata{
+				Limit:     limit / 2,
+				Columns:   []string{"value"},
+				Sort:      "time",
+				Direction: readers.AscDirection,
+			},
+			messages: []senml.Message{
+				{Value: messages[limit-1].Value},
+				{Value: messages[limit-2].Value},
+				{Value: messages[limit-3].Value},
+				{Value: messages[limit-4].Value},
+				{Value: messages[limit-5].Value},
+			},
+			cursor: messages[limit/2].Time,
+		},
+		"read messages without projected columns": {
+			pageMeta: readers.PageMetadata{
+				Limit: limit,
+			},
+			messages: messages,
+			cursor:   messages[limit-1].Time,
+		},
+		"read messages with invalid column": {
+			pageMeta: readers.PageMetadata{
+				Limit:   limit,
+				Columns: []string{"time", "pg_sleep(10)"},
+			},
+			err: readers.ErrInvalidColumn,
+		},
+		"read messages with JSON column": {
+			pageMeta: readers.PageMetadata{
+				Limit:   limit,
+				Columns: []string{"payload"},
+			},
+			err: readers.ErrInvalidColumn,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(limit), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, limit, result.Total))
+		assert.Equal(t, tc.cursor, result.Cursor, fmt.Sprintf("%s: expected cursor %f got %f", desc, tc.cursor, result.Cursor))
+	}
+}
+
+func TestReadAllLimit(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	maxLimit := uint64(2 * limit)
+
+	cases := map[string]struct {
+		reader  preader.Repository
+		limit   uint64
+		applied uint64
+		count   int
+	}{
+		"read with limit greater than maximum": {
+			reader:  preader.New(db, preader.WithMaxLimit(maxLimit)),
+			limit:   100000000,
+			applied: maxLimit,
+			count:   int(maxLimit),
+		},
+		"read with limit equal to maximum": {
+			reader:  preader.New(db, preader.WithMaxLimit(maxLimit)),
+			limit:   maxLimit,
+			applied: maxLimit,
+			count:   int(maxLimit),
+		},
+		"read with limit lower than maximum": {
+			reader:  preader.New(db, preader.WithMaxLimit(maxLimit)),
+			limit:   3,
+			applied: 3,
+			count:   3,
+		},
+		"read without limit": {
+			reader:  preader.New(db, preader.WithMaxLimit(maxLimit)),
+			limit:   0,
+			applied: 10,
+			count:   10,
+		},
+		"read without limit and maximum": {
+			reader:  preader.New(db),
+			limit:   0,
+			applied: 10,
+			count:   10,
+		},
+		"read with large limit without maximum": {
+			reader:  preader.New(db),
+			limit:   100000000,
+			applied: 100000000,
+			count:   len(messages),
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := tc.reader.ReadAll(chanID, readers.PageMetadata{Limit: tc.limit})
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, fromSenml(messages[:tc.count]), result.Messages, fmt.Sprintf("%s: expected %d messages got %d", desc, tc.count, len(result.Messages)))
+		assert.Equal(t, tc.applied, result.Limit, fmt.Sprintf("%s: expected limit %d got %d", desc, tc.applied, result.Limit))
+	}
+}
+
+func TestReadAllStatementTimeout(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	msg := mfjson.Message{
+		Channel:  chanID,
+		Protocol: mqttProt,
+		Created:  time.Now().Unix(),
+		Payload:  map[string]interface{}{"temperature": float64(20)},
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   []mfjson.Message{msg},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Reading from the view takes at least a second.
+	slowFormat := "slow_json_messages"
+	_, err = db.Exec(fmt.Sprintf(`CREATE OR REPLACE VIEW %s AS SELECT m.* FROM %s AS m CROSS JOIN pg_sleep(1)`, slowFormat, jsonFormat))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	cases := map[string]struct {
+		reader   preader.Repository
+		ctx      context.Context
+		format   string
+		messages []mfjson.Message
+		err      error
+	}{
+		"read slow query with statement timeout": {
+			reader: preader.New(db, preader.WithFormats(slowFormat), preader.WithStatementTimeout(100*time.Millisecond)),
+			ctx:    context.Background(),
+			format: slowFormat,
+			err:    readers.ErrQueryTimeout,
+		},
+		"read slow query with expired context": {
+			reader: preader.New(db, preader.WithFormats(slowFormat), preader.WithStatementTimeout(10*time.Second)),
+			ctx:    expired,
+			format: slowFormat,
+			err:    context.DeadlineExceeded,
+		},
+		"read slow query without statement timeout": {
+			reader:   preader.New(db, preader.WithFormats(slowFormat)),
+			ctx:      context.Background(),
+			format:   slowFormat,
+			messages: []mfjson.Message{msg},
+		},
+		"read fast query with statement timeout": {
+			reader:   preader.New(db, preader.WithFormats(jsonFormat), preader.WithStatementTimeout(10*time.Second)),
+			ctx:      context.Background(),
+			format:   jsonFormat,
+			messages: []mfjson.Message{msg},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := tc.reader.ReadAllContext(tc.ctx, chanID, readers.PageMetadata{
+			Format: tc.format,
+			Limit:  limit,
+		})
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.ElementsMatch(t, fromJSON(tc.messages), withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+	}
+}
+
+func TestReadSenmlDedup(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	publishers := []string{}
+	for i := 0; i < 2; i++ {
+		pubID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		publishers = append(publishers, pubID)
+	}
+
+	// Each publisher sends the same readings at the same time,
+	// and every reading is delivered twice.
+	unique := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: publishers[i%2],
+			Protocol:  mqttProt,
+			Time:      now - float64(i/2),
+			Value:     &v,
+		}
+		unique = append(unique, msg)
+	}
+	messages := append(unique, unique...)
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+		total    uint64
+	}{
+		"read messages with duplicates": {
+			pageMeta: readers.PageMetadata{
+				Limit: 2 * limit,
+			},
+			messages: messages,
+			total:    2 * limit,
+		},
+		"read deduplicated messages": {
+			pageMeta: readers.PageMetadata{
+				Limit: 2 * limit,
+				Dedup: true,
+			},
+			messages: unique,
+			total:    limit,
+		},
+		"read deduplicated messages of publisher": {
+			pageMeta: readers.PageMetadata{
+				Limit:     2 * limit,
+				Publisher: publishers[0],
+				Dedup:     true,
+			},
+			messages: []senml.Message{unique[0], unique[2], unique[4], unique[6], unique[8]},
+			total:    limit / 2,
+		},
+		"read deduplicated messages page": {
+			pageMeta: readers.PageMetadata{
+				Offset: limit - 2,
+				Limit:  2 * limit,
+				Dedup:  true,
+			},
+			messages: unique[limit-2:],
+			total:    limit,
+		},
+		"read deduplicated messages past the last page": {
+			pageMeta: readers.PageMetadata{
+				Offset: 2 * limit,
+				Limit:  limit,
+				Dedup:  true,
+			},
+			messages: []senml.Message{},
+			total:    limit,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, tc.total, result.Total, fmt.Sprintf("%s: expected %d got %d", desc, tc.total, result.Total))
+	}
+}
+
+func TestLatestMany(t *testing.T) {
+	writer := pwriter.New(db)
+
+	channels := []string{}
+	for i := 0; i < 4; i++ {
+		chanID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		channels = append(channels, chanID)
+	}
+
+	// Each of the first three channels has more messages than
+	// the previous one, published less recently. The last
+	// channel has no messages.
+	latest := map[string]senml.Message{}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i, ch := range channels[:3] {
+		for j := 0; j <= i; j++ {
+			msg := senml.Message{
+				Channel:  ch,
+				Subtopic: fmt.Sprintf("subtopic-%d", j),
+				Protocol: mqttProt,
+				Time:     now - float64(10*i+j),
+				Value:    &v,
+			}
+			messages = append(messages, msg)
+			if j == 0 {
+				latest[ch] = msg
+			}
+		}
+	}
+	err := writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		channels []string
+		pageMeta readers.PageMetadata
+		latest   map[string]readers.Message
+	}{
+		"read latest messages of all channels": {
+			channels: channels,
+			pageMeta: readers.PageMetadata{},
+			latest: map[string]readers.Message{
+				channels[0]: latest[channels[0]],
+				channels[1]: latest[channels[1]],
+				channels[2]: latest[channels[2]],
+			},
+		},
+		"read latest messages of single channel": {
+			channels: channels[1:2],
+			pageMeta: readers.PageMetadata{},
+			latest: map[string]readers.Message{
+				channels[1]: latest[channels[1]],
+			},
+		},
+		"read latest messages with subtopic": {
+			channels: channels,
+			pageMeta: readers.PageMetadata{Subtopic: "subtopic-1"},
+			latest: map[string]readers.Message{
+				channels[1]: messages[2],
+				channels[2]: messages[4],
+			},
+		},
+		"read latest messages of channels without messages": {
+			channels: channels[3:],
+			pageMeta: readers.PageMetadata{},
+			latest:   map[string]readers.Message{},
+		},
+		"read latest messages of no channels": {
+			channels: []string{},
+			pageMeta: readers.PageMetadata{},
+			latest:   map[string]readers.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		latest, err := reader.LatestMany(tc.channels, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.latest, latest, fmt.Sprintf("%s: expected %v got %v", desc, tc.latest, latest))
+	}
+}
+
+func TestMessage(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	otherChanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	missingID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	now := time.Now().Unix()
+	senmlMsg := senml.Message{
+		Channel:  chanID,
+		Protocol: mqttProt,
+		Name:     msgName,
+		Time:     float64(now),
+		Value:    &v,
+	}
+	err = writer.Consume([]senml.Message{senmlMsg})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	jsonMsg := mfjson.Message{
+		Channel:  chanID,
+		Protocol: mqttProt,
+		Created:  now,
+		Payload:  map[string]interface{}{"temperature": float64(20)},
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   []mfjson.Message{jsonMsg},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Message IDs are generated by the writer.
+	var senmlID, jsonID string
+	err = db.QueryRow(`SELECT id FROM messages WHERE channel = $1`, chanID).Scan(&senmlID)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	err = db.QueryRow(fmt.Sprintf(`SELECT id FROM %s WHERE channel = $1`, jsonFormat), chanID).Scan(&jsonID)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	expectedJSON := fromJSON([]mfjson.Message{jsonMsg})[0].(map[string]interface{})
+	expectedJSON["id"] = jsonID
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		chanID   string
+		id       string
+		pageMeta readers.PageMetadata
+		msg      readers.Message
+		err      error
+	}{
+		"read SenML message by ID": {
+			chanID:   chanID,
+			id:       senmlID,
+			pageMeta: readers.PageMetadata{},
+			msg:      senmlMsg,
+		},
+		"read JSON message by ID": {
+			chanID:   chanID,
+			id:       jsonID,
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			msg:      expectedJSON,
+		},
+		"read message by ID from wrong channel": {
+			chanID:   otherChanID,
+			id:       senmlID,
+			pageMeta: readers.PageMetadata{},
+			err:      readers.ErrNotFound,
+		},
+		"read message by ID from wrong format": {
+			chanID:   chanID,
+			id:       senmlID,
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			err:      readers.ErrNotFound,
+		},
+		"read message by missing ID": {
+			chanID:   chanID,
+			id:       missingID,
+			pageMeta: readers.PageMetadata{},
+			err:      readers.ErrNotFound,
+		},
+		"read message by malformed ID": {
+			chanID:   chanID,
+			id:       wrongID,
+			pageMeta: readers.PageMetadata{},
+			err:      readers.ErrNotFound,
+		},
+		"read message from unregistered format": {
+			chanID:   chanID,
+			id:       senmlID,
+			pageMeta: readers.PageMetadata{Format: "pg_user"},
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		msg, err := reader.Message(tc.chanID, tc.id, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		assert.Equal(t, tc.msg, msg, fmt.Sprintf("%s: expected %v got %v", desc, tc.msg, msg))
+	}
+}
+
+func TestReadSenmlValueKind(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages carry value of a single kind, in turns.
+	stringMsgs := []senml.Message{}
+	boolMsgs := []senml.Message{}
+	dataMsgs := []senml.Message{}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 2*limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+		}
+		switch i % 4 {
+		case 0:
+			msg.Value = &v
+		case 1:
+			msg.StringValue = &vs
+			stringMsgs = append(stringMsgs, msg)
+		case 2:
+			msg.BoolValue = &vb
+			boolMsgs = append(boolMsgs, msg)
+		case 3:
+			msg.DataValue = &vd
+			dataMsgs = append(dataMsgs, msg)
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with string value": {
+			pageMeta: readers.PageMetadata{
+				Limit:          2 * limit,
+				HasStringValue: true,
+			},
+			messages: stringMsgs,
+		},
+		"read messages with bool value": {
+			pageMeta: readers.PageMetadata{
+				Limit:        2 * limit,
+				HasBoolValue: true,
+			},
+			messages: boolMsgs,
+		},
+		"read messages with data value": {
+			pageMeta: readers.PageMetadata{
+				Limit:        2 * limit,
+				HasDataValue: true,
+			},
+			messages: dataMsgs,
+		},
+		"read messages with string and bool value": {
+			pageMeta: readers.PageMetadata{
+				Limit:          2 * limit,
+				HasStringValue: true,
+				HasBoolValue:   true,
+			},
+			messages: []senml.Message{},
+		},
+		"read messages of any value kind": {
+			pageMeta: readers.PageMetadata{
+				Limit: 2 * limit,
+			},
+			messages: messages,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlDataValueNotEmpty(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages carry non-empty, empty or no data value, in turns.
+	empty := ""
+	nonEmpty := []senml.Message{}
+	emptyMsgs := []senml.Message{}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+		}
+		switch i % 3 {
+		case 0:
+			msg.DataValue = &vd
+			nonEmpty = append(nonEmpty, msg)
+		case 1:
+			msg.DataValue = &empty
+			emptyMsgs = append(emptyMsgs, msg)
+		case 2:
+			msg.Value = &v
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with non-empty data value": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				DataValueNotEmpty: true,
+			},
+			messages: nonEmpty,
+		},
+		"read messages with non-empty data value and time window": {
+			pageMeta: readers.PageMetadata{
+				Limit:             3 * limit,
+				DataValueNotEmpty: true,
+				From:              messages[9].Time,
+			},
+			messages: nonEmpty[:4],
+		},
+		"read messages with any data value": {
+			pageMeta: readers.PageMetadata{
+				Limit:        3 * limit,
+				HasDataValue: true,
+			},
+			messages: append(append([]senml.Message{}, nonEmpty...), emptyMsgs...),
+		},
+		"read messages without data value filter": {
+			pageMeta: readers.PageMetadata{
+				Limit: 3 * limit,
+			},
+			messages: messages,
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestReadSenmlChannels(t *testing.T) {
+	writer := pwriter.New(db)
+
+	channels := []string{}
+	for i := 0; i < 3; i++ {
+		chanID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		channels = append(channels, chanID)
+	}
+	otherChanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Channel messages are interleaved in time.
+	chanMsgs := map[string][]senml.Message{}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		chanID := channels[i%3]
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		chanMsgs[chanID] = append(chanMsgs[chanID], msg)
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		chanID   string
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages of single channel": {
+			chanID:   channels[0],
+			pageMeta: readers.PageMetadata{Limit: 3 * limit},
+			messages: chanMsgs[channels[0]],
+		},
+		"read messages of multiple channels": {
+			chanID: channels[0],
+			pageMeta: readers.PageMetadata{
+				Limit:    3 * limit,
+				Channels: channels[1:],
+			},
+			messages: messages,
+		},
+		"read messages of multiple channels with duplicate": {
+			chanID: channels[0],
+			pageMeta: readers.PageMetadata{
+				Limit:    3 * limit,
+				Channels: []string{channels[0], channels[2]},
+			},
+			messages: append(append([]senml.Message{}, chanMsgs[channels[0]]...), chanMsgs[channels[2]]...),
+		},
+		"read messages page of multiple channels": {
+			chanID: channels[0],
+			pageMeta: readers.PageMetadata{
+				Limit:    limit,
+				Channels: channels[1:],
+			},
+			messages: messages[:limit],
+		},
+		"read messages of channel without messages along with others": {
+			chanID: otherChanID,
+			pageMeta: readers.PageMetadata{
+				Limit:    3 * limit,
+				Channels: channels[1:2],
+			},
+			messages: chanMsgs[channels[1]],
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(tc.chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+	}
+
+	// Deleting messages of multiple channels still has to be forced.
+	_, err = reader.DeleteAll(channels[0], readers.PageMetadata{Channels: channels[1:]})
+	assert.Equal(t, readers.ErrUnfilteredDelete, err, fmt.Sprintf("expected %s got %s", readers.ErrUnfilteredDelete, err))
+}
+
+func TestReadSenmlNullValues(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Rows are inserted directly, since writer never stores NULL time.
+	zero := float64(0)
+	now := float64(time.Now().Unix())
+	q := `INSERT INTO messages (id, channel, publisher, protocol, time, value)
+		VALUES ($1, $2, $3, $4, $5, $6);`
+	nullID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = db.Exec(q, nullID, chanID, pubID, mqttProt, now, nil)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	zeroID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = db.Exec(q, zeroID, chanID, pubID, mqttProt, now-1, zero)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db)
+	result, err := reader.ReadAll(chanID, readers.PageMetadata{Limit: limit})
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	require.Len(t, result.Messages, 2, fmt.Sprintf("expected 2 messages got %d", len(result.Messages)))
+
+	expected := []senml.Message{
+		{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now,
+		},
+		{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - 1,
+			Value:     &zero,
+		},
+	}
+	for i, msg := range result.Messages {
+		assert.Equal(t, expected[i], msg, fmt.Sprintf("expected %v got %v", expected[i], msg))
+	}
+	assert.Nil(t, result.Messages[0].(senml.Message).Value, "expected absent value to be nil")
+	assert.NotNil(t, result.Messages[1].(senml.Message).Value, "expected zero value to be present")
+}
+
+func TestReadLast(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID2, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages are written from the newest to the oldest one.
+	messages := []senml.Message{}
+	pubMsgs := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < msgsNum; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		if i%2 == 0 {
+			msg.Publisher = pubID2
+		} else {
+			pubMsgs = append(pubMsgs, msg)
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		n        uint64
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read last messages": {
+			n:        limit,
+			messages: messages[0:limit],
+		},
+		"read last messages ignoring paging": {
+			n: limit,
+			pageMeta: readers.PageMetadata{
+				Limit:     msgsNum,
+				Offset:    limit,
+				Direction: readers.AscDirection,
+			},
+			messages: messages[0:limit],
+		},
+		"read last messages with publisher": {
+			n: limit,
+			pageMeta: readers.PageMetadata{
+				Publisher: pubID,
+			},
+			messages: pubMsgs[0:limit],
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadLast(chanID, tc.n, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.n, result.Limit, fmt.Sprintf("%s: expected limit %d got %d", desc, tc.n, result.Limit))
+		assert.ElementsMatch(t, tc.messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		for i := 1; i < len(result.Messages); i++ {
+			prev, cur := result.Messages[i-1].(senml.Message), result.Messages[i].(senml.Message)
+			assert.True(t, prev.Time > cur.Time, fmt.Sprintf("%s: expected descending time order got %f before %f", desc, prev.Time, cur.Time))
+		}
+	}
+}
+
+func TestFirstPerPublisher(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	publishers := []string{}
+	for i := 0; i < 3; i++ {
+		pubID, err := idProvider.ID()
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		publishers = append(publishers, pubID)
+	}
+	sort.Strings(publishers)
+
+	// Messages of each publisher are sorted from the oldest to the
+	// newest. The last publisher has fewer messages than the others.
+	messages := map[string][]senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i, pub := range publishers {
+		count := limit
+		if i == len(publishers)-1 {
+			count = 2
+		}
+		for j := 0; j < count; j++ {
+			msg := senml.Message{
+				Channel:   chanID,
+				Publisher: pub,
+				Subtopic:  subtopic,
+				Protocol:  mqttProt,
+				Time:      now - float64(10*limit-10*j-i),
+				Value:     &v,
+			}
+			messages[pub] = append(messages[pub], msg)
+			all = append(all, msg)
+		}
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	first := func(n int, from int) []readers.Message {
+		ret := []readers.Message{}
+		for _, pub := range publishers {
+			msgs := messages[pub][from:]
+			if len(msgs) > n {
+				msgs = msgs[:n]
+			}
+			ret = append(ret, fromSenml(msgs)...)
+		}
+		return ret
+	}
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		n        int
+		messages []readers.Message
+	}{
+		"read first message per publisher": {
+			pageMeta: readers.PageMetadata{},
+			n:        1,
+			messages: first(1, 0),
+		},
+		"read first three messages per publisher": {
+			pageMeta: readers.PageMetadata{},
+			n:        3,
+			messages: first(3, 0),
+		},
+		"read more messages per publisher than some of them have": {
+			pageMeta: readers.PageMetadata{},
+			n:        5,
+			messages: first(5, 0),
+		},
+		"read first messages per publisher within time window": {
+			pageMeta: readers.PageMetadata{From: messages[publishers[0]][1].Time},
+			n:        2,
+			messages: first(2, 1),
+		},
+		"read first messages per publisher with non-existent subtopic": {
+			pageMeta: readers.PageMetadata{Subtopic: "not-present"},
+			n:        2,
+			messages: []readers.Message{},
+		},
+		"read no messages per publisher": {
+			pageMeta: readers.PageMetadata{},
+			n:        0,
+			messages: []readers.Message{},
+		},
+	}
+
+	for desc, tc := range cases {
+		msgs, err := reader.FirstPerPublisher(chanID, tc.pageMeta, tc.n)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.messages, msgs, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, msgs))
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat), preader.WithMaxLimit(limit))
+
+	cases := map[string]struct {
+		pageMeta  readers.PageMetadata
+		fragments []string
+		params    map[string]interface{}
+		err       error
+	}{
+		"build default query": {
+			pageMeta: readers.PageMetadata{},
+			fragments: []string{
+				"SELECT *, time AS page_time",
+				"COUNT(*) OVER () AS total FROM messages WHERE channel = :channel",
+				") AS counted ORDER BY time DESC",
+				"LIMIT :limit OFFSET :offset",
+			},
+			params: map[string]interface{}{"channel": chanID, "limit": uint64(limit), "offset": uint64(0)},
+		},
+		"build query with value filter": {
+			pageMeta: readers.PageMetadata{Value: v, Comparator: readers.GreaterThanKey},
+			fragments: []string{
+				"WHERE channel = :channel AND value > :value",
+			},
+			params: map[string]interface{}{"value": v},
+		},
+		"build query with cursor and sort": {
+			pageMeta: readers.PageMetadata{Before: 100, Sort: "value", Direction: readers.AscDirection},
+			fragments: []string{
+				"SELECT *, 0 AS total FROM messages WHERE channel = :channel AND TRUE AND time < :before ) AS counted ORDER BY value ASC",
+			},
+			params: map[string]interface{}{"before": float64(100)},
+		},
+		"build JSON query with columns and estimated count": {
+			pageMeta: readers.PageMetadata{
+				Format:    jsonFormat,
+				Columns:   []string{"publisher", "payload"},
+				CountMode: readers.EstimateCount,
+				Limit:     2 * limit,
+			},
+			fragments: []string{
+				"SELECT publisher, payload, total, CAST(created AS FLOAT) / 1e9 AS page_time",
+				fmt.Sprintf("SELECT *, 0 AS total FROM %s WHERE channel = :channel", jsonFormat),
+				"ORDER BY CAST(created AS FLOAT) / 1e9 DESC",
+			},
+			params: map[string]interface{}{"limit": uint64(limit)},
+		},
+		"build query with invalid format": {
+			pageMeta: readers.PageMetadata{Format: "messages; DROP TABLE messages"},
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		q, params, err := reader.BuildQuery(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		// Whitespace the query is formatted with is irrelevant.
+		q = strings.Join(strings.Fields(q), " ")
+		for _, f := range tc.fragments {
+			assert.Contains(t, q, f, fmt.Sprintf("%s: expected query to contain %s got %s", desc, f, q))
+		}
+		for k, val := range tc.params {
+			assert.Equal(t, val, params[k], fmt.Sprintf("%s: expected param %s to be %v got %v", desc, k, val, params[k]))
+		}
+	}
+}
+
+func TestReadSenmlToInclusive(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// The message at index 2 is exactly at the upper time bound.
+	to := messages[2].Time
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []senml.Message
+	}{
+		"read messages with exclusive upper bound": {
+			pageMeta: readers.PageMetadata{
+				Limit: limit,
+				To:    to,
+			},
+			messages: messages[3:],
+		},
+		"read messages with inclusive upper bound": {
+			pageMeta: readers.PageMetadata{
+				Limit:       limit,
+				To:          to,
+				ToInclusive: true,
+			},
+			messages: messages[2:],
+		},
+		"read messages with inclusive upper and lower bound": {
+			pageMeta: readers.PageMetadata{
+				Limit:       limit,
+				From:        to,
+				To:          to,
+				ToInclusive: true,
+			},
+			messages: messages[2:3],
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, fromSenml(tc.messages), result.Messages, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+}
+
+func TestTimeSpan(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	emptyID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	jsonID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Publisher has sent only the newest half of messages.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		if i < limit/2 {
+			msg.Publisher = pubID
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// JSON messages are created in nanoseconds.
+	jsonMsgs := []mfjson.Message{}
+	for i := 0; i < limit; i++ {
+		jsonMsgs = append(jsonMsgs, mfjson.Message{
+			Channel:  jsonID,
+			Protocol: mqttProt,
+			Created:  (int64(now) - int64(i)) * int64(time.Second),
+			Payload:  map[string]interface{}{"temperature": float64(i)},
+		})
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   jsonMsgs,
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	toTime := func(secs float64) time.Time {
+		return time.Unix(int64(secs), 0).UTC()
+	}
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		chanID   string
+		pageMeta readers.PageMetadata
+		min      time.Time
+		max      time.Time
+	}{
+		"read time span of channel": {
+			chanID: chanID,
+			min:    toTime(now - float64(limit-1)),
+			max:    toTime(now),
+		},
+		"read time span of publisher": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Publisher: pubID},
+			min:      toTime(now - float64(limit/2-1)),
+			max:      toTime(now),
+		},
+		"read time span of empty channel": {
+			chanID: emptyID,
+			min:    time.Time{},
+			max:    time.Time{},
+		},
+		"read time span of JSON messages": {
+			chanID:   jsonID,
+			pageMeta: readers.PageMetadata{Format: jsonFormat},
+			min:      toTime(now - float64(limit-1)),
+			max:      toTime(now),
+		},
+	}
+
+	for desc, tc := range cases {
+		min, max, err := reader.TimeSpan(tc.chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.min, min, fmt.Sprintf("%s: expected min %s got %s", desc, tc.min, min))
+		assert.Equal(t, tc.max, max, fmt.Sprintf("%s: expected max %s got %s", desc, tc.max, max))
+	}
+}
+
+func TestExists(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < msgsNum; i++ {
+		msg := senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      now - float64(i),
+			Value:     &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		exists   bool
+	}{
+		"check existence of messages": {
+			pageMeta: readers.PageMetadata{},
+			exists:   true,
+		},
+		"check existence of messages with matching filter": {
+			pageMeta: readers.PageMetadata{Publisher: pubID, From: now - 1},
+			exists:   true,
+		},
+		"check existence of messages with non-matching filter": {
+			pageMeta: readers.PageMetadata{Publisher: pubID, From: now + 1},
+			exists:   false,
+		},
+	}
+
+	for desc, tc := range cases {
+		exists, err := reader.Exists(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, tc.exists, exists, fmt.Sprintf("%s: expected %t got %t", desc, tc.exists, exists))
+	}
+
+	// Each message read from the view advances the sequence, so the
+	// number of scanned messages is known.
+	scanFormat := "scanned_messages"
+	_, err = db.Exec(`CREATE SEQUENCE IF NOT EXISTS scanned_messages_seq`)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = db.Exec(fmt.Sprintf(`CREATE OR REPLACE VIEW %s AS SELECT m.* FROM (
+		SELECT * FROM messages WHERE channel = '%s' OFFSET 0
+	) AS m WHERE nextval('scanned_messages_seq') > 0`, scanFormat, chanID))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	var start uint64
+	err = db.QueryRow(`SELECT nextval('scanned_messages_seq')`).Scan(&start)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader = preader.New(db, preader.WithFormats(scanFormat))
+	exists, err := reader.Exists(chanID, readers.PageMetadata{Format: scanFormat})
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	assert.True(t, exists, "expected messages to exist")
+
+	var end uint64
+	err = db.QueryRow(`SELECT nextval('scanned_messages_seq')`).Scan(&end)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	scanned := end - start - 1
+	assert.Equal(t, uint64(1), scanned, fmt.Sprintf("expected 1 scanned message got %d", scanned))
+}
+
+func TestReadGroupedBySubtopic(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Messages of three subtopics are written in turns.
+	subtopics := []string{"temperature", "humidity", "pressure"}
+	groups := map[string][]senml.Message{}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*limit; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: subtopics[i%3],
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		groups[msg.Subtopic] = append(groups[msg.Subtopic], msg)
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		groups   map[string][]senml.Message
+	}{
+		"read messages grouped by subtopic": {
+			pageMeta: readers.PageMetadata{Limit: 3 * limit},
+			groups:   groups,
+		},
+		"read messages grouped by subtopic in ascending order": {
+			pageMeta: readers.PageMetadata{Limit: 3 * limit, Direction: readers.AscDirection},
+			groups: map[string][]senml.Message{
+				subtopics[0]: reversed(groups[subtopics[0]]),
+				subtopics[1]: reversed(groups[subtopics[1]]),
+				subtopics[2]: reversed(groups[subtopics[2]]),
+			},
+		},
+		"read page of messages grouped by subtopic": {
+			pageMeta: readers.PageMetadata{Limit: 4},
+			groups: map[string][]senml.Message{
+				subtopics[0]: groups[subtopics[0]][:2],
+				subtopics[1]: groups[subtopics[1]][:1],
+				subtopics[2]: groups[subtopics[2]][:1],
+			},
+		},
+		"read messages of a single subtopic grouped by subtopic": {
+			pageMeta: readers.PageMetadata{Limit: 3 * limit, Subtopic: subtopics[1]},
+			groups:   map[string][]senml.Message{subtopics[1]: groups[subtopics[1]]},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadGroupedBySubtopic(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Len(t, result, len(tc.groups), fmt.Sprintf("%s: expected %d groups got %d", desc, len(tc.groups), len(result)))
+		for subtopic, msgs := range tc.groups {
+			assert.Equal(t, fromSenml(msgs), result[subtopic], fmt.Sprintf("%s: expected %v got %v", desc, msgs, result[subtopic]))
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		table    string
+		err      error
+	}{
+		"explain reading SenML messages": {
+			pageMeta: readers.PageMetadata{Limit: limit},
+			table:    "messages",
+		},
+		"explain reading SenML messages with filters": {
+			pageMeta: readers.PageMetadata{
+				Limit:     limit,
+				Subtopic:  "temperature",
+				Publisher: "publisher",
+				From:      1,
+			},
+			table: "messages",
+		},
+		"explain reading JSON messages": {
+			pageMeta: readers.PageMetadata{Format: jsonFormat, Limit: limit},
+			table:    jsonFormat,
+		},
+		"explain reading messages with invalid format": {
+			pageMeta: readers.PageMetadata{Format: "unknown"},
+			err:      readers.ErrInvalidFormat,
+		},
+	}
+
+	for desc, tc := range cases {
+		plan, err := reader.Explain(chanID, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		var explained []map[string]interface{}
+		err = json.Unmarshal([]byte(plan), &explained)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected valid JSON plan got %s", desc, err))
+		assert.NotEmpty(t, explained, fmt.Sprintf("%s: expected non-empty plan", desc))
+		relation := fmt.Sprintf(`"Relation Name": %q`, tc.table)
+		assert.Contains(t, plan, relation, fmt.Sprintf("%s: expected plan to read %s got %s", desc, tc.table, plan))
+	}
+}
+
+func TestBuildQueryDeterministic(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		cond     string
+	}{
+		"build SenML query with multiple filters": {
+			pageMeta: readers.PageMetadata{
+				Subtopic:     "room",
+				Publisher:    pubID,
+				Name:         "temperature",
+				Protocol:     mqttProt,
+				Value:        v,
+				Comparator:   readers.GreaterThanKey,
+				StringValue:  vs,
+				From:         1,
+				To:           2,
+				Unit:         "C",
+				SumFrom:      3,
+				HasBoolValue: true,
+			},
+			cond: "channel = :channel AND subtopic = :subtopic AND publisher = :publisher AND name = :name AND protocol = :protocol AND value > :value AND string_value = :string_value AND time >= :from AND time < :to AND unit = :unit AND sum >= :sum_from AND bool_value IS NOT NULL",
+		},
+		"build SenML query with protocol, subtopic prefix and time window": {
+			pageMeta: readers.PageMetadata{
+				Protocol:       "coap",
+				SubtopicPrefix: "building/floor2/",
+				From:           1,
+				To:             2,
+			},
+			cond: "channel = :channel AND protocol = :protocol AND time >= :from AND time < :to AND subtopic LIKE :subtopic_prefix || '%'",
+		},
+		"build JSON query with multiple payload filters": {
+			pageMeta: readers.PageMetadata{
+				Format:    jsonFormat,
+				Publisher: pubID,
+				From:      1,
+				PayloadFilters: map[string]interface{}{
+					"status":      "alarm",
+					"temperature": 30,
+					"humidity":    40,
+					"pressure":    1000,
+				},
+			},
+			cond: "channel = :channel AND publisher = :publisher AND CAST(created AS FLOAT) / 1e9 >= :from AND payload->CAST(:payload_key_0 AS TEXT) = CAST(:payload_value_0 AS JSONB) AND payload->CAST(:payload_key_1 AS TEXT) = CAST(:payload_value_1 AS JSONB) AND payload->CAST(:payload_key_2 AS TEXT) = CAST(:payload_value_2 AS JSONB) AND payload->CAST(:payload_key_3 AS TEXT) = CAST(:payload_value_3 AS JSONB)",
+		},
+	}
+
+	for desc, tc := range cases {
+		expected, params, err := reader.BuildQuery(chanID, tc.pageMeta)
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		assert.Contains(t, expected, tc.cond, fmt.Sprintf("%s: expected query to contain %s got %s", desc, tc.cond, expected))
+		for i := 0; i < msgsNum; i++ {
+			q, p, err := reader.BuildQuery(chanID, tc.pageMeta)
+			require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+			require.Equal(t, expected, q, fmt.Sprintf("%s: expected query %s got %s", desc, expected, q))
+			require.Equal(t, params, p, fmt.Sprintf("%s: expected params %v got %v", desc, params, p))
+		}
+	}
+}
+
+func TestReadAllPageToken(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Each two messages share the same time, so pages
+	// may end in the middle of messages of the same time.
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 2*limit; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i/2),
+			Value:    &val,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]struct {
+		dir string
+		// Messages inserted between the pages, which are
+		// newer or older than all the initial messages.
+		insert float64
+	}{
+		"read pages in descending order with newer messages inserted": {
+			dir:    readers.DescDirection,
+			insert: now + 10,
+		},
+		"read pages in ascending order with older messages inserted": {
+			dir:    readers.AscDirection,
+			insert: now - float64(4*limit),
+		},
+	}
+
+	for desc, tc := range cases {
+		read := []readers.Message{}
+		pm := readers.PageMetadata{Limit: 3, Direction: tc.dir}
+		pages := 0
+		for {
+			page, err := reader.ReadAll(chanID, pm)
+			require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+			read = append(read, page.Messages...)
+			pages++
+			if page.NextPageToken == "" {
+				break
+			}
+			require.True(t, pages <= 2*limit, fmt.Sprintf("%s: expected paging to end", desc))
+
+			// New message doesn't belong to the remaining pages.
+			err = writer.Consume([]senml.Message{{
+				Channel:  chanID,
+				Protocol: mqttProt,
+				Time:     tc.insert,
+				Value:    &v,
+			}})
+			require.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+			pm.PageToken = page.NextPageToken
+		}
+
+		assert.ElementsMatch(t, fromSenml(messages), read, fmt.Sprintf("%s: expected %v got %v", desc, messages, read))
+		for i := 1; i < len(read); i++ {
+			prev, cur := read[i-1].(senml.Message), read[i].(senml.Message)
+			ordered := prev.Time >= cur.Time
+			if tc.dir == readers.AscDirection {
+				ordered = prev.Time <= cur.Time
+			}
+			assert.True(t, ordered, fmt.Sprintf("%s: expected messages in %s order got %f before %f", desc, tc.dir, prev.Time, cur.Time))
+		}
+
+		// Inserted messages are removed, so they don't affect the next case.
+		_, err = db.Exec(`DELETE FROM messages WHERE channel = $1 AND time = $2`, chanID, tc.insert)
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+	}
+}
+
+func TestReadAllInvalidPageToken(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db)
+
+	cases := map[string]readers.PageMetadata{
+		"read with malformed page token": {
+			PageToken: "not a token",
+		},
+		"read with page token without message ID": {
+			PageToken: "eyJ0IjoxfQ",
+		},
+		"read with page token with malformed message ID": {
+			PageToken: "eyJ0IjoxLCJpZCI6IjEyMyJ9",
+		},
+		"read with page token and value sort": {
+			PageToken: "eyJ0IjoxLCJpZCI6IjEyMyJ9",
+			Sort:      "value",
+		},
+	}
+
+	for desc, pm := range cases {
+		_, err := reader.ReadAll(chanID, pm)
+		assert.Equal(t, readers.ErrInvalidPageToken, err, fmt.Sprintf("%s: expected %s got %s", desc, readers.ErrInvalidPageToken, err))
+	}
+}
+
+func TestReadAllDefaultTable(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	now := time.Now().Unix()
+	senmlMsg := senml.Message{
+		Channel:  chanID,
+		Protocol: mqttProt,
+		Time:     float64(now),
+		Value:    &v,
+	}
+	err = writer.Consume([]senml.Message{senmlMsg})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	jsonMsg := mfjson.Message{
+		Channel:  chanID,
+		Protocol: mqttProt,
+		Created:  now,
+		Payload:  map[string]interface{}{"temperature": float64(20)},
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   []mfjson.Message{jsonMsg},
+		Format: jsonFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Writer stores SenML messages into the messages table only,
+	// so messages are copied into the table of the same layout.
+	senmlFormat := "archived_messages"
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE messages INCLUDING ALL)`, senmlFormat))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = db.Exec(fmt.Sprintf(`INSERT INTO %s SELECT * FROM messages WHERE channel = $1`, senmlFormat), chanID)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]struct {
+		reader   preader.Repository
+		format   string
+		json     bool
+		messages []readers.Message
+		err      error
+	}{
+		"read messages from default table": {
+			reader:   preader.New(db),
+			messages: fromSenml([]senml.Message{senmlMsg}),
+		},
+		"read messages from configured default table": {
+			reader:   preader.New(db, preader.WithFormats(jsonFormat), preader.WithDefaultTable(jsonFormat)),
+			json:     true,
+			messages: fromJSON([]mfjson.Message{jsonMsg}),
+		},
+		"read messages from configured SenML default table": {
+			reader:   preader.New(db, preader.WithSenMLFormats(senmlFormat), preader.WithDefaultTable(senmlFormat)),
+			messages: fromSenml([]senml.Message{senmlMsg}),
+		},
+		"read messages with format overriding configured default table": {
+			reader:   preader.New(db, preader.WithFormats(jsonFormat), preader.WithDefaultTable(jsonFormat)),
+			format:   "messages",
+			messages: fromSenml([]senml.Message{senmlMsg}),
+		},
+		"read messages from configured default table which is not allowed": {
+			reader: preader.New(db, preader.WithDefaultTable(jsonFormat)),
+			err:    readers.ErrInvalidFormat,
+		},
+		"read messages with allowed format overriding not allowed default table": {
+			reader:   preader.New(db, preader.WithDefaultTable("unknown_messages")),
+			format:   "messages",
+			messages: fromSenml([]senml.Message{senmlMsg}),
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := tc.reader.ReadAll(chanID, readers.PageMetadata{Format: tc.format, Limit: limit})
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		read := result.Messages
+		if tc.json {
+			read = withoutIDs(read)
+		}
+		assert.ElementsMatch(t, tc.messages, read, fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, read))
+	}
+}
+
+func TestReadAllEmpty(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	emptyID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	err = writer.Consume([]senml.Message{{
+		Channel:  chanID,
+		Protocol: mqttProt,
+		Time:     float64(time.Now().Unix()),
+		Value:    &v,
+	}})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(jsonFormat))
+
+	cases := map[string]struct {
+		chanID   string
+		pageMeta readers.PageMetadata
+	}{
+		"read messages of channel without messages": {
+			chanID:   emptyID,
+			pageMeta: readers.PageMetadata{Limit: limit},
+		},
+		"read messages with non-matching filter": {
+			chanID:   chanID,
+			pageMeta: readers.PageMetadata{Limit: limit, Subtopic: "not-present"},
+		},
+		"read messages with non-matching filter and estimated count": {
+			chanID: chanID,
+			pageMeta: readers.PageMetadata{
+				Limit:     limit,
+				Subtopic:  "not-present",
+				CountMode: readers.EstimateCount,
+			},
+		},
+		"read messages with offset of channel without messages": {
+			chanID:   emptyID,
+			pageMeta: readers.PageMetadata{Limit: limit, Offset: limit},
+		},
+		"read JSON messages of channel without messages": {
+			chanID:   emptyID,
+			pageMeta: readers.PageMetadata{Format: jsonFormat, Limit: limit},
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(tc.chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.NotNil(t, result.Messages, fmt.Sprintf("%s: expected non-nil messages", desc))
+		assert.Empty(t, result.Messages, fmt.Sprintf("%s: expected no messages got %v", desc, result.Messages))
+		assert.Equal(t, uint64(0), result.Total, fmt.Sprintf("%s: expected total 0 got %d", desc, result.Total))
+		assert.False(t, result.Estimated, fmt.Sprintf("%s: expected exact total", desc))
+	}
+}
+
+func TestReadAllInvalidFormat(t *testing.T) {
+	// Repository is created without DB, so any attempt to
+	// run a query with invalid format would panic.
+	reader := preader.New(nil, preader.WithFormats(jsonFormat))
+
+	cases := map[string]string{
+		"read with statement injection":  "messages; DROP TABLE messages; --",
+		"read with comment injection":    "messages --",
+		"read with subquery injection":   "(SELECT * FROM pg_user) AS m",
+		"read from unregistered table":   "pg_user",
+		"read with quoted table":         `"messages"`,
+		"read with schema-prefixed name": "public.messages",
+	}
+
+	for desc, format := range cases {
+		_, err := reader.ReadAll(wrongID, readers.PageMetadata{
+			Limit:  limit,
+			Format: format,
+		})
+		assert.Equal(t, readers.ErrInvalidFormat, err, fmt.Sprintf("%s: expected %s got %s", desc, readers.ErrInvalidFormat, err))
+	}
+}
+
+func TestReadAllQueryErrorCode(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Tables are allowed formats, but don't match the queries.
+	noCreated := "no_created_messages"
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id      UUID,
+		channel VARCHAR(254),
+		PRIMARY KEY (id)
+	)`, noCreated))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	intChannel := "int_channel_messages"
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id      UUID,
+		created BIGINT,
+		channel INTEGER,
+		PRIMARY KEY (id)
+	)`, intChannel))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db, preader.WithFormats(noCreated, intChannel))
+
+	cases := map[string]struct {
+		format string
+		code   string
+	}{
+		"read messages from table without time column": {
+			format: noCreated,
+			code:   "42703",
+		},
+		"read messages from table with mismatched channel type": {
+			format: intChannel,
+			code:   "22P02",
+		},
+	}
+
+	for desc, tc := range cases {
+		_, err := reader.ReadAll(chanID, readers.PageMetadata{Format: tc.format, Limit: limit})
+		var qe *preader.QueryError
+		require.True(t, stderrors.As(err, &qe), fmt.Sprintf("%s: expected query error got %s", desc, err))
+		assert.Equal(t, tc.code, qe.Code(), fmt.Sprintf("%s: expected code %s got %s", desc, tc.code, qe.Code()))
+		assert.True(t, errors.Contains(err, qe.Err()), fmt.Sprintf("%s: expected %s to contain database error", desc, err))
+
+		var pqErr *pq.Error
+		assert.True(t, stderrors.As(err, &pqErr), fmt.Sprintf("%s: expected %s to wrap database error", desc, err))
+	}
+}
+
+func TestReadAllMissingTable(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Format is allowed, but its table was never created.
+	missingFormat := "missing_messages"
+	reader := preader.New(db, preader.WithFormats(missingFormat))
+
+	cases := map[string]func() error{
+		"read all messages from missing table": func() error {
+			_, err := reader.ReadAll(chanID, readers.PageMetadata{Format: missingFormat, Limit: limit})
+			return err
+		},
+		"read publishers from missing table": func() error {
+			_, err := reader.Publishers(chanID, readers.PageMetadata{Format: missingFormat})
+			return err
+		},
+		"check existence of messages in missing table": func() error {
+			_, err := reader.Exists(chanID, readers.PageMetadata{Format: missingFormat})
+			return err
+		},
+	}
+
+	for desc, call := range cases {
+		err := call()
+		assert.True(t, stderrors.Is(err, readers.ErrTableNotFound), fmt.Sprintf("%s: expected %s got %s", desc, readers.ErrTableNotFound, err))
+	}
+}
+
+func fromSenml(in []senml.Message) []readers.Message {
+	var ret []readers.Message
+	for _, m := range in {
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func BenchmarkReadAllDeepPage(b *testing.B) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(b, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < benchMsgsNum; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(b, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	depth := benchMsgsNum - limit
+
+	b.Run("offset", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			reader.ReadAll(chanID, readers.PageMetadata{
+				Offset: uint64(depth),
+				Limit:  limit,
+			})
+		}
+	})
+
+	b.Run("cursor", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			reader.ReadAll(chanID, readers.PageMetadata{
+				Before: messages[depth-1].Time,
+				Limit:  limit,
+			})
+		}
+	})
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func reversed(in []senml.Message) []senml.Message {
+	var ret []senml.Message
+	for i := len(in) - 1; i >= 0; i-- {
+		ret = append(ret, in[i])
+	}
+	return ret
+}
+
+func fromJSON(in []mfjson.Message) []readers.Message {
+	var ret []readers.Message
+	for _, m := range in {
+		ret = append(ret, map[string]interface{}{
+			"channel":   m.Channel,
+			"created":   m.Created,
+			"subtopic":  m.Subtopic,
+			"publisher": m.Publisher,
+			"protocol":  m.Protocol,
+			"payload":   map[string]interface{}(m.Payload),
+		})
+	}
+	return ret
+}
+
+// withoutIDs removes generated IDs from JSON messages,
+// so they can be compared to the written ones.
+func withoutIDs(in []readers.Message) []readers.Message {
+	var ret []readers.Message
+	for _, m := range in {
+		msg := map[string]interface{}{}
+		for k, v := range m.(map[string]interface{}) {
+			if k != "id" {
+				msg[k] = v
+			}
+		}
+		ret = append(ret, msg)
+	}
+	return ret
+}
+
+func BenchmarkReadAllTotal(b *testing.B) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(b, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < benchMsgsNum; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(b, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db)
+	params := map[string]interface{}{
+		"channel": chanID,
+		"limit":   limit,
+		"offset":  0,
+	}
+
+	b.Run("single query", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			reader.ReadAll(chanID, readers.PageMetadata{Limit: limit})
+		}
+	})
+
+	b.Run("two queries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rows, err := db.NamedQuery(`SELECT * FROM messages WHERE channel = :channel
+				ORDER BY time DESC LIMIT :limit OFFSET :offset;`, params)
+			require.Nil(b, err, fmt.Sprintf("got unexpected error: %s", err))
+			for rows.Next() {
+				msg := map[string]interface{}{}
+				rows.MapScan(msg)
+			}
+			rows.Close()
+
+			rows, err = db.NamedQuery(`SELECT COUNT(*) FROM messages WHERE channel = :channel;`, params)
+			require.Nil(b, err, fmt.Sprintf("got unexpected error: %s", err))
+			rows.Close()
+		}
+	})
 }
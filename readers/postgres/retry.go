@@ -0,0 +1,95 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Classes and codes of errors caused by the database
+// state rather than by the query itself.
+const (
+	connectionExceptionClass = "08"
+	adminShutdownCode        = "57P01"
+	crashShutdownCode        = "57P02"
+	cannotConnectNowCode     = "57P03"
+)
+
+// WithRetry repeats read, including stream and aggregation, up to the given
+// number of attempts if query fails due to transient database error, such
+// as lost connection. Backoff between attempts starts with the given duration
+// and doubles after each attempt. Query errors and context cancellation are
+// never retried.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(tr *postgresRepository) {
+		tr.attempts = attempts
+		tr.backoff = backoff
+	}
+}
+
+// namedQuery runs named query, retrying it on transient errors.
+func (tr postgresRepository) namedQuery(ctx context.Context, q string, params interface{}) (*sqlx.Rows, error) {
+	rows, err := tr.query(ctx, q, params)
+	backoff := tr.backoff
+	for i := 1; i < tr.attempts && err != nil && transient(err); i++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		rows, err = tr.query(ctx, q, params)
+	}
+
+	return rows, err
+}
+
+// query runs named query using the cached prepared statement, if
+// statements are cached.
+func (tr postgresRepository) query(ctx context.Context, q string, params interface{}) (*sqlx.Rows, error) {
+	if tr.stmts == nil {
+		return tr.readDB().NamedQueryContext(ctx, q, params)
+	}
+
+	cs, err := tr.stmts.get(ctx, tr.readDB(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.stmts.release(cs)
+
+	return cs.stmt.QueryxContext(ctx, params)
+}
+
+// transient checks whether the error is caused by the database
+// connection, so that the same query may succeed later.
+func transient(err error) bool {
+	switch err {
+	case driver.ErrBadConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	case context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+
+	switch e := err.(type) {
+	case *pq.Error:
+		if e.Code.Class() == connectionExceptionClass {
+			return true
+		}
+		switch e.Code {
+		case adminShutdownCode, crashShutdownCode, cannotConnectNowCode:
+			return true
+		}
+	case net.Error:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,180 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mainflux/mainflux/readers"
+	preader "github.com/mainflux/mainflux/readers/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ driver.Connector = (*flakyConnector)(nil)
+
+// flakyConnector opens connections whose queries fail with
+// the given error the given number of times. Queries and
+// prepared statements of all the connections are counted.
+// Column lookups, which the reader caches, are neither
+// failed nor counted, so that only the queries of the
+// tested call are.
+type flakyConnector struct {
+	driver.Connector
+	failures int
+	err      error
+	calls    int
+	prepares int
+}
+
+func (fc *flakyConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := fc.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return flakyConn{Conn: conn, connector: fc}, nil
+}
+
+type flakyConn struct {
+	driver.Conn
+	connector *flakyConnector
+}
+
+func (fc flakyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.Contains(query, "information_schema") {
+		return fc.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	}
+	fc.connector.calls++
+	if fc.connector.calls <= fc.connector.failures {
+		return nil, fc.connector.err
+	}
+
+	return fc.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (fc flakyConn) Prepare(query string) (driver.Stmt, error) {
+	fc.connector.prepares++
+	return fc.Conn.Prepare(query)
+}
+
+func (fc flakyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	fc.connector.calls++
+	if fc.connector.calls <= fc.connector.failures {
+		return nil, fc.connector.err
+	}
+
+	return fc.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func TestReadAllRetry(t *testing.T) {
+	connFailure := &pq.Error{Code: "08006"}
+	syntaxError := &pq.Error{Code: "42601"}
+
+	cases := map[string]struct {
+		opts     []preader.Option
+		failures int
+		err      error
+		calls    int
+		fails    bool
+	}{
+		"read with retry after single connection failure": {
+			opts:     []preader.Option{preader.WithRetry(3, time.Millisecond)},
+			failures: 1,
+			err:      connFailure,
+			calls:    2,
+			fails:    false,
+		},
+		"read with retry after persistent connection failure": {
+			opts:     []preader.Option{preader.WithRetry(3, time.Millisecond)},
+			failures: 5,
+			err:      connFailure,
+			calls:    3,
+			fails:    true,
+		},
+		"read with retry after syntax error": {
+			opts:     []preader.Option{preader.WithRetry(3, time.Millisecond)},
+			failures: 1,
+			err:      syntaxError,
+			calls:    1,
+			fails:    true,
+		},
+		"read without retry after connection failure": {
+			failures: 1,
+			err:      connFailure,
+			calls:    1,
+			fails:    true,
+		},
+	}
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	for desc, tc := range cases {
+		connector, err := pq.NewConnector(dbURL)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		fc := &flakyConnector{Connector: connector, failures: tc.failures, err: tc.err}
+		flakyDB := sqlx.NewDb(sql.OpenDB(fc), "postgres")
+
+		reader := preader.New(flakyDB, tc.opts...)
+		_, err = reader.ReadAll(chanID, readers.PageMetadata{Limit: 1})
+		assert.Equal(t, tc.fails, err != nil, fmt.Sprintf("%s: expected error %t got %s", desc, tc.fails, err))
+		assert.Equal(t, tc.calls, fc.calls, fmt.Sprintf("%s: expected %d queries got %d", desc, tc.calls, fc.calls))
+		flakyDB.Close()
+	}
+}
+
+func TestReadRetry(t *testing.T) {
+	connFailure := &pq.Error{Code: "08006"}
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	cases := map[string]func(reader preader.Repository) error{
+		"aggregate messages": func(reader preader.Repository) error {
+			_, err := reader.Aggregate(chanID, readers.PageMetadata{Aggregation: readers.AvgAggregation})
+			return err
+		},
+		"count messages by interval": func(reader preader.Repository) error {
+			_, err := reader.CountByInterval(chanID, readers.PageMetadata{}, "hour")
+			return err
+		},
+		"read latest message": func(reader preader.Repository) error {
+			_, err := reader.Latest(chanID, readers.PageMetadata{})
+			if err == readers.ErrNotFound {
+				return nil
+			}
+			return err
+		},
+		"read subtopics": func(reader preader.Repository) error {
+			_, err := reader.Subtopics(chanID)
+			return err
+		},
+		"read columnar messages": func(reader preader.Repository) error {
+			_, err := reader.ReadColumnar(chanID, readers.PageMetadata{Limit: 1})
+			return err
+		},
+	}
+
+	for desc, read := range cases {
+		connector, err := pq.NewConnector(dbURL)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		fc := &flakyConnector{Connector: connector, failures: 1, err: connFailure}
+		flakyDB := sqlx.NewDb(sql.OpenDB(fc), "postgres")
+
+		reader := preader.New(flakyDB, preader.WithRetry(3, time.Millisecond))
+		err = read(reader)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.Equal(t, 2, fc.calls, fmt.Sprintf("%s: expected %d queries got %d", desc, 2, fc.calls))
+		flakyDB.Close()
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"context"
+
+	"github.com/mainflux/mainflux/readers"
+)
+
+// WithMaxConcurrentReads bounds the number of reads, such as messages pages
+// or aggregations, running at once, so that bursts of reads don't queue up
+// in the database. Read beyond the limit waits for a free slot until its
+// context deadline, while read whose context has no deadline fails
+// immediately. Either way, read which doesn't get a slot fails with
+// ErrTooManyRequests.
+func WithMaxConcurrentReads(n int) Option {
+	return func(tr *postgresRepository) {
+		if n > 0 {
+			tr.reads = make(chan struct{}, n)
+		}
+	}
+}
+
+// acquire takes a read slot, if reads are bounded.
+func (tr postgresRepository) acquire(ctx context.Context) error {
+	if tr.reads == nil {
+		return nil
+	}
+
+	select {
+	case tr.reads <- struct{}{}:
+		return nil
+	default:
+	}
+	// Read without deadline could wait forever.
+	if _, ok := ctx.Deadline(); !ok {
+		return readers.ErrTooManyRequests
+	}
+
+	select {
+	case tr.reads <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return readers.ErrTooManyRequests
+	}
+}
+
+// release frees the read slot taken by acquire.
+func (tr postgresRepository) release() {
+	if tr.reads != nil {
+		<-tr.reads
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/mainflux/mainflux/readers"
+	preader "github.com/mainflux/mainflux/readers/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ driver.Connector = (*slowConnector)(nil)
+
+// slowConnector opens connections whose queries are delayed, and
+// tracks the greatest number of queries running at once.
+type slowConnector struct {
+	driver.Connector
+	delay   time.Duration
+	running int32
+	max     int32
+}
+
+func (sc *slowConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := sc.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return slowConn{Conn: conn, connector: sc}, nil
+}
+
+type slowConn struct {
+	driver.Conn
+	connector *slowConnector
+}
+
+func (sc slowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	running := atomic.AddInt32(&sc.connector.running, 1)
+	defer atomic.AddInt32(&sc.connector.running, -1)
+	for {
+		max := atomic.LoadInt32(&sc.connector.max)
+		if running <= max || atomic.CompareAndSwapInt32(&sc.connector.max, max, running) {
+			break
+		}
+	}
+	time.Sleep(sc.connector.delay)
+
+	return sc.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func TestReadAllMaxConcurrentReads(t *testing.T) {
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	maxReads := 3
+	delay := 20 * time.Millisecond
+
+	cases := map[string]struct {
+		opts     []preader.Option
+		timeout  time.Duration
+		reads    int
+		max      int32
+		rejected bool
+	}{
+		"read concurrently with deadline within bounded reads": {
+			opts:     []preader.Option{preader.WithMaxConcurrentReads(maxReads)},
+			timeout:  10 * time.Second,
+			reads:    20,
+			max:      int32(maxReads),
+			rejected: false,
+		},
+		"read concurrently without deadline within bounded reads": {
+			opts:     []preader.Option{preader.WithMaxConcurrentReads(maxReads)},
+			reads:    20,
+			max:      int32(maxReads),
+			rejected: true,
+		},
+	}
+
+	for desc, tc := range cases {
+		connector, err := pq.NewConnector(dbURL)
+		require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		sc := &slowConnector{Connector: connector, delay: delay}
+		slowDB := sqlx.NewDb(sql.OpenDB(sc), "postgres")
+		reader := preader.New(slowDB, tc.opts...)
+
+		var wg sync.WaitGroup
+		var succeeded, rejected int32
+		errs := make(chan error, tc.reads)
+		for i := 0; i < tc.reads; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx := context.Background()
+				if tc.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+					defer cancel()
+				}
+				_, err := reader.ReadAllContext(ctx, chanID, readers.PageMetadata{Limit: 1})
+				switch err {
+				case nil:
+					atomic.AddInt32(&succeeded, 1)
+				case readers.ErrTooManyRequests:
+					atomic.AddInt32(&rejected, 1)
+				default:
+					errs <- err
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		slowDB.Close()
+
+		for err := range errs {
+			assert.Fail(t, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		}
+		assert.LessOrEqual(t, sc.max, tc.max, fmt.Sprintf("%s: expected at most %d concurrent queries got %d", desc, tc.max, sc.max))
+		assert.Greater(t, succeeded, int32(0), fmt.Sprintf("%s: expected some reads to succeed", desc))
+		assert.Equal(t, tc.rejected, rejected > 0, fmt.Sprintf("%s: expected reads rejected %t got %d rejected", desc, tc.rejected, rejected))
+		assert.Equal(t, int32(tc.reads), succeeded+rejected, fmt.Sprintf("%s: expected %d reads got %d", desc, tc.reads, succeeded+rejected))
+	}
+
+	// Reads are not bounded by default.
+	connector, err := pq.NewConnector(dbURL)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	sc := &slowConnector{Connector: connector, delay: delay}
+	slowDB := sqlx.NewDb(sql.OpenDB(sc), "postgres")
+	defer slowDB.Close()
+	reader := preader.New(slowDB)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2*maxReads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := reader.ReadAll(chanID, readers.PageMetadata{Limit: 1})
+			assert.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+		}()
+	}
+	wg.Wait()
+	assert.Greater(t, sc.max, int32(maxReads), fmt.Sprintf("expected more than %d concurrent queries got %d", maxReads, sc.max))
+}
@@ -25,6 +25,7 @@ const (
 var (
 	testLog, _ = logger.New(os.Stdout, logger.Info.String())
 	db         *sqlx.DB
+	dbURL      string
 )
 
 func TestMain(m *testing.M) {
@@ -46,8 +47,8 @@ func TestMain(m *testing.M) {
 	port := container.GetPort("5432/tcp")
 
 	if err = pool.Retry(func() error {
-		url := fmt.Sprintf("host=localhost port=%s user=test dbname=test password=test sslmode=disable", port)
-		db, err = sqlx.Open("postgres", url)
+		dbURL = fmt.Sprintf("host=localhost port=%s user=test dbname=test password=test sslmode=disable", port)
+		db, err = sqlx.Open("postgres", dbURL)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,38 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import "github.com/mainflux/mainflux/readers"
+
+// Soft-deleted messages, whose deleted_at column is set, are excluded from
+// the read messages, unless page metadata includes them. Tables without the
+// deleted_at column are read as they are. Deleting messages is not affected,
+// so soft-deleted messages can still be purged.
+
+// detectSoftDelete looks up the deleted_at column of the table, unless it's
+// already known whether the table has it.
+func (tr postgresRepository) detectSoftDelete(table string) error {
+	_, err := tr.detectColumn(table, deletedColumn)
+
+	return err
+}
+
+// condition returns the read condition of page metadata, which excludes
+// soft-deleted messages of the tables which support soft deletion.
+func (tr postgresRepository) condition(chanID string, rpm readers.PageMetadata) string {
+	return tr.fmtCondition(chanID, rpm) + tr.deletedCondition(rpm.Format, rpm.IncludeDeleted)
+}
+
+// deletedCondition returns the condition appended to the read condition of
+// the table to exclude its soft-deleted messages, if there are any.
+func (tr postgresRepository) deletedCondition(table string, includeDeleted bool) string {
+	if includeDeleted {
+		return ""
+	}
+	if deleted, _ := tr.columns.get(table, deletedColumn); deleted {
+		return ` AND ` + deletedColumn + ` IS NULL`
+	}
+
+	return ""
+}
@@ -0,0 +1,210 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pwriter "github.com/mainflux/mainflux/consumers/writers/postgres"
+	mfjson "github.com/mainflux/mainflux/pkg/transformers/json"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	preader "github.com/mainflux/mainflux/readers/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const softFormat = "soft_deleted_messages"
+
+func TestReadAllSoftDelete(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i := 0; i < 3; i++ {
+		// Soft-deleted message is the only one of its subtopic.
+		sub := subtopic
+		if i == 0 {
+			sub = "deleted"
+		}
+		messages = append(messages, mfjson.Message{
+			Channel:   chanID,
+			Subtopic:  sub,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Created:   (now - int64(i)) * int64(time.Second),
+			Payload:   map[string]interface{}{"temperature": float64(20 + i)},
+		})
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   messages,
+		Format: softFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Writer doesn't soft-delete messages, so the
+	// column is added and set directly.
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`, softFormat))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = db.Exec(fmt.Sprintf(`UPDATE %s SET deleted_at = NOW() WHERE channel = $1 AND created = $2`, softFormat), chanID, messages[0].Created)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	senmlMsgs := []senml.Message{}
+	for i := 0; i < 2; i++ {
+		senmlMsgs = append(senmlMsgs, senml.Message{
+			Channel:   chanID,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Time:      float64(now - int64(i)),
+			Value:     &v,
+		})
+	}
+	err = writer.Consume(senmlMsgs)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	reader := preader.New(db, preader.WithFormats(softFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		messages []readers.Message
+	}{
+		"read messages excluding soft-deleted ones": {
+			pageMeta: readers.PageMetadata{
+				Format: softFormat,
+				Limit:  limit,
+			},
+			messages: fromJSON(messages[1:]),
+		},
+		"read messages including soft-deleted ones": {
+			pageMeta: readers.PageMetadata{
+				Format:         softFormat,
+				Limit:          limit,
+				IncludeDeleted: true,
+			},
+			messages: fromJSON(messages),
+		},
+		"read messages with filter excluding soft-deleted ones": {
+			pageMeta: readers.PageMetadata{
+				Format: softFormat,
+				Limit:  limit,
+				From:   float64(now - 1),
+			},
+			messages: fromJSON(messages[1:2]),
+		},
+	}
+
+	for desc, tc := range cases {
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", desc, err))
+		assert.ElementsMatch(t, tc.messages, withoutIDs(result.Messages), fmt.Sprintf("%s: expected %v got %v", desc, tc.messages, result.Messages))
+		assert.Equal(t, uint64(len(tc.messages)), result.Total, fmt.Sprintf("%s: expected %d got %d", desc, len(tc.messages), result.Total))
+	}
+
+	// Tables without the deleted_at column are read as they are.
+	result, err := reader.ReadAll(chanID, readers.PageMetadata{Limit: limit})
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	assert.ElementsMatch(t, fromSenml(senmlMsgs), result.Messages, fmt.Sprintf("expected %v got %v", senmlMsgs, result.Messages))
+}
+
+func TestMessageSoftDelete(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	msg := mfjson.Message{
+		Channel:   chanID,
+		Subtopic:  "deleted",
+		Publisher: pubID,
+		Protocol:  mqttProt,
+		Created:   time.Now().UnixNano(),
+		Payload:   map[string]interface{}{"temperature": float64(20)},
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   []mfjson.Message{msg},
+		Format: softFormat,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`, softFormat))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	var id string
+	err = db.Get(&id, fmt.Sprintf(`UPDATE %s SET deleted_at = NOW() WHERE channel = $1 RETURNING id`, softFormat), chanID)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	reader := preader.New(db, preader.WithFormats(softFormat))
+
+	cases := map[string]struct {
+		pageMeta readers.PageMetadata
+		err      error
+	}{
+		"read soft-deleted message": {
+			pageMeta: readers.PageMetadata{Format: softFormat},
+			err:      readers.ErrNotFound,
+		},
+		"read soft-deleted message including deleted ones": {
+			pageMeta: readers.PageMetadata{Format: softFormat, IncludeDeleted: true},
+		},
+	}
+
+	for desc, tc := range cases {
+		_, err := reader.Message(chanID, id, tc.pageMeta)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+	}
+
+	subtopics, err := reader.Subtopics(chanID)
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	assert.Empty(t, subtopics, fmt.Sprintf("expected no subtopics of soft-deleted messages got %v", subtopics))
+}
+
+func TestReadAllSoftDeleteCreatedTable(t *testing.T) {
+	format := "late_soft_deleted_messages"
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	pubID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	// Table is read before it's created, so it must be
+	// looked up again once it exists.
+	reader := preader.New(db, preader.WithFormats(format))
+	_, err = reader.ReadAll(chanID, readers.PageMetadata{Format: format, Limit: limit})
+	assert.Equal(t, readers.ErrTableNotFound, err, fmt.Sprintf("expected %s got %s", readers.ErrTableNotFound, err))
+
+	messages := []mfjson.Message{}
+	now := time.Now().Unix()
+	for i := 0; i < 2; i++ {
+		messages = append(messages, mfjson.Message{
+			Channel:   chanID,
+			Subtopic:  subtopic,
+			Publisher: pubID,
+			Protocol:  mqttProt,
+			Created:   (now - int64(i)) * int64(time.Second),
+			Payload:   map[string]interface{}{"temperature": float64(20 + i)},
+		})
+	}
+	err = writer.Consume(mfjson.Messages{
+		Data:   messages,
+		Format: format,
+	})
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`, format))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	_, err = db.Exec(fmt.Sprintf(`UPDATE %s SET deleted_at = NOW() WHERE channel = $1 AND created = $2`, format), chanID, messages[0].Created)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	result, err := reader.ReadAll(chanID, readers.PageMetadata{Format: format, Limit: limit})
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	assert.ElementsMatch(t, fromJSON(messages[1:]), withoutIDs(result.Messages), fmt.Sprintf("expected %v got %v", messages[1:], result.Messages))
+}
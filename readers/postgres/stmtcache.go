@@ -0,0 +1,101 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WithStmtCache keeps prepared statements of up to the given number of
+// the most recently read query shapes, so that repeated reads with the
+// same filters, but different values, are not parsed and planned again.
+func WithStmtCache(size int) Option {
+	return func(tr *postgresRepository) {
+		if size > 0 {
+			tr.stmts = newStmtCache(size)
+		}
+	}
+}
+
+// stmtCache is a bounded cache of prepared statements, which evicts the
+// least recently used statement once it is full. Page metadata values are
+// always passed as query parameters, so query text identifies its shape.
+type stmtCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	stmts map[string]*list.Element
+}
+
+// cachedStmt is a prepared statement, along with the number of reads
+// using it. Evicted statement is closed once it is no longer used, so
+// that reads started before the eviction aren't affected by it.
+type cachedStmt struct {
+	query   string
+	stmt    *sqlx.NamedStmt
+	refs    int
+	evicted bool
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		order: list.New(),
+		stmts: map[string]*list.Element{},
+	}
+}
+
+// get returns prepared statement of the query, preparing it on the given
+// database if it is not cached yet. Returned statement is in use until
+// it is released.
+func (sc *stmtCache) get(ctx context.Context, db *sqlx.DB, q string) (*cachedStmt, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if el, ok := sc.stmts[q]; ok {
+		sc.order.MoveToFront(el)
+		cs := el.Value.(*cachedStmt)
+		cs.refs++
+		return cs, nil
+	}
+
+	stmt, err := db.PrepareNamedContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	cs := &cachedStmt{query: q, stmt: stmt, refs: 1}
+	sc.stmts[q] = sc.order.PushFront(cs)
+
+	if sc.order.Len() > sc.size {
+		oldest := sc.order.Back()
+		sc.order.Remove(oldest)
+		old := oldest.Value.(*cachedStmt)
+		delete(sc.stmts, old.query)
+		old.evicted = true
+		old.close()
+	}
+
+	return cs, nil
+}
+
+// release marks the statement returned by get as no longer used by the read.
+func (sc *stmtCache) release(cs *cachedStmt) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	cs.refs--
+	cs.close()
+}
+
+// close closes the evicted statement unless it is still used. Rows being
+// read keep the statement open until they are closed.
+func (cs *cachedStmt) close() {
+	if cs.evicted && cs.refs == 0 {
+		cs.stmt.Close()
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres_test
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	pwriter "github.com/mainflux/mainflux/consumers/writers/postgres"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	preader "github.com/mainflux/mainflux/readers/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAllStmtCache(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	subtopics := []string{"temperature", "humidity", "pressure"}
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*len(subtopics); i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: subtopics[i%len(subtopics)],
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Shapes differ by filters applied, while values of the same
+	// filters are read using the same prepared statement.
+	subtopic := func(i int) readers.PageMetadata {
+		return readers.PageMetadata{Limit: limit, Subtopic: subtopics[i]}
+	}
+	from := func(i int) readers.PageMetadata {
+		return readers.PageMetadata{Limit: limit, From: messages[i].Time}
+	}
+	all := readers.PageMetadata{Limit: limit}
+
+	connector, err := pq.NewConnector(dbURL)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	fc := &flakyConnector{Connector: connector}
+	countingDB := sqlx.NewDb(sql.OpenDB(fc), "postgres")
+	defer countingDB.Close()
+	// Statements are prepared on each connection they are used on.
+	countingDB.SetMaxOpenConns(1)
+
+	reader := preader.New(countingDB, preader.WithStmtCache(2))
+	uncached := preader.New(db)
+
+	cases := []struct {
+		desc     string
+		pageMeta readers.PageMetadata
+		prepares int
+	}{
+		{
+			desc:     "read messages of new shape",
+			pageMeta: subtopic(0),
+			prepares: 1,
+		},
+		{
+			desc:     "read messages of cached shape with different value",
+			pageMeta: subtopic(1),
+			prepares: 1,
+		},
+		{
+			desc:     "read messages of second shape",
+			pageMeta: from(4),
+			prepares: 2,
+		},
+		{
+			desc:     "read messages of cached first shape",
+			pageMeta: subtopic(2),
+			prepares: 2,
+		},
+		{
+			desc:     "read messages of third shape evicting least recently used one",
+			pageMeta: all,
+			prepares: 3,
+		},
+		{
+			desc:     "read messages of shape kept in cache",
+			pageMeta: subtopic(0),
+			prepares: 3,
+		},
+		{
+			desc:     "read messages of evicted shape",
+			pageMeta: from(2),
+			prepares: 4,
+		},
+	}
+
+	for _, tc := range cases {
+		expected, err := uncached.ReadAll(chanID, tc.pageMeta)
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", tc.desc, err))
+
+		result, err := reader.ReadAll(chanID, tc.pageMeta)
+		assert.Nil(t, err, fmt.Sprintf("%s: expected no error got %s", tc.desc, err))
+		assert.ElementsMatch(t, expected.Messages, result.Messages, fmt.Sprintf("%s: expected %v got %v", tc.desc, expected.Messages, result.Messages))
+		assert.Equal(t, expected.Total, result.Total, fmt.Sprintf("%s: expected %d got %d", tc.desc, expected.Total, result.Total))
+		assert.Equal(t, tc.prepares, fc.prepares, fmt.Sprintf("%s: expected %d prepared statements got %d", tc.desc, tc.prepares, fc.prepares))
+	}
+}
+
+func TestReadAllStmtCacheConcurrent(t *testing.T) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	subtopics := []string{"temperature", "humidity", "pressure"}
+	messages := map[string][]senml.Message{}
+	all := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < 3*len(subtopics); i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: subtopics[i%len(subtopics)],
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages[msg.Subtopic] = append(messages[msg.Subtopic], msg)
+		all = append(all, msg)
+	}
+	err = writer.Consume(all)
+	require.Nil(t, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Cache is smaller than the number of shapes read at once,
+	// so statements are evicted while others are being read.
+	reader := preader.New(db, preader.WithStmtCache(1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4*len(subtopics); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sub := subtopics[i%len(subtopics)]
+			pm := readers.PageMetadata{Limit: limit, Subtopic: sub}
+			if i%2 == 0 {
+				pm.From = all[len(all)-1].Time
+			}
+			result, err := reader.ReadAll(chanID, pm)
+			assert.Nil(t, err, fmt.Sprintf("read %d: expected no error got %s", i, err))
+			assert.ElementsMatch(t, fromSenml(messages[sub]), result.Messages, fmt.Sprintf("read %d: expected %v got %v", i, messages[sub], result.Messages))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkReadAllStmtCache(b *testing.B) {
+	writer := pwriter.New(db)
+
+	chanID, err := idProvider.ID()
+	require.Nil(b, err, fmt.Sprintf("got unexpected error: %s", err))
+
+	messages := []senml.Message{}
+	now := float64(time.Now().Unix())
+	for i := 0; i < benchMsgsNum; i++ {
+		msg := senml.Message{
+			Channel:  chanID,
+			Subtopic: fmt.Sprintf("subtopic-%d", i%limit),
+			Protocol: mqttProt,
+			Time:     now - float64(i),
+			Value:    &v,
+		}
+		messages = append(messages, msg)
+	}
+	err = writer.Consume(messages)
+	require.Nil(b, err, fmt.Sprintf("expected no error got %s\n", err))
+
+	// Queries have the same shape, but different values.
+	pageMeta := func(i int) readers.PageMetadata {
+		return readers.PageMetadata{
+			Limit:     limit,
+			Subtopic:  fmt.Sprintf("subtopic-%d", i%limit),
+			Protocol:  mqttProt,
+			From:      messages[benchMsgsNum-1].Time,
+			ValueFrom: float(v - 1),
+		}
+	}
+
+	b.Run("without cache", func(b *testing.B) {
+		reader := preader.New(db)
+		for i := 0; i < b.N; i++ {
+			reader.ReadAll(chanID, pageMeta(i))
+		}
+	})
+
+	b.Run("with cache", func(b *testing.B) {
+		reader := preader.New(db, preader.WithStmtCache(limit))
+		for i := 0; i < b.N; i++ {
+			reader.ReadAll(chanID, pageMeta(i))
+		}
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/gofrs/uuid"
+	"github.com/mainflux/mainflux/readers"
+)
+
+// pageToken identifies the last message of the page by its time and ID,
+// so that the next page starts right after it even if messages of the
+// same time exist.
+type pageToken struct {
+	Time float64 `json:"t"`
+	ID   string  `json:"id"`
+}
+
+func encodePageToken(t pageToken) string {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(token string) (pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pageToken{}, readers.ErrInvalidPageToken
+	}
+	var t pageToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return pageToken{}, readers.ErrInvalidPageToken
+	}
+	// Message ID is cast to UUID, so malformed one would fail the query.
+	if _, err := uuid.FromString(t.ID); err != nil {
+		return pageToken{}, readers.ErrInvalidPageToken
+	}
+
+	return t, nil
+}
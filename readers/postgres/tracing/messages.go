@@ -0,0 +1,373 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/arrow"
+	"github.com/mainflux/mainflux/readers/postgres"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+const (
+	readAllOp              = "read_all"
+	readLastOp             = "read_last"
+	readGroupedOp          = "read_grouped_by_subtopic"
+	aggregateOp            = "aggregate"
+	distinctValueCountOp   = "distinct_value_count"
+	aggregatePercentileOp  = "aggregate_percentile"
+	percentileByIntervalOp = "aggregate_percentile_by_interval"
+	aggregateByPublisherOp = "aggregate_by_publisher"
+	aggregateBySubtopicOp  = "aggregate_by_subtopic"
+	countByPayloadFieldOp  = "count_by_payload_field"
+	countByProtocolOp      = "count_by_protocol"
+	subtopicsAboveOp       = "subtopics_above_threshold"
+	readAggregatedOp       = "read_aggregated"
+	streamBucketsOp        = "stream_buckets"
+	countByIntervalOp      = "count_by_interval"
+	missingIntervalsOp     = "missing_intervals"
+	readMovingAverageOp    = "read_moving_average"
+	readDeltasOp           = "read_deltas"
+	streamOp               = "stream"
+	streamNDJSONOp         = "stream_ndjson"
+	deleteAllOp            = "delete_all"
+	subtopicsOp            = "subtopics"
+	publishersOp           = "publishers"
+	countsOp               = "counts"
+	existsOp               = "exists"
+	timeSpanOp             = "time_span"
+	latestOp               = "latest"
+	latestManyOp           = "latest_many"
+	explainOp              = "explain"
+	firstPerPublisherOp    = "first_per_publisher"
+	readColumnarOp         = "read_columnar"
+	readArrowOp            = "read_arrow"
+	storageBytesOp         = "storage_bytes"
+	deleteByIDsOp          = "delete_by_ids"
+	messageOp              = "message"
+	pingOp                 = "ping"
+)
+
+var _ postgres.Repository = (*repositoryMiddleware)(nil)
+
+type repositoryMiddleware struct {
+	tracer opentracing.Tracer
+	repo   postgres.Repository
+}
+
+// RepositoryMiddleware traces message repository queries. Methods that
+// accept context continue the trace of the context span, while the others
+// start a new trace.
+func RepositoryMiddleware(tracer opentracing.Tracer, repo postgres.Repository) postgres.Repository {
+	return repositoryMiddleware{
+		tracer: tracer,
+		repo:   repo,
+	}
+}
+
+func (rm repositoryMiddleware) ReadAll(chanID string, pm readers.PageMetadata) (readers.MessagesPage, error) {
+	return rm.ReadAllContext(context.Background(), chanID, pm)
+}
+
+func (rm repositoryMiddleware) ReadAllContext(ctx context.Context, chanID string, pm readers.PageMetadata) (page readers.MessagesPage, err error) {
+	span := createSpan(ctx, rm.tracer, readAllOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return rm.repo.ReadAllContext(ctx, chanID, pm)
+}
+
+func (rm repositoryMiddleware) ReadLast(chanID string, n uint64, pm readers.PageMetadata) (page readers.MessagesPage, err error) {
+	span := createSpan(context.Background(), rm.tracer, readLastOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.ReadLast(chanID, n, pm)
+}
+
+func (rm repositoryMiddleware) ReadGroupedBySubtopic(chanID string, pm readers.PageMetadata) (groups map[string][]readers.Message, err error) {
+	span := createSpan(context.Background(), rm.tracer, readGroupedOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.ReadGroupedBySubtopic(chanID, pm)
+}
+
+func (rm repositoryMiddleware) FirstPerPublisher(chanID string, pm readers.PageMetadata, n int) (msgs []readers.Message, err error) {
+	span := createSpan(context.Background(), rm.tracer, firstPerPublisherOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.FirstPerPublisher(chanID, pm, n)
+}
+
+func (rm repositoryMiddleware) ReadColumnar(chanID string, pm readers.PageMetadata) (cols postgres.Columns, err error) {
+	span := createSpan(context.Background(), rm.tracer, readColumnarOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.ReadColumnar(chanID, pm)
+}
+
+func (rm repositoryMiddleware) ReadArrow(chanID string, pm readers.PageMetadata) (rec arrow.Record, err error) {
+	span := createSpan(context.Background(), rm.tracer, readArrowOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.ReadArrow(chanID, pm)
+}
+
+// BuildQuery is not traced, since it doesn't query the database.
+func (rm repositoryMiddleware) BuildQuery(chanID string, pm readers.PageMetadata) (string, map[string]interface{}, error) {
+	return rm.repo.BuildQuery(chanID, pm)
+}
+
+func (rm repositoryMiddleware) Explain(chanID string, pm readers.PageMetadata) (plan string, err error) {
+	span := createSpan(context.Background(), rm.tracer, explainOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Explain(chanID, pm)
+}
+
+func (rm repositoryMiddleware) Aggregate(chanID string, pm readers.PageMetadata) (val float64, err error) {
+	span := createSpan(context.Background(), rm.tracer, aggregateOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Aggregate(chanID, pm)
+}
+
+func (rm repositoryMiddleware) DistinctValueCount(chanID string, pm readers.PageMetadata) (count uint64, err error) {
+	span := createSpan(context.Background(), rm.tracer, distinctValueCountOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.DistinctValueCount(chanID, pm)
+}
+
+func (rm repositoryMiddleware) AggregatePercentile(chanID string, pm readers.PageMetadata, p float64) (val float64, err error) {
+	span := createSpan(context.Background(), rm.tracer, aggregatePercentileOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.AggregatePercentile(chanID, pm, p)
+}
+
+func (rm repositoryMiddleware) AggregatePercentileByInterval(chanID string, pm readers.PageMetadata, p float64, interval string) (points []postgres.PercentilePoint, err error) {
+	span := createSpan(context.Background(), rm.tracer, percentileByIntervalOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.AggregatePercentileByInterval(chanID, pm, p, interval)
+}
+
+func (rm repositoryMiddleware) AggregateByPublisher(chanID string, pm readers.PageMetadata) (vals map[string]float64, err error) {
+	span := createSpan(context.Background(), rm.tracer, aggregateByPublisherOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.AggregateByPublisher(chanID, pm)
+}
+
+func (rm repositoryMiddleware) AggregateBySubtopic(chanID string, pm readers.PageMetadata) (vals map[string]float64, err error) {
+	span := createSpan(context.Background(), rm.tracer, aggregateBySubtopicOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.AggregateBySubtopic(chanID, pm)
+}
+
+func (rm repositoryMiddleware) CountByProtocol(chanID string, pm readers.PageMetadata) (counts map[string]uint64, err error) {
+	span := createSpan(context.Background(), rm.tracer, countByProtocolOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.CountByProtocol(chanID, pm)
+}
+
+func (rm repositoryMiddleware) SubtopicsAboveThreshold(chanID string, threshold float64, pm readers.PageMetadata) (subtopics []string, err error) {
+	span := createSpan(context.Background(), rm.tracer, subtopicsAboveOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.SubtopicsAboveThreshold(chanID, threshold, pm)
+}
+
+// StreamBuckets span covers the stream setup only, since the
+// buckets are read after the span is finished.
+func (rm repositoryMiddleware) StreamBuckets(ctx context.Context, chanID string, pm readers.PageMetadata, interval time.Duration) (buckets <-chan postgres.Bucket, err error) {
+	span := createSpan(ctx, rm.tracer, streamBucketsOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.StreamBuckets(ctx, chanID, pm, interval)
+}
+
+func (rm repositoryMiddleware) CountByPayloadField(chanID, field string, pm readers.PageMetadata) (counts map[string]uint64, err error) {
+	span := createSpan(context.Background(), rm.tracer, countByPayloadFieldOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.CountByPayloadField(chanID, field, pm)
+}
+
+func (rm repositoryMiddleware) ReadAggregated(chanID string, pm readers.PageMetadata) (page postgres.AggregatedPage, err error) {
+	span := createSpan(context.Background(), rm.tracer, readAggregatedOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.ReadAggregated(chanID, pm)
+}
+
+func (rm repositoryMiddleware) CountByInterval(chanID string, pm readers.PageMetadata, interval string) (counts []postgres.IntervalCount, err error) {
+	span := createSpan(context.Background(), rm.tracer, countByIntervalOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.CountByInterval(chanID, pm, interval)
+}
+
+func (rm repositoryMiddleware) MissingIntervals(chanID string, pm readers.PageMetadata, interval string) (gaps []time.Time, err error) {
+	span := createSpan(context.Background(), rm.tracer, missingIntervalsOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.MissingIntervals(chanID, pm, interval)
+}
+
+func (rm repositoryMiddleware) ReadMovingAverage(chanID string, pm readers.PageMetadata, window int) (points []postgres.AggPoint, err error) {
+	span := createSpan(context.Background(), rm.tracer, readMovingAverageOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.ReadMovingAverage(chanID, pm, window)
+}
+
+func (rm repositoryMiddleware) ReadDeltas(chanID string, pm readers.PageMetadata) (points []postgres.DeltaPoint, err error) {
+	span := createSpan(context.Background(), rm.tracer, readDeltasOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.ReadDeltas(chanID, pm)
+}
+
+func (rm repositoryMiddleware) Stream(chanID string, pm readers.PageMetadata) (readers.MessageCursor, error) {
+	return rm.StreamContext(context.Background(), chanID, pm)
+}
+
+// StreamContext span covers the query only, since the
+// messages are read after the span is finished.
+func (rm repositoryMiddleware) StreamContext(ctx context.Context, chanID string, pm readers.PageMetadata) (cursor readers.MessageCursor, err error) {
+	span := createSpan(ctx, rm.tracer, streamOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return rm.repo.StreamContext(ctx, chanID, pm)
+}
+
+func (rm repositoryMiddleware) StreamNDJSON(ctx context.Context, w io.Writer, chanID string, pm readers.PageMetadata) (err error) {
+	span := createSpan(ctx, rm.tracer, streamNDJSONOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return rm.repo.StreamNDJSON(ctx, w, chanID, pm)
+}
+
+func (rm repositoryMiddleware) DeleteAll(chanID string, pm readers.PageMetadata) (n uint64, err error) {
+	span := createSpan(context.Background(), rm.tracer, deleteAllOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.DeleteAll(chanID, pm)
+}
+
+func (rm repositoryMiddleware) DeleteByIDs(chanID string, ids []string) (n uint64, err error) {
+	span := createSpan(context.Background(), rm.tracer, deleteByIDsOp, chanID, readers.PageMetadata{})
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.DeleteByIDs(chanID, ids)
+}
+
+func (rm repositoryMiddleware) Subtopics(chanID string) (subtopics []string, err error) {
+	span := createSpan(context.Background(), rm.tracer, subtopicsOp, chanID, readers.PageMetadata{})
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Subtopics(chanID)
+}
+
+func (rm repositoryMiddleware) Publishers(chanID string, pm readers.PageMetadata) (publishers []string, err error) {
+	span := createSpan(context.Background(), rm.tracer, publishersOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Publishers(chanID, pm)
+}
+
+func (rm repositoryMiddleware) Counts(channels []string, pm readers.PageMetadata) (counts map[string]uint64, err error) {
+	span := createSpan(context.Background(), rm.tracer, countsOp, "", pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Counts(channels, pm)
+}
+
+func (rm repositoryMiddleware) TimeSpan(chanID string, pm readers.PageMetadata) (min, max time.Time, err error) {
+	span := createSpan(context.Background(), rm.tracer, timeSpanOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.TimeSpan(chanID, pm)
+}
+
+func (rm repositoryMiddleware) Exists(chanID string, pm readers.PageMetadata) (exists bool, err error) {
+	span := createSpan(context.Background(), rm.tracer, existsOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Exists(chanID, pm)
+}
+
+func (rm repositoryMiddleware) StorageBytes(chanID string) (size uint64, err error) {
+	span := createSpan(context.Background(), rm.tracer, storageBytesOp, chanID, readers.PageMetadata{})
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.StorageBytes(chanID)
+}
+
+func (rm repositoryMiddleware) Latest(chanID string, pm readers.PageMetadata) (msg readers.Message, err error) {
+	span := createSpan(context.Background(), rm.tracer, latestOp, chanID, pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Latest(chanID, pm)
+}
+
+func (rm repositoryMiddleware) LatestMany(channels []string, pm readers.PageMetadata) (latest map[string]readers.Message, err error) {
+	span := createSpan(context.Background(), rm.tracer, latestManyOp, "", pm)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.LatestMany(channels, pm)
+}
+
+func (rm repositoryMiddleware) Message(chanID, id string, pm readers.PageMetadata) (msg readers.Message, err error) {
+	span := createSpan(context.Background(), rm.tracer, messageOp, chanID, pm)
+	span.SetTag("message_id", id)
+	defer func() { finishSpan(span, err) }()
+
+	return rm.repo.Message(chanID, id, pm)
+}
+
+func (rm repositoryMiddleware) Ping(ctx context.Context) (err error) {
+	span := createSpan(ctx, rm.tracer, pingOp, "", readers.PageMetadata{})
+	defer func() { finishSpan(span, err) }()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	return rm.repo.Ping(ctx)
+}
+
+func createSpan(ctx context.Context, tracer opentracing.Tracer, opName, chanID string, pm readers.PageMetadata) opentracing.Span {
+	var span opentracing.Span
+	if parentSpan := opentracing.SpanFromContext(ctx); parentSpan != nil {
+		span = tracer.StartSpan(opName, opentracing.ChildOf(parentSpan.Context()))
+	} else {
+		span = tracer.StartSpan(opName)
+	}
+
+	if chanID != "" {
+		span.SetTag("channel_id", chanID)
+		span.SetTag("limit", pm.Limit)
+		span.SetTag("offset", pm.Offset)
+		span.SetTag("format", pm.Format)
+	}
+
+	return span
+}
+
+func finishSpan(span opentracing.Span, err error) {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err))
+	}
+	span.Finish()
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/postgres"
+	"github.com/mainflux/mainflux/readers/postgres/tracing"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	chanID   = "1"
+	errChan  = "2"
+	format   = "messages"
+	limit    = 10
+	offset   = 5
+	errorTag = "error"
+)
+
+var errQuery = errors.New("query failed")
+
+// repositoryStub implements only the methods used in tests,
+// calling any other method panics.
+type repositoryStub struct {
+	postgres.Repository
+	ctx context.Context
+}
+
+func (rs *repositoryStub) ReadAllContext(ctx context.Context, chanID string, pm readers.PageMetadata) (readers.MessagesPage, error) {
+	rs.ctx = ctx
+	if chanID == errChan {
+		return readers.MessagesPage{}, errQuery
+	}
+	return readers.MessagesPage{PageMetadata: pm}, nil
+}
+
+func (rs *repositoryStub) ReadLast(chanID string, n uint64, pm readers.PageMetadata) (readers.MessagesPage, error) {
+	if chanID == errChan {
+		return readers.MessagesPage{}, errQuery
+	}
+	return readers.MessagesPage{PageMetadata: pm}, nil
+}
+
+func (rs *repositoryStub) Latest(chanID string, pm readers.PageMetadata) (readers.Message, error) {
+	if chanID == errChan {
+		return nil, readers.ErrNotFound
+	}
+	return senml.Message{Channel: chanID}, nil
+}
+
+func TestRepositoryMiddleware(t *testing.T) {
+	pm := readers.PageMetadata{
+		Limit:  limit,
+		Offset: offset,
+		Format: format,
+	}
+
+	cases := map[string]struct {
+		call   func(repo postgres.Repository) error
+		opName string
+		chanID string
+		err    error
+	}{
+		"read all messages": {
+			call: func(repo postgres.Repository) error {
+				_, err := repo.ReadAll(chanID, pm)
+				return err
+			},
+			opName: "read_all",
+			chanID: chanID,
+		},
+		"read all messages with context": {
+			call: func(repo postgres.Repository) error {
+				_, err := repo.ReadAllContext(context.Background(), chanID, pm)
+				return err
+			},
+			opName: "read_all",
+			chanID: chanID,
+		},
+		"read all messages with error": {
+			call: func(repo postgres.Repository) error {
+				_, err := repo.ReadAll(errChan, pm)
+				return err
+			},
+			opName: "read_all",
+			chanID: errChan,
+			err:    errQuery,
+		},
+		"read last messages": {
+			call: func(repo postgres.Repository) error {
+				_, err := repo.ReadLast(chanID, limit, pm)
+				return err
+			},
+			opName: "read_last",
+			chanID: chanID,
+		},
+		"read latest message": {
+			call: func(repo postgres.Repository) error {
+				_, err := repo.Latest(chanID, pm)
+				return err
+			},
+			opName: "latest",
+			chanID: chanID,
+		},
+		"read latest message with error": {
+			call: func(repo postgres.Repository) error {
+				_, err := repo.Latest(errChan, pm)
+				return err
+			},
+			opName: "latest",
+			chanID: errChan,
+			err:    readers.ErrNotFound,
+		},
+	}
+
+	for desc, tc := range cases {
+		tracer := mocktracer.New()
+		repo := tracing.RepositoryMiddleware(tracer, &repositoryStub{})
+
+		err := tc.call(repo)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected %s got %s", desc, tc.err, err))
+
+		spans := tracer.FinishedSpans()
+		if !assert.Len(t, spans, 1, fmt.Sprintf("%s: expected single finished span got %d", desc, len(spans))) {
+			continue
+		}
+		span := spans[0]
+		assert.Equal(t, tc.opName, span.OperationName, fmt.Sprintf("%s: expected %s got %s", desc, tc.opName, span.OperationName))
+
+		tags := map[string]interface{}{
+			"channel_id": tc.chanID,
+			"limit":      pm.Limit,
+			"offset":     pm.Offset,
+			"format":     pm.Format,
+		}
+		if tc.err != nil {
+			tags[errorTag] = true
+		}
+		assert.Equal(t, tags, span.Tags(), fmt.Sprintf("%s: expected %v got %v", desc, tags, span.Tags()))
+	}
+}
+
+func TestRepositoryMiddlewareContext(t *testing.T) {
+	tracer := mocktracer.New()
+	stub := &repositoryStub{}
+	repo := tracing.RepositoryMiddleware(tracer, stub)
+
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	_, err := repo.ReadAllContext(ctx, chanID, readers.PageMetadata{Limit: limit})
+	assert.Nil(t, err, fmt.Sprintf("expected no error got %s", err))
+	parent.Finish()
+
+	spans := tracer.FinishedSpans()
+	assert.Len(t, spans, 2, fmt.Sprintf("expected 2 finished spans got %d", len(spans)))
+
+	child := spans[0]
+	parentCtx := parent.Context().(mocktracer.MockSpanContext)
+	assert.Equal(t, parentCtx.SpanID, child.ParentID, fmt.Sprintf("expected parent span %d got %d", parentCtx.SpanID, child.ParentID))
+	assert.Equal(t, parentCtx.TraceID, child.SpanContext.TraceID, fmt.Sprintf("expected trace %d got %d", parentCtx.TraceID, child.SpanContext.TraceID))
+
+	// Repository receives context of the repository span.
+	span := opentracing.SpanFromContext(stub.ctx).(*mocktracer.MockSpan)
+	assert.Equal(t, child.SpanContext.SpanID, span.SpanContext.SpanID, fmt.Sprintf("expected span %d got %d", child.SpanContext.SpanID, span.SpanContext.SpanID))
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package postgres
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unitConversion converts values of the unit to the base unit of its
+// quantity as (value + offset) * num / den. Scale is kept as a fraction,
+// so that converting between the units doesn't lose precision.
+type unitConversion struct {
+	quantity string
+	offset   float64
+	num      float64
+	den      float64
+}
+
+// SenML units values can be normalized between.
+var unitConversions = map[string]unitConversion{
+	"Cel":  {quantity: "temperature", offset: 0, num: 1, den: 1},
+	"K":    {quantity: "temperature", offset: -273.15, num: 1, den: 1},
+	"degF": {quantity: "temperature", offset: -32, num: 5, den: 9},
+}
+
+// fmtNormalized returns expressions of the SenML message value and unit
+// converted to the target unit. Values of the units which can't be
+// converted to it are returned as they are, along with their own unit.
+func fmtNormalized(target string) (string, string) {
+	tc := unitConversions[target]
+
+	units := []string{}
+	for unit, uc := range unitConversions {
+		if unit != target && uc.quantity == tc.quantity {
+			units = append(units, unit)
+		}
+	}
+	// Units are sorted so that the query text, which
+	// identifies cached statements, is always the same.
+	sort.Strings(units)
+
+	values, names := []string{}, []string{}
+	for _, unit := range units {
+		uc := unitConversions[unit]
+		base := fmt.Sprintf(`(value + %g) * %g / %g`, uc.offset, uc.num, uc.den)
+		values = append(values, fmt.Sprintf(`WHEN '%s' THEN %s * %g / %g - %g`, unit, base, tc.den, tc.num, tc.offset))
+		names = append(names, fmt.Sprintf(`'%s'`, unit))
+	}
+	if len(units) == 0 {
+		return `value`, `COALESCE(unit, '')`
+	}
+
+	value := fmt.Sprintf(`CASE unit %s ELSE value END`, strings.Join(values, " "))
+	unit := fmt.Sprintf(`CASE WHEN unit IN (%s) THEN CAST(:normalize_unit AS TEXT) ELSE COALESCE(unit, '') END`, strings.Join(names, ", "))
+
+	return value, unit
+}
@@ -0,0 +1,256 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package remoteread
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/mainflux/mainflux"
+	"github.com/mainflux/mainflux/pkg/errors"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// MetricNameLabel is label holding metric name, which is
+	// channel ID optionally followed by slash and subtopic.
+	MetricNameLabel = "__name__"
+
+	pageSize    = 1000
+	contentType = "application/x-protobuf"
+	encoding    = "snappy"
+)
+
+var (
+	// ErrInvalidQuery indicates that query doesn't select a single metric
+	// by its name or uses unsupported label matchers.
+	ErrInvalidQuery = errors.New("invalid remote read query")
+
+	// ErrTooManySamples indicates that queries select more samples
+	// than a single response may carry.
+	ErrTooManySamples = errors.New("remote read queries select too many samples")
+
+	// ErrUnauthorizedAccess indicates that request credentials are
+	// missing or don't grant access to the queried channel.
+	ErrUnauthorizedAccess = errors.New("missing or invalid credentials provided")
+
+	errReadRequest = errors.New("failed to decode remote read request")
+)
+
+// Read executes remote read request queries against the message repository.
+// Each query selects values of SenML messages of a single channel and
+// subtopic within the query time range. Queries may select at most
+// maxSamples samples in total, while zero doesn't limit the samples.
+func Read(repo readers.MessageRepository, req *ReadRequest, maxSamples int) (*ReadResponse, error) {
+	res := &ReadResponse{}
+	left := maxSamples
+	for _, q := range req.Queries {
+		ts, err := query(repo, q, maxSamples, &left)
+		if err != nil {
+			return nil, err
+		}
+		res.Results = append(res.Results, &QueryResult{Timeseries: ts})
+	}
+
+	return res, nil
+}
+
+func query(repo readers.MessageRepository, q *Query, maxSamples int, left *int) ([]*TimeSeries, error) {
+	name, chanID, subtopic, err := metric(q)
+	if err != nil {
+		return nil, err
+	}
+
+	// Query end is inclusive, while page metadata upper bound is not.
+	rpm := readers.PageMetadata{
+		Limit:    pageSize,
+		Subtopic: subtopic,
+		From:     float64(q.StartTimestampMs) / 1e3,
+		To:       float64(q.EndTimestampMs+1) / 1e3,
+	}
+
+	samples := []*Sample{}
+	for {
+		page, err := repo.ReadAll(chanID, rpm)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range page.Messages {
+			msg, ok := m.(senml.Message)
+			if !ok || msg.Value == nil {
+				continue
+			}
+			if maxSamples > 0 {
+				if *left == 0 {
+					return nil, ErrTooManySamples
+				}
+				*left--
+			}
+			samples = append(samples, &Sample{
+				Value:     *msg.Value,
+				Timestamp: int64(msg.Time * 1e3),
+			})
+		}
+		// Repository may read fewer messages than requested, so
+		// pages are read until all the matching messages are read.
+		rpm.Offset += uint64(len(page.Messages))
+		if len(page.Messages) == 0 || rpm.Offset >= page.Total {
+			break
+		}
+	}
+	if len(samples) == 0 {
+		return []*TimeSeries{}, nil
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp < samples[j].Timestamp
+	})
+
+	return []*TimeSeries{{
+		Labels:  []*Label{{Name: MetricNameLabel, Value: name}},
+		Samples: samples,
+	}}, nil
+}
+
+// metric returns name of the metric selected by the query, along with
+// channel and subtopic the name consists of.
+func metric(q *Query) (string, string, string, error) {
+	name, err := metricName(q)
+	if err != nil {
+		return "", "", "", err
+	}
+	chanID, subtopic := name, ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		chanID, subtopic = name[:i], name[i+1:]
+	}
+	if chanID == "" {
+		return "", "", "", ErrInvalidQuery
+	}
+
+	return name, chanID, subtopic, nil
+}
+
+// metricName returns name of the metric selected by the query.
+func metricName(q *Query) (string, error) {
+	name := ""
+	for _, m := range q.Matchers {
+		if m.Name != MetricNameLabel || m.Type != MatchEqual || name != "" {
+			return "", ErrInvalidQuery
+		}
+		name = m.Value
+	}
+	if name == "" {
+		return "", ErrInvalidQuery
+	}
+
+	return name, nil
+}
+
+// NewHandler returns HTTP handler serving snappy compressed protobuf
+// remote read requests. Request key has to grant access to channels of
+// all the queries, which may select at most maxSamples samples in total.
+func NewHandler(repo readers.MessageRepository, tc mainflux.ThingsServiceClient, maxSamples int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = authorize(tc, r.Header.Get("Authorization"), req)
+		switch {
+		case errors.Contains(err, ErrInvalidQuery):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Contains(err, ErrUnauthorizedAccess):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res, err := Read(repo, req, maxSamples)
+		switch {
+		case errors.Contains(err, ErrInvalidQuery):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Contains(err, ErrTooManySamples):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := proto.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(snappy.Encode(nil, data))
+	})
+}
+
+// authorize checks whether the key grants access to channels
+// of all the request queries.
+func authorize(tc mainflux.ThingsServiceClient, key string, req *ReadRequest) error {
+	if key == "" {
+		return ErrUnauthorizedAccess
+	}
+
+	checked := map[string]bool{}
+	for _, q := range req.Queries {
+		_, chanID, _, err := metric(q)
+		if err != nil {
+			return err
+		}
+		if checked[chanID] {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err = tc.CanAccessByKey(ctx, &mainflux.AccessByKeyReq{Token: key, ChanID: chanID})
+		cancel()
+		if err != nil {
+			if e, ok := status.FromError(err); ok && e.Code() == codes.PermissionDenied {
+				return ErrUnauthorizedAccess
+			}
+			return err
+		}
+		checked[chanID] = true
+	}
+
+	return nil
+}
+
+func decodeRequest(r *http.Request) (*ReadRequest, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.Wrap(errReadRequest, err)
+	}
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, errors.Wrap(errReadRequest, err)
+	}
+
+	req := &ReadRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		return nil, errors.Wrap(errReadRequest, err)
+	}
+
+	return req, nil
+}
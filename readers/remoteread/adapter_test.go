@@ -0,0 +1,245 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package remoteread_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/mainflux/mainflux/pkg/transformers/senml"
+	"github.com/mainflux/mainflux/readers"
+	"github.com/mainflux/mainflux/readers/mocks"
+	"github.com/mainflux/mainflux/readers/remoteread"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chanID   = "50e6b371-60ff-45cf-bb52-8200e7cde536"
+	subtopic = "room/1"
+	msgsNum  = 20
+	start    = 1600000000
+	token    = "token"
+)
+
+func newServer(messages []readers.Message, maxSamples int) *httptest.Server {
+	repo := mocks.NewMessageRepository(chanID, messages)
+	tc := mocks.NewThingsService()
+	return httptest.NewServer(remoteread.NewHandler(repo, tc, maxSamples))
+}
+
+func post(t *testing.T, url, key string, body []byte) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if key != "" {
+		req.Header.Set("Authorization", key)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	return res
+}
+
+func encode(t *testing.T, req *remoteread.ReadRequest) []byte {
+	data, err := proto.Marshal(req)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	return snappy.Encode(nil, data)
+}
+
+func decode(t *testing.T, body []byte) *remoteread.ReadResponse {
+	data, err := snappy.Decode(nil, body)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	res := &remoteread.ReadResponse{}
+	err = proto.Unmarshal(data, res)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	return res
+}
+
+func nameQuery(name string, from, to int64) *remoteread.Query {
+	return &remoteread.Query{
+		StartTimestampMs: from * 1e3,
+		EndTimestampMs:   to * 1e3,
+		Matchers: []*remoteread.LabelMatcher{
+			{Type: remoteread.MatchEqual, Name: remoteread.MetricNameLabel, Value: name},
+		},
+	}
+}
+
+func TestRemoteRead(t *testing.T) {
+	// Every other message is written to subtopic, and every
+	// fifth message carries string value instead of number.
+	messages := []readers.Message{}
+	subSamples := []*remoteread.Sample{}
+	for i := 0; i < msgsNum; i++ {
+		val := float64(i)
+		msg := senml.Message{
+			Channel:  chanID,
+			Protocol: "mqtt",
+			Time:     float64(start + i),
+		}
+		if i%2 == 0 {
+			msg.Subtopic = subtopic
+		}
+		if i%5 == 0 {
+			str := "value"
+			msg.StringValue = &str
+		} else {
+			msg.Value = &val
+		}
+		messages = append(messages, msg)
+
+		if msg.Subtopic == subtopic && msg.Value != nil {
+			subSamples = append(subSamples, &remoteread.Sample{Value: val, Timestamp: int64(start+i) * 1e3})
+		}
+	}
+
+	ts := newServer(messages, msgsNum)
+	defer ts.Close()
+
+	name := fmt.Sprintf("%s/%s", chanID, subtopic)
+	cases := map[string]struct {
+		req     *remoteread.ReadRequest
+		key     string
+		status  int
+		samples [][]*remoteread.Sample
+	}{
+		"read subtopic values": {
+			req:     &remoteread.ReadRequest{Queries: []*remoteread.Query{nameQuery(name, start, start+msgsNum)}},
+			key:     token,
+			status:  http.StatusOK,
+			samples: [][]*remoteread.Sample{subSamples},
+		},
+		"read subtopic values with invalid key": {
+			req:    &remoteread.ReadRequest{Queries: []*remoteread.Query{nameQuery(name, start, start+msgsNum)}},
+			key:    "invalid",
+			status: http.StatusForbidden,
+		},
+		"read subtopic values without key": {
+			req:    &remoteread.ReadRequest{Queries: []*remoteread.Query{nameQuery(name, start, start+msgsNum)}},
+			status: http.StatusForbidden,
+		},
+		"read more values than allowed": {
+			req: &remoteread.ReadRequest{Queries: []*remoteread.Query{
+				nameQuery(name, start, start+msgsNum),
+				nameQuery(name, start, start+msgsNum),
+				nameQuery(name, start, start+msgsNum),
+			}},
+			key:    token,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		"read subtopic values within time range": {
+			req:     &remoteread.ReadRequest{Queries: []*remoteread.Query{nameQuery(name, start+4, start+8)}},
+			key:     token,
+			status:  http.StatusOK,
+			samples: [][]*remoteread.Sample{subSamples[1:4]},
+		},
+		"read multiple queries": {
+			req: &remoteread.ReadRequest{Queries: []*remoteread.Query{
+				nameQuery(name, start, start+3),
+				nameQuery(name, start+msgsNum, start+2*msgsNum),
+			}},
+			key:     token,
+			status:  http.StatusOK,
+			samples: [][]*remoteread.Sample{subSamples[:1], nil},
+		},
+		"read without metric name": {
+			req: &remoteread.ReadRequest{Queries: []*remoteread.Query{{
+				StartTimestampMs: start * 1e3,
+				EndTimestampMs:   (start + msgsNum) * 1e3,
+			}}},
+			key:    token,
+			status: http.StatusBadRequest,
+		},
+		"read with regexp matcher": {
+			req: &remoteread.ReadRequest{Queries: []*remoteread.Query{{
+				Matchers: []*remoteread.LabelMatcher{
+					{Type: remoteread.MatchRegexp, Name: remoteread.MetricNameLabel, Value: ".*"},
+				},
+			}}},
+			key:    token,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for desc, tc := range cases {
+		res := post(t, ts.URL, tc.key, encode(t, tc.req))
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		require.Nil(t, err, fmt.Sprintf("%s: got unexpected error: %s", desc, err))
+		assert.Equal(t, tc.status, res.StatusCode, fmt.Sprintf("%s: expected status %d got %d", desc, tc.status, res.StatusCode))
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		rr := decode(t, body)
+		require.Len(t, rr.Results, len(tc.samples), fmt.Sprintf("%s: expected %d results got %d", desc, len(tc.samples), len(rr.Results)))
+		for i, samples := range tc.samples {
+			if samples == nil {
+				assert.Empty(t, rr.Results[i].Timeseries, fmt.Sprintf("%s: expected no time series got %v", desc, rr.Results[i].Timeseries))
+				continue
+			}
+			require.Len(t, rr.Results[i].Timeseries, 1, fmt.Sprintf("%s: expected single time series", desc))
+			series := rr.Results[i].Timeseries[0]
+			labels := []*remoteread.Label{{Name: remoteread.MetricNameLabel, Value: name}}
+			assert.Equal(t, labels, series.Labels, fmt.Sprintf("%s: expected %v got %v", desc, labels, series.Labels))
+			assert.Equal(t, samples, series.Samples, fmt.Sprintf("%s: expected %v got %v", desc, samples, series.Samples))
+		}
+	}
+}
+
+// cappedRepository reads at most limit messages at once, regardless
+// of the requested page size.
+type cappedRepository struct {
+	readers.MessageRepository
+	limit uint64
+}
+
+func (cr cappedRepository) ReadAll(chanID string, rpm readers.PageMetadata) (readers.MessagesPage, error) {
+	if rpm.Limit > cr.limit {
+		rpm.Limit = cr.limit
+	}
+
+	return cr.MessageRepository.ReadAll(chanID, rpm)
+}
+
+func TestRemoteReadCappedPages(t *testing.T) {
+	messages := []readers.Message{}
+	samples := []*remoteread.Sample{}
+	for i := 0; i < msgsNum; i++ {
+		val := float64(i)
+		messages = append(messages, senml.Message{
+			Channel:  chanID,
+			Protocol: "mqtt",
+			Time:     float64(start + i),
+			Value:    &val,
+		})
+		samples = append(samples, &remoteread.Sample{Value: val, Timestamp: int64(start+i) * 1e3})
+	}
+
+	repo := cappedRepository{
+		MessageRepository: mocks.NewMessageRepository(chanID, messages),
+		limit:             3,
+	}
+	req := &remoteread.ReadRequest{Queries: []*remoteread.Query{nameQuery(chanID, start, start+msgsNum)}}
+	rr, err := remoteread.Read(repo, req, 0)
+	require.Nil(t, err, fmt.Sprintf("got unexpected error: %s", err))
+	require.Len(t, rr.Results, 1, fmt.Sprintf("expected single result got %d", len(rr.Results)))
+	require.Len(t, rr.Results[0].Timeseries, 1, "expected single time series")
+	assert.Equal(t, samples, rr.Results[0].Timeseries[0].Samples, fmt.Sprintf("expected %v got %v", samples, rr.Results[0].Timeseries[0].Samples))
+}
+
+func TestRemoteReadInvalidBody(t *testing.T) {
+	ts := newServer([]readers.Message{}, 0)
+	defer ts.Close()
+
+	res := post(t, ts.URL, token, []byte("not snappy"))
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, fmt.Sprintf("expected status %d got %d", http.StatusBadRequest, res.StatusCode))
+}
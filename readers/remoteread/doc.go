@@ -0,0 +1,6 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package remoteread contains adapter which serves SenML message values
+// to Prometheus using its remote read protocol.
+package remoteread
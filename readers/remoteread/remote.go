@@ -0,0 +1,144 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package remoteread
+
+import "github.com/gogo/protobuf/proto"
+
+// Messages below mirror the subset of Prometheus remote read protocol
+// (prompb remote.proto and types.proto) used by the adapter. Field numbers
+// must match the upstream definitions.
+
+// MatchType is a type of label matcher.
+type MatchType int32
+
+const (
+	// MatchEqual matches label value exactly.
+	MatchEqual MatchType = 0
+	// MatchNotEqual matches values different from label value.
+	MatchNotEqual MatchType = 1
+	// MatchRegexp matches values against regular expression.
+	MatchRegexp MatchType = 2
+	// MatchNotRegexp matches values not matching regular expression.
+	MatchNotRegexp MatchType = 3
+)
+
+// ReadRequest represents remote read request.
+type ReadRequest struct {
+	Queries []*Query `protobuf:"bytes,1,rep,name=queries,proto3" json:"queries,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *ReadRequest) Reset() { *m = ReadRequest{} }
+
+// String implements proto.Message interface.
+func (m *ReadRequest) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*ReadRequest) ProtoMessage() {}
+
+// ReadResponse represents remote read response. There is a result
+// per request query, in the same order.
+type ReadResponse struct {
+	Results []*QueryResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *ReadResponse) Reset() { *m = ReadResponse{} }
+
+// String implements proto.Message interface.
+func (m *ReadResponse) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*ReadResponse) ProtoMessage() {}
+
+// Query selects time series within the time range.
+type Query struct {
+	StartTimestampMs int64           `protobuf:"varint,1,opt,name=start_timestamp_ms,json=startTimestampMs,proto3" json:"start_timestamp_ms,omitempty"`
+	EndTimestampMs   int64           `protobuf:"varint,2,opt,name=end_timestamp_ms,json=endTimestampMs,proto3" json:"end_timestamp_ms,omitempty"`
+	Matchers         []*LabelMatcher `protobuf:"bytes,3,rep,name=matchers,proto3" json:"matchers,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *Query) Reset() { *m = Query{} }
+
+// String implements proto.Message interface.
+func (m *Query) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*Query) ProtoMessage() {}
+
+// QueryResult contains time series matching the query.
+type QueryResult struct {
+	Timeseries []*TimeSeries `protobuf:"bytes,1,rep,name=timeseries,proto3" json:"timeseries,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *QueryResult) Reset() { *m = QueryResult{} }
+
+// String implements proto.Message interface.
+func (m *QueryResult) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*QueryResult) ProtoMessage() {}
+
+// TimeSeries is a labeled list of samples sorted by timestamp.
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *TimeSeries) Reset() { *m = TimeSeries{} }
+
+// String implements proto.Message interface.
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*TimeSeries) ProtoMessage() {}
+
+// Label is a time series label.
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *Label) Reset() { *m = Label{} }
+
+// String implements proto.Message interface.
+func (m *Label) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*Label) ProtoMessage() {}
+
+// LabelMatcher selects time series by label value.
+type LabelMatcher struct {
+	Type  MatchType `protobuf:"varint,1,opt,name=type,proto3,enum=prometheus.LabelMatcher_Type" json:"type,omitempty"`
+	Name  string    `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Value string    `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *LabelMatcher) Reset() { *m = LabelMatcher{} }
+
+// String implements proto.Message interface.
+func (m *LabelMatcher) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*LabelMatcher) ProtoMessage() {}
+
+// Sample is a single time series value with millisecond timestamp.
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+// Reset implements proto.Message interface.
+func (m *Sample) Reset() { *m = Sample{} }
+
+// String implements proto.Message interface.
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message interface.
+func (*Sample) ProtoMessage() {}